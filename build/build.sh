@@ -14,4 +14,4 @@ go env
 GOOS=$(go env GOOS)
 go vet -v ./...
 #go test -p 1 -v ./... -cover
-go build -v -o "bin/stocker-$GOOS" cmd/stocker/stocker.go
+go build -v -o "bin/stocker-$GOOS" ./cmd/stocker
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	port "github.com/shanebarnes/stocker/internal/portfolio"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// Manage OAuth 2.0 credentials. The only action is to refresh them.
+func auth(args []string) int {
+	flags := newFlagSet("auth", "refresh", "Redeem the refresh token of an OAuth 2.0 credentials file for a new access token and refresh token,\nsaving them back to the credentials file.")
+	apiFlags := newApiFlags(flags)
+	defer apiFlags.close()
+	args, exitCode, ok := parseFlags(flags, args)
+	if !ok {
+		return exitCode
+	}
+
+	if len(args) == 0 {
+		return usageError(flags, "No auth action was provided")
+	} else if len(args) > 1 || args[0] != "refresh" {
+		return usageError(flags, "Unknown auth action:", strings.Join(args, " "))
+	} else if exitCode = apiFlags.apply(log.WarnLevel); exitCode != exitOk {
+		return exitCode
+	} else if len(apiFlags.oauthCreds) == 0 {
+		return usageError(flags, "No credentials file was provided")
+	}
+
+	// Credentials are refreshed below whether or not -refresh is set
+	apiFlags.oauthRefresh = false
+	stockApi, exitCode := apiFlags.newStockApi()
+	if stockApi == nil {
+		return exitCode
+	}
+
+	creds, err := api.NewStockApiContext(stockApi).RefreshCredentialsContext(apiFlags.getContext())
+	if err != nil {
+		err = fmt.Errorf("%w: failed to refresh credentials: %w", port.ErrInvalidCredentials, err)
+		fmt.Fprintln(os.Stderr, err)
+		return getExitCode(err)
+	}
+
+	fmt.Println("Credentials refreshed and saved to", apiFlags.oauthCreds)
+	if creds != nil {
+		if expiresAt, ok := creds.ExpiresAt(); ok {
+			fmt.Println("Access token expires at", expiresAt.Local().Format(time.RFC3339))
+		}
+	}
+	return exitOk
+}
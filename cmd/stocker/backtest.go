@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	port "github.com/shanebarnes/stocker/internal/portfolio"
+	av "github.com/shanebarnes/stocker/internal/stock/api/alphavantage"
+	log "github.com/sirupsen/logrus"
+)
+
+// Parse the start and end dates of a backtest. The end date defaults to today.
+func parseBacktestDates(start, end string, now time.Time) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if len(start) == 0 {
+		err = errors.New("No start date was provided")
+	} else if from, err = time.Parse(port.BacktestDateFormat, start); err != nil {
+		err = fmt.Errorf("Invalid start date: %s", start)
+	} else if len(end) == 0 {
+		y, m, d := now.Date()
+		to = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	} else if to, err = time.Parse(port.BacktestDateFormat, end); err != nil {
+		err = fmt.Errorf("Invalid end date: %s", end)
+	}
+	return from, to, err
+}
+
+// Replay the price history of a portfolio file, rebalancing its target
+// allocations and reporting how the portfolio would have performed
+func backtest(args []string) int {
+	flags := newFlagSet("backtest", "[portfolio file]", "Replay the daily price history of the assets in a portfolio file, rebalancing them to their target\nallocations, and report the growth rate, volatility, maximum drawdown, turnover and trades.")
+	apiFlags := newApiFlags(flags)
+	defer apiFlags.close()
+	contribution := flags.String("contribution", "", "Amount of cash deposited on the first trading day of each contribution period")
+	contributionFrequency := flags.String("contributionFrequency", port.FrequencyMonthly, "Contribution frequency: monthly or quarterly")
+	currency := flags.String("currency", "USD", "Currency")
+	end := flags.String("end", "", "Last day of the backtest (YYYY-MM-DD), or today if not provided")
+	frequency := flags.String("frequency", port.FrequencyMonthly, "Rebalance frequency: monthly, quarterly or bands (whenever an asset drifts outside of its band)")
+	initial := flags.String("initial", "", "Amount of cash deposited on the first trading day, along with the source assets")
+	output := flags.String("output", port.OutputTable, "Output format of the backtest results: json, csv or table")
+	outputFile := flags.String("outputFile", "", "File to write the output to instead of standard output")
+	start := flags.String("start", "", "First day of the backtest (YYYY-MM-DD)")
+	workers := flags.Int("workers", port.DefaultLookupWorkers, "Maximum number of concurrent stock API lookups")
+	args, exitCode, ok := parseFlags(flags, args)
+	if !ok {
+		return exitCode
+	}
+
+	opts := port.BacktestOptions{
+		Contribution:          *contribution,
+		ContributionFrequency: *contributionFrequency,
+		Frequency:             *frequency,
+		Initial:               *initial,
+	}
+
+	// Every trading day is rebalanced, so only warnings are logged by default
+	var err error
+	if len(args) > 1 {
+		return usageError(flags, "Only one portfolio file can be provided")
+	} else if opts.Start, opts.End, err = parseBacktestDates(*start, *end, time.Now()); err != nil {
+		return usageError(flags, err)
+	} else if !port.IsBacktestFrequency(*frequency) {
+		return usageError(flags, "Invalid rebalance frequency:", *frequency)
+	} else if !port.IsOutputFormat(*output) {
+		return usageError(flags, "Invalid output format:", *output)
+	} else if exitCode = apiFlags.apply(log.WarnLevel); exitCode != exitOk {
+		return exitCode
+	}
+
+	// The profile provides any settings that were not set on the command line
+	portfolio := apiFlags.profile.Portfolio
+	if len(args) > 0 {
+		portfolio = args[0]
+	}
+	if !apiFlags.isSet("currency") && len(apiFlags.profile.Currency) > 0 {
+		*currency = apiFlags.profile.Currency
+	}
+
+	if len(portfolio) == 0 {
+		return usageError(flags, "No portfolio file was provided")
+	}
+
+	stockApi, exitCode := apiFlags.newStockApi()
+	if stockApi == nil {
+		return exitCode
+	}
+	fx, exitCode := apiFlags.newFxApi(stockApi)
+	if fx == nil {
+		return exitCode
+	}
+
+	if av.IsApiAlphavantage(apiFlags.apiServer) {
+		log.Warn("Only ", av.ApiRequestsPerMinLimit, " API calls to Alpha Vantage will be performed each minute")
+	}
+
+	var p *port.Portfolio
+	var result port.BacktestResult
+	if p, err = port.NewPortfolioWithApi(portfolio, stockApi, *currency); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load portfolio:", err)
+		return getExitCode(err)
+	}
+
+	p.Context = apiFlags.getContext()
+	p.Fx = fx
+	p.Workers = *workers
+	if result, err = p.Backtest(opts); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to backtest portfolio:", err)
+		return getExitCode(err)
+	} else if err = writeBacktestResult(result, *output, *outputFile); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write output:", err)
+		return exitError
+	}
+	return exitOk
+}
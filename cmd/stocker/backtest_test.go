@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBacktestDates(t *testing.T) {
+	now := time.Date(2023, time.June, 15, 13, 30, 0, 0, time.Local)
+	from, to, err := parseBacktestDates("2020-01-01", "", now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2023, time.June, 15, 0, 0, 0, 0, time.UTC), to)
+
+	_, to, err = parseBacktestDates("2020-01-01", "2021-12-31", now)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2021, time.December, 31, 0, 0, 0, 0, time.UTC), to)
+
+	_, _, err = parseBacktestDates("", "", now)
+	assert.NotNil(t, err)
+	_, _, err = parseBacktestDates("01/01/2020", "", now)
+	assert.NotNil(t, err)
+	_, _, err = parseBacktestDates("2020-01-01", "tomorrow", now)
+	assert.NotNil(t, err)
+}
+
+func TestBacktest_Usage(t *testing.T) {
+	clearTestEnvVars(t)
+	assert.Equal(t, exitOk, backtest([]string{"-help"}))
+	assert.Equal(t, exitUsage, backtest([]string{"-unknown"}))
+	assert.Equal(t, exitUsage, backtest([]string{"-apiServer", testApiServer, "portfolio.json"}))
+	assert.Equal(t, exitUsage, backtest([]string{"-apiServer", testApiServer, "-start", "2020-01-01"}))
+	assert.Equal(t, exitUsage, backtest([]string{"-apiServer", testApiServer, "-start", "2020-01-01", "-frequency", "weekly", "portfolio.json"}))
+
+	// The example snapshot has no price history
+	assert.Equal(t, exitHistoryUnavailable, backtest([]string{"-apiServer", testApiServer, "-noCache", "-start", "2020-01-01", "../../examples/portfolio.json"}))
+}
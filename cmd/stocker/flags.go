@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shanebarnes/stocker/internal/config"
+	port "github.com/shanebarnes/stocker/internal/portfolio"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	qt "github.com/shanebarnes/stocker/internal/stock/api/questrade"
+	"github.com/shanebarnes/stocker/internal/stock/api/snapshot"
+	log "github.com/sirupsen/logrus"
+)
+
+// Flags shared by every command that uses a stock API
+type apiFlags struct {
+	apiKey       string
+	apiServer    string
+	backoff      time.Duration
+	backoffCap   time.Duration
+	cacheDir     string
+	cancel       context.CancelFunc
+	clearCache   bool
+	configFile   string
+	ctx          context.Context // Done once the timeout elapses or the command is interrupted
+	debug        bool
+	flags        *flag.FlagSet
+	fxApiKey     string
+	fxServers    string
+	jitter       float64
+	noCache      bool
+	oauthCreds   string
+	oauthRefresh bool
+	practice     bool
+	profile      config.Profile // Profile selected by -profile, after the flags are applied
+	profileName  string
+	quoteServers string
+	requests     int
+	retries      int
+	retryAfter   time.Duration
+	timeout      time.Duration
+	unredacted   bool
+}
+
+func newApiFlags(flags *flag.FlagSet) *apiFlags {
+	f := apiFlags{flags: flags}
+	flags.StringVar(&f.apiKey, "apiKey", "", "Stock API key")
+	flags.StringVar(&f.apiServer, "apiServer", "", "Stock API server, or file://<snapshot> to use a local price snapshot")
+	flags.DurationVar(&f.backoff, "backoff", api.DefaultRequestBackoffDelay, "Delay before retrying a failed stock API request, doubled after each retry")
+	flags.DurationVar(&f.backoffCap, "backoffCap", api.DefaultRequestBackoffLimit, "Maximum delay between stock API request retries")
+	flags.StringVar(&f.cacheDir, "cache", stock.DefaultCacheDir(), "Directory used to cache stock API responses between runs")
+	flags.BoolVar(&f.clearCache, "clearCache", false, "Clear cached stock API responses before running")
+	flags.StringVar(&f.configFile, "config", config.GetFilenameFromEnv(), "Config file containing named profiles")
+	flags.StringVar(&f.oauthCreds, "credentials", "", "Credentials file containing OAuth 2.0 credentials")
+	flags.BoolVar(&f.debug, "debug", false, "Debug mode")
+	flags.StringVar(&f.fxApiKey, "fxApiKey", "", "Access key of the exchange rate servers")
+	flags.StringVar(&f.fxServers, "fxServers", "", "Comma-separated exchange rate servers tried in order: exchangerate.host, exchangeratesapi.io, alphavantage.co, file://<snapshot> or fixed:<currency>/<currency>=<rate>;..., or the stock API server if not provided")
+	flags.Float64Var(&f.jitter, "jitter", api.DefaultRequestBackoffJitter, "Fraction of each retry delay that is randomized, from 0 to 1")
+	flags.BoolVar(&f.noCache, "noCache", false, "Bypass the stock API response cache and only cache responses in memory")
+	flags.BoolVar(&f.practice, "practice", false, "Refresh credentials with the Questrade practice login so that orders are placed in a practice account")
+	flags.StringVar(&f.profileName, "profile", config.GetProfileFromEnv(), "Config file profile providing the stock API, credentials, currency, rate limits and portfolio file, or the default profile if not provided")
+	flags.StringVar(&f.quoteServers, "quoteServers", "", "Comma-separated stock API servers tried in order for symbols, quotes and price history, or the stock API server if not provided")
+	flags.BoolVar(&f.oauthRefresh, "refresh", false, "Perform OAuth 2.0 refresh token exchange using OAuth credentials")
+	flags.IntVar(&f.requests, "requests", 0, "Maximum stock API requests per minute, or 0 for the stock API default. The free Alpha Vantage API key only allows for 5 API requests per minute")
+	flags.IntVar(&f.retries, "retries", api.DefaultRequestRetryLimit, "Maximum stock API request attempts")
+	flags.DurationVar(&f.retryAfter, "retryAfterCap", api.DefaultRequestRetryAfterLimit, "Maximum delay requested by a stock API server with Retry-After or X-RateLimit-Reset that is waited for before a retry")
+	flags.DurationVar(&f.timeout, "timeout", 0, "Maximum time to run the command for, including stock API retries and request limit delays, or 0 for no limit")
+	flags.BoolVar(&f.unredacted, "unredacted", false, "Log API keys and tokens in debug request and response dumps instead of redacting them, for local troubleshooting only")
+	return &f
+}
+
+// Returns true if a flag was set on the command line
+func (f *apiFlags) isSet(name string) bool {
+	set := false
+	f.flags.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// Returns the value of a setting from a flag, then an environment variable,
+// then a profile, in order of precedence
+func (f *apiFlags) getString(name, flagVal, envVal, profileVal string) string {
+	if f.isSet(name) {
+		return flagVal
+	} else if len(envVal) > 0 {
+		return envVal
+	}
+	return profileVal
+}
+
+// Load the profile selected by -profile. The config file is only required if
+// it was set with -config.
+func (f *apiFlags) loadProfile() error {
+	cfg, err := config.Load(f.configFile, f.isSet("config"))
+	if err == nil {
+		f.profile, err = cfg.GetProfile(f.profileName)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("%w: config file %s: %w", port.ErrInvalidFile, f.configFile, err)
+	}
+	return err
+}
+
+// Configure logging and the stock API from the parsed flags, environment
+// variables and profile, in order of precedence. Returns the exit code if the
+// command cannot be run.
+func (f *apiFlags) apply(level log.Level) int {
+	log.SetLevel(level)
+	if f.debug {
+		log.SetLevel(log.DebugLevel)
+	}
+	api.LogUnredacted = f.unredacted
+	if f.unredacted {
+		log.Warn("Logging secrets unredacted")
+	}
+
+	if err := f.loadProfile(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return getExitCode(err)
+	}
+
+	f.apiKey = f.getString("apiKey", f.apiKey, apiKey, f.profile.ApiKey)
+	f.apiServer = f.getString("apiServer", f.apiServer, apiServer, f.profile.ApiServer)
+	f.oauthCreds = f.getString("credentials", f.oauthCreds, "", f.profile.Credentials)
+	f.fxApiKey = f.getString("fxApiKey", f.fxApiKey, fxApiKey, f.profile.FxApiKey)
+	f.fxServers = f.getString("fxServers", f.fxServers, "", strings.Join(f.profile.FxServers, ","))
+	f.quoteServers = f.getString("quoteServers", f.quoteServers, "", strings.Join(f.profile.QuoteServers, ","))
+	if !f.isSet("backoff") && f.profile.Backoff > 0 {
+		f.backoff = f.profile.Backoff
+	}
+	if !f.isSet("backoffCap") && f.profile.BackoffCap > 0 {
+		f.backoffCap = f.profile.BackoffCap
+	}
+	if !f.isSet("requests") && f.profile.Requests > 0 {
+		f.requests = f.profile.Requests
+	}
+	if !f.isSet("retries") && f.profile.Retries > 0 {
+		f.retries = f.profile.Retries
+	}
+	if !f.isSet("retryAfterCap") && f.profile.RetryAfterCap > 0 {
+		f.retryAfter = f.profile.RetryAfterCap
+	}
+
+	// Every provider of the fallback chains shares the rate limit and retry
+	// policy
+	policy := api.RetryPolicy{
+		BackoffCap:    f.backoffCap,
+		BackoffDelay:  f.backoff,
+		Jitter:        f.jitter,
+		Limit:         f.retries,
+		RetryAfterCap: f.retryAfter,
+	}
+	servers := append([]string{f.apiServer}, splitServers(f.quoteServers)...)
+	for _, server := range append(servers, splitServers(f.fxServers)...) {
+		configureApi(server, f.requests, policy)
+	}
+
+	qt.UsePracticeAccounts(f.practice)
+
+	if f.noCache {
+		f.cacheDir = ""
+	}
+
+	if len(f.apiServer) == 0 {
+		return usageError(f.flags, "No API server was provided")
+	} else if len(f.apiKey) == 0 && len(f.oauthCreds) == 0 && !snapshot.IsApiSnapshot(f.apiServer) {
+		return usageError(f.flags, "No API key or credentials file was provided")
+	} else if f.timeout < 0 {
+		return usageError(f.flags, "Invalid timeout:", f.timeout)
+	}
+
+	f.startContext()
+	return exitOk
+}
+
+// Start the context of stock API requests, which is done once the timeout
+// elapses or the command is interrupted. A second interrupt stops the command
+// immediately.
+func (f *apiFlags) startContext() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	f.ctx, f.cancel = ctx, stop
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		f.ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		f.cancel = func() {
+			cancel()
+			stop()
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+}
+
+// Returns the context of stock API requests
+func (f *apiFlags) getContext() context.Context {
+	if f.ctx != nil {
+		return f.ctx
+	}
+	return context.Background()
+}
+
+// Stop the timeout and interrupt handling once the command is done
+func (f *apiFlags) close() {
+	if f.cancel != nil {
+		f.cancel()
+	}
+}
+
+// Clear the cache directory if requested
+func (f *apiFlags) clearCacheDir() int {
+	if f.clearCache {
+		return clearCacheDir(f.cacheDir)
+	}
+	return exitOk
+}
+
+// Clear the cache directory if requested, then create the stock API
+func (f *apiFlags) newStockApi() (api.StockApi, int) {
+	if exitCode := f.clearCacheDir(); exitCode != exitOk {
+		return nil, exitCode
+	}
+
+	stockApi, err := port.NewFallbackStockApiContext(f.getContext(), f.apiKey, f.apiServer, splitServers(f.quoteServers), f.oauthCreds, f.oauthRefresh, f.cacheDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to create stock API:", err)
+		return nil, getExitCode(err)
+	}
+	return stockApi, exitOk
+}
+
+// Create the exchange rate API, which is the stock API if no exchange rate
+// servers were provided
+func (f *apiFlags) newFxApi(stockApi api.StockApi) (api.FxApi, int) {
+	fx, err := port.NewFxApi(stockApi, f.apiKey, f.apiServer, f.fxApiKey, splitServers(f.fxServers), f.cacheDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to create exchange rate API:", err)
+		return nil, getExitCode(err)
+	}
+	return fx, exitOk
+}
+
+// Returns the servers of a comma-separated list
+func splitServers(servers string) []string {
+	list := []string{}
+	for _, server := range strings.Split(servers, ",") {
+		if server = strings.TrimSpace(server); len(server) > 0 {
+			list = append(list, server)
+		}
+	}
+	return list
+}
+
+// Returns a flag set for a command that prints its usage, description and
+// flags on request or when a flag is invalid
+func newFlagSet(name, args, description string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		w := flags.Output()
+		fmt.Fprintf(w, "Usage: stocker %s [flags] %s\n\n%s\n\nFlags:\n", name, args, description)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// Parse the flags of a command, which may be mixed with its arguments.
+// Returns the arguments and the exit code to use if parsing failed or help
+// was requested.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, int, bool) {
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+			return nil, exitOk, false
+		} else if err != nil {
+			return nil, exitUsage, false
+		}
+
+		// Everything after a "--" terminator is an argument
+		parsed := len(args) - flags.NArg()
+		if parsed > 0 && args[parsed-1] == "--" {
+			positional = append(positional, flags.Args()...)
+			break
+		}
+
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return positional, exitOk, true
+}
+
+// Print an invalid usage message along with the usage of a command
+func usageError(flags *flag.FlagSet, a ...interface{}) int {
+	fmt.Fprintln(flags.Output(), a...)
+	flags.Usage()
+	return exitUsage
+}
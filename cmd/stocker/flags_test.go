@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shanebarnes/stocker/internal/config"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `defaultProfile: snapshot
+profiles:
+  snapshot:
+    apiServer: file://../../examples/prices.csv
+    currency: CAD
+    portfolio: %s
+    requests: 30
+    retries: 2
+  questrade:
+    apiServer: api01.iq.questrade.com
+    account: "12345678"
+    backoff: 2s
+    credentials: credentials.json
+`
+
+// Write a config file for a test and use it instead of the user's config file
+func writeTestConfig(t *testing.T) string {
+	clearTestEnvVars(t)
+	portfolio, err := filepath.Abs("../../examples/portfolio.json")
+	assert.Nil(t, err)
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(filename, []byte(fmt.Sprintf(testConfig, portfolio)), 0600))
+	t.Setenv(config.ConfigEnvName, filename)
+	return filename
+}
+
+func parseTestApiFlags(t *testing.T, args ...string) (*apiFlags, int) {
+	flags := newFlagSet("test", "", "Test command.")
+	f := newApiFlags(flags)
+	_, exitCode, ok := parseFlags(flags, args)
+	assert.True(t, ok)
+	assert.Equal(t, exitOk, exitCode)
+	return f, f.apply(log.WarnLevel)
+}
+
+func TestApiFlags_Apply_Profile(t *testing.T) {
+	filename := writeTestConfig(t)
+
+	// The default profile is used if no profile is provided
+	f, exitCode := parseTestApiFlags(t)
+	assert.Equal(t, exitOk, exitCode)
+	assert.Equal(t, testApiServer, f.apiServer)
+	assert.Equal(t, "CAD", f.profile.Currency)
+	assert.Equal(t, 30, f.requests)
+	assert.Equal(t, 2, f.retries)
+
+	f, exitCode = parseTestApiFlags(t, "-profile", "questrade", "-retries", "5")
+	assert.Equal(t, exitOk, exitCode)
+	assert.Equal(t, "api01.iq.questrade.com", f.apiServer)
+	assert.Equal(t, "12345678", f.profile.Account)
+	assert.Equal(t, 2*time.Second, f.backoff)
+	assert.Equal(t, filepath.Join(filepath.Dir(filename), "credentials.json"), f.oauthCreds)
+	assert.Equal(t, 5, f.retries)
+
+	t.Setenv(config.ProfileEnvName, "questrade")
+	f, exitCode = parseTestApiFlags(t)
+	assert.Equal(t, exitOk, exitCode)
+	assert.Equal(t, "api01.iq.questrade.com", f.apiServer)
+
+	_, exitCode = parseTestApiFlags(t, "-profile", "missing")
+	assert.Equal(t, exitInvalidFile, exitCode)
+}
+
+func TestApiFlags_Apply_Precedence(t *testing.T) {
+	writeTestConfig(t)
+
+	// Environment variables take precedence over the profile
+	apiKey, apiServer = "envKey", "alphavantage.co"
+	f, exitCode := parseTestApiFlags(t)
+	assert.Equal(t, exitOk, exitCode)
+	assert.Equal(t, "envKey", f.apiKey)
+	assert.Equal(t, "alphavantage.co", f.apiServer)
+
+	// Flags take precedence over environment variables
+	f, exitCode = parseTestApiFlags(t, "-apiKey", "flagKey", "-apiServer", testApiServer)
+	assert.Equal(t, exitOk, exitCode)
+	assert.Equal(t, "flagKey", f.apiKey)
+	assert.Equal(t, testApiServer, f.apiServer)
+}
+
+func TestApiFlags_Apply_Config(t *testing.T) {
+	clearTestEnvVars(t)
+
+	// The config file is optional unless it is provided
+	_, exitCode := parseTestApiFlags(t, "-apiServer", testApiServer)
+	assert.Equal(t, exitOk, exitCode)
+
+	_, exitCode = parseTestApiFlags(t, "-apiServer", testApiServer, "-config", filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Equal(t, exitInvalidFile, exitCode)
+
+	_, exitCode = parseTestApiFlags(t)
+	assert.Equal(t, exitUsage, exitCode)
+}
+
+func TestApiFlags_Apply_Unredacted(t *testing.T) {
+	clearTestEnvVars(t)
+	defer func() { api.LogUnredacted = false }()
+
+	_, exitCode := parseTestApiFlags(t, "-apiServer", testApiServer, "-unredacted")
+	assert.Equal(t, exitOk, exitCode)
+	assert.True(t, api.LogUnredacted)
+
+	_, exitCode = parseTestApiFlags(t, "-apiServer", testApiServer)
+	assert.Equal(t, exitOk, exitCode)
+	assert.False(t, api.LogUnredacted)
+}
+
+func TestApiFlags_Apply_Timeout(t *testing.T) {
+	clearTestEnvVars(t)
+
+	f, exitCode := parseTestApiFlags(t, "-apiServer", testApiServer, "-timeout", "1m")
+	assert.Equal(t, exitOk, exitCode)
+	deadline, ok := f.getContext().Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 10*time.Second)
+	assert.Nil(t, f.getContext().Err())
+	f.close()
+	assert.NotNil(t, f.getContext().Err())
+
+	// There is no deadline by default
+	f, exitCode = parseTestApiFlags(t, "-apiServer", testApiServer)
+	assert.Equal(t, exitOk, exitCode)
+	_, ok = f.getContext().Deadline()
+	assert.False(t, ok)
+	f.close()
+
+	_, exitCode = parseTestApiFlags(t, "-apiServer", testApiServer, "-timeout", "-1s")
+	assert.Equal(t, exitUsage, exitCode)
+}
+
+func TestRebalance_Profile(t *testing.T) {
+	writeTestConfig(t)
+	outputFile := filepath.Join(t.TempDir(), "orders.json")
+
+	// The profile provides the portfolio file
+	assert.Equal(t, exitOk, run([]string{"rebalance", "-noCache", "-output", "json", "-outputFile", outputFile}))
+	output, err := os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.Contains(t, string(output), "CAD")
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	port "github.com/shanebarnes/stocker/internal/portfolio"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// Flags and stock API shared by the quote, search and fx commands
+type lookupCommand struct {
+	api        *apiFlags
+	flags      *flag.FlagSet
+	output     *string
+	outputFile *string
+}
+
+func newLookupCommand(name, args, description string) *lookupCommand {
+	c := lookupCommand{flags: newFlagSet(name, args, description)}
+	c.api = newApiFlags(c.flags)
+	c.output = c.flags.String("output", port.OutputTable, "Output format: json, csv or table")
+	c.outputFile = c.flags.String("outputFile", "", "File to write the output to instead of standard output")
+	return &c
+}
+
+// Parse the command line and create the stock API. Returns the arguments, or
+// the exit code if the command cannot be run.
+func (c *lookupCommand) parse(args []string, minArgs int) ([]string, api.StockApi, int) {
+	args, exitCode, ok := parseFlags(c.flags, args)
+	if !ok {
+		return nil, nil, exitCode
+	}
+
+	if !port.IsOutputFormat(*c.output) {
+		return nil, nil, usageError(c.flags, "Invalid output format:", *c.output)
+	} else if len(args) < minArgs {
+		return nil, nil, usageError(c.flags, "Missing arguments")
+	}
+
+	// Only warnings are logged so that the output is easy to read
+	if exitCode = c.api.apply(log.WarnLevel); exitCode != exitOk {
+		return nil, nil, exitCode
+	}
+
+	stockApi, exitCode := c.api.newStockApi()
+	return args, stockApi, exitCode
+}
+
+// Write the rows that were looked up, even if some lookups failed
+func (c *lookupCommand) write(columns []string, rows [][]string, exitCode int) int {
+	err := writeOutput(*c.outputFile, func(w io.Writer) error {
+		return writeRows(w, columns, rows, *c.output)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write output:", err)
+		exitCode = exitError
+	}
+	return exitCode
+}
+
+// Print a failed lookup, keeping the exit code of the first failure
+func lookupFailed(exitCode int, err error) int {
+	fmt.Fprintln(os.Stderr, err)
+	if exitCode == exitOk {
+		exitCode = getExitCode(err)
+	}
+	return exitCode
+}
+
+func formatPrice(price float64, places int) string {
+	return strconv.FormatFloat(price, 'f', places, 64)
+}
+
+// Look up the latest quotes of symbols
+func quote(args []string) int {
+	c := newLookupCommand("quote", "<symbol>...", "Look up the latest quotes of symbols.")
+	defer c.api.close()
+	args, stockApi, exitCode := c.parse(args, 1)
+	if stockApi == nil {
+		return exitCode
+	}
+
+	rows := [][]string{}
+	for _, symbol := range args {
+		symbol = strings.ToUpper(symbol)
+		if qte, err := api.NewStockApiContext(stockApi).GetQuoteContext(c.api.getContext(), symbol); err != nil {
+			exitCode = lookupFailed(exitCode, fmt.Errorf("%w: %s: %w", port.ErrUnknownSymbol, symbol, err))
+		} else {
+			rows = append(rows, []string{
+				qte.Symbol,
+				formatPrice(qte.Prices.Latest, 2),
+				formatPrice(qte.Prices.Open, 2),
+				formatPrice(qte.Prices.High, 2),
+				formatPrice(qte.Prices.Low, 2),
+				formatPrice(qte.Prices.Close, 2),
+				qte.Volume,
+			})
+		}
+	}
+	return c.write([]string{"symbol", "latest", "open", "high", "low", "close", "volume"}, rows, exitCode)
+}
+
+// Search for the best matching symbol of each keyword
+func search(args []string) int {
+	c := newLookupCommand("search", "<keyword>...", "Search for the symbol that best matches each keyword.")
+	defer c.api.close()
+	args, stockApi, exitCode := c.parse(args, 1)
+	if stockApi == nil {
+		return exitCode
+	}
+
+	rows := [][]string{}
+	for _, keyword := range args {
+		if sym, err := api.NewStockApiContext(stockApi).GetSymbolContext(c.api.getContext(), keyword); err != nil {
+			exitCode = lookupFailed(exitCode, fmt.Errorf("%w: %s: %w", port.ErrUnknownSymbol, keyword, err))
+		} else {
+			rows = append(rows, []string{sym.Symbol, sym.Description, sym.Type, sym.Currency})
+		}
+	}
+	return c.write([]string{"symbol", "description", "type", "currency"}, rows, exitCode)
+}
+
+// Look up the exchange rates from one currency to other currencies
+func fx(args []string) int {
+	c := newLookupCommand("fx", "<currency> <currency>...", "Look up the exchange rates from the first currency to each of the other currencies.")
+	defer c.api.close()
+	args, stockApi, exitCode := c.parse(args, 2)
+	if stockApi == nil {
+		return exitCode
+	}
+	fxApi, exitCode := c.api.newFxApi(stockApi)
+	if fxApi == nil {
+		return exitCode
+	}
+
+	rows := [][]string{}
+	from := strings.ToUpper(args[0])
+	for _, to := range args[1:] {
+		to = strings.ToUpper(to)
+		if ccy, err := api.NewFxApiContext(fxApi).GetCurrencyContext(c.api.getContext(), from, to); err != nil {
+			exitCode = lookupFailed(exitCode, fmt.Errorf("%w: %s to %s: %w", port.ErrFxUnavailable, from, to, err))
+		} else if rate, exists := ccy.Rates[to]; !exists {
+			exitCode = lookupFailed(exitCode, fmt.Errorf("%w: %s to %s", port.ErrFxUnavailable, from, to))
+		} else {
+			rows = append(rows, []string{from, to, rate.Round(4).StringN(4)})
+		}
+	}
+	return c.write([]string{"from", "to", "rate"}, rows, exitCode)
+}
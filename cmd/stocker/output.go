@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	port "github.com/shanebarnes/stocker/internal/portfolio"
+)
+
+// Write output to a file, or to standard output if no file is provided
+func writeOutput(outputFile string, write func(w io.Writer) error) error {
+	var err error
+	w := os.Stdout
+	if len(outputFile) > 0 {
+		if w, err = os.Create(outputFile); err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+	return write(w)
+}
+
+func writeReport(report port.Report, output, outputFile string) error {
+	return writeOutput(outputFile, func(w io.Writer) error {
+		return port.WriteReport(w, report, output)
+	})
+}
+
+func writeBacktestResult(result port.BacktestResult, output, outputFile string) error {
+	return writeOutput(outputFile, func(w io.Writer) error {
+		return port.WriteBacktestResult(w, result, output)
+	})
+}
+
+// Write the rows of a lookup as a json array of objects keyed by column, as
+// csv, or as a table
+func writeRows(w io.Writer, columns []string, rows [][]string, format string) error {
+	var err error
+	switch format {
+	case port.OutputCsv:
+		cw := csv.NewWriter(w)
+		cw.Write(columns)
+		cw.WriteAll(rows)
+		err = cw.Error()
+	case port.OutputJson:
+		objects := []map[string]string{}
+		for _, row := range rows {
+			object := make(map[string]string)
+			for i, column := range columns {
+				object[column] = row[i]
+			}
+			objects = append(objects, object)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(objects)
+	case port.OutputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t"))+"\t")
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+		}
+		err = tw.Flush()
+	default:
+		err = fmt.Errorf("Invalid output format: %s", format)
+	}
+	return err
+}
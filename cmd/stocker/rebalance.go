@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	port "github.com/shanebarnes/stocker/internal/portfolio"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	av "github.com/shanebarnes/stocker/internal/stock/api/alphavantage"
+	"github.com/shanebarnes/stocker/internal/stock/api/snapshot"
+	log "github.com/sirupsen/logrus"
+)
+
+// Options of a rebalance that are not needed to create its stock API
+type rebalanceOptions struct {
+	account      string
+	bands        bool
+	confirm      bool
+	contribution string
+	currency     string
+	execute      bool
+	orderType    string
+	output       string
+	outputFile   string
+	snapshotFile string
+	workers      int
+}
+
+// Preview the orders of a portfolio in a brokerage account, only placing the
+// orders once they have been confirmed
+func executeOrders(p *port.Portfolio, account, orderType string, confirm bool) int {
+	exitCode := 0
+	if err := p.ExecuteOrders(account, orderType, confirm); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to execute orders:", err)
+		exitCode = getExitCode(err)
+	} else if !confirm {
+		log.Warn("Orders were previewed but not placed, use -confirm to place them")
+	}
+	return exitCode
+}
+
+func rebalancePortfolio(ctx context.Context, portfolio string, stockApi api.StockApi, fx api.FxApi, opts rebalanceOptions) int {
+	exitCode := 0
+	if p, err := port.NewPortfolioWithApi(portfolio, stockApi, opts.currency); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load portfolio:", err)
+		exitCode = getExitCode(err)
+	} else {
+		p.Context = ctx
+		p.Fx = fx
+		p.UseBands = opts.bands
+		p.Workers = opts.workers
+		if len(opts.account) > 0 {
+			err = p.SyncAccount(opts.account)
+		}
+
+		// Orders are executed with the stock API rather than the recorder
+		var recorder *snapshot.Recorder
+		if len(opts.snapshotFile) > 0 {
+			recorder = snapshot.NewRecorder(p.Api)
+			recorder.RecordFx(p.Fx)
+			p.Api = recorder
+			p.Fx = recorder
+		}
+
+		if err != nil {
+			err = fmt.Errorf("Account synchronization failed: %w", err)
+		} else if len(opts.contribution) > 0 {
+			err = p.Contribute(opts.contribution)
+		} else {
+			err = p.Rebalance()
+		}
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to rebalance portfolio:", err)
+			exitCode = getExitCode(err)
+		} else {
+			if opts.execute {
+				p.Api = stockApi
+				exitCode = executeOrders(p, opts.account, opts.orderType, opts.confirm)
+			}
+
+			// The IDs of placed orders are reported even if a later order is
+			// rejected
+			if err = writeReport(p.GetReport(), opts.output, opts.outputFile); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to write output:", err)
+				exitCode = exitError
+			}
+		}
+
+		if recorder != nil {
+			if err = recorder.WriteFile(opts.snapshotFile); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to save snapshot file:", err)
+				exitCode = exitError
+			}
+		}
+	}
+	return exitCode
+}
+
+// Rebalance the source assets of a portfolio file against its target assets
+func rebalance(args []string) int {
+	flags := newFlagSet("rebalance", "[portfolio file]", "Rebalance the source assets of a portfolio file against its target assets, or only invest a deposit\nor raise a withdrawal. The portfolio file of the profile is used if none is provided.")
+	apiFlags := newApiFlags(flags)
+	defer apiFlags.close()
+	opts := rebalanceOptions{}
+	flags.StringVar(&opts.account, "account", "", "Brokerage account number used as the source assets instead of the portfolio file (Questrade only)")
+	flags.BoolVar(&opts.bands, "bands", false, "Only rebalance assets that have drifted outside of their band")
+	flags.BoolVar(&opts.confirm, "confirm", false, "Place the orders previewed by -execute")
+	flags.StringVar(&opts.currency, "currency", "USD", "Currency")
+	deposit := flags.String("deposit", "", "Amount of cash to invest by only buying underweight assets instead of rebalancing")
+	flags.BoolVar(&opts.execute, "execute", false, "Preview the orders in the brokerage account given by -account, calculating their commissions and buying power effect (Questrade only)")
+	flags.StringVar(&opts.orderType, "orderType", port.OrderTypeLimit, "Type of orders placed by -execute: limit (at the quoted price) or market")
+	flags.StringVar(&opts.output, "output", port.OutputTable, "Output format of the source holdings, target holdings and orders: json, csv or table")
+	flags.StringVar(&opts.outputFile, "outputFile", "", "File to write the output to instead of standard output")
+	flags.StringVar(&opts.snapshotFile, "snapshot", "", "Snapshot file to save the prices and exchange rates used by a rebalance")
+	withdraw := flags.String("withdraw", "", "Amount of cash to raise by only selling overweight assets instead of rebalancing")
+	flags.IntVar(&opts.workers, "workers", port.DefaultLookupWorkers, "Maximum number of concurrent stock API lookups")
+	args, exitCode, ok := parseFlags(flags, args)
+	if !ok {
+		return exitCode
+	}
+
+	opts.contribution = *deposit
+	if len(*withdraw) > 0 {
+		opts.contribution = "-" + strings.TrimPrefix(*withdraw, "-")
+	}
+
+	if len(args) > 1 {
+		return usageError(flags, "Only one portfolio file can be provided")
+	} else if len(*deposit) > 0 && len(*withdraw) > 0 {
+		return usageError(flags, "Only one of a deposit or withdrawal can be provided")
+	} else if !port.IsOrderType(opts.orderType) {
+		return usageError(flags, "Invalid order type:", opts.orderType)
+	} else if !port.IsOutputFormat(opts.output) {
+		return usageError(flags, "Invalid output format:", opts.output)
+	} else if exitCode = apiFlags.apply(log.InfoLevel); exitCode != exitOk {
+		return exitCode
+	}
+
+	// The profile provides any settings that were not set on the command line
+	portfolio := apiFlags.profile.Portfolio
+	if len(args) > 0 {
+		portfolio = args[0]
+	}
+	if !apiFlags.isSet("account") && len(apiFlags.profile.Account) > 0 {
+		opts.account = apiFlags.profile.Account
+	}
+	if !apiFlags.isSet("currency") && len(apiFlags.profile.Currency) > 0 {
+		opts.currency = apiFlags.profile.Currency
+	}
+
+	if len(portfolio) == 0 {
+		return usageError(flags, "No portfolio file was provided")
+	} else if opts.execute && len(opts.account) == 0 {
+		return usageError(flags, "Executing orders requires an account")
+	} else if opts.confirm && !opts.execute {
+		return usageError(flags, "Only executed orders can be confirmed")
+	}
+
+	stockApi, exitCode := apiFlags.newStockApi()
+	if stockApi == nil {
+		return exitCode
+	}
+	fx, exitCode := apiFlags.newFxApi(stockApi)
+	if fx == nil {
+		return exitCode
+	}
+
+	if !snapshot.IsApiSnapshot(apiFlags.apiServer) {
+		log.Warn("Rebalancing requires making stock API calls")
+	}
+	if av.IsApiAlphavantage(apiFlags.apiServer) {
+		log.Warn("Only ", av.ApiRequestsPerMinLimit, " API calls to Alpha Vantage will be performed each minute")
+	}
+	return rebalancePortfolio(apiFlags.getContext(), portfolio, stockApi, fx, opts)
+}
@@ -1,20 +1,49 @@
 package main
 
 import (
-	"flag"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"text/tabwriter"
 
 	port "github.com/shanebarnes/stocker/internal/portfolio"
+	"github.com/shanebarnes/stocker/internal/stock"
 	"github.com/shanebarnes/stocker/internal/stock/api"
+	av "github.com/shanebarnes/stocker/internal/stock/api/alphavantage"
+	"github.com/shanebarnes/stocker/internal/stock/api/exchangerate"
+	"github.com/shanebarnes/stocker/internal/stock/api/exchangeratesapi"
+	qt "github.com/shanebarnes/stocker/internal/stock/api/questrade"
 	ver "github.com/shanebarnes/stocker/internal/version"
 	log "github.com/sirupsen/logrus"
 )
 
+// Exit codes
+const (
+	exitOk = iota
+	exitError
+	exitUsage // Invalid command, flag or argument
+	exitInvalidFile
+	exitInvalidValue
+	exitUnknownSymbol
+	exitFxUnavailable
+	exitInvalidAllocation
+	exitInsufficientFunds
+	exitInvalidCredentials
+	exitAccountUnavailable
+	exitOrderRejected
+	exitHistoryUnavailable
+	exitTimeout     // The -timeout elapsed
+	exitInterrupted // The command was interrupted
+)
+
 var (
 	apiKey    string
 	apiServer string
 	authToken string
+	fxApiKey  string
 )
 
 func init() {
@@ -23,7 +52,7 @@ func init() {
 	format.FullTimestamp = true
 
 	log.SetFormatter(format)
-	log.SetOutput(os.Stdout)
+	log.SetOutput(os.Stderr)
 	log.SetLevel(log.InfoLevel)
 
 	initEnvVars()
@@ -32,55 +61,156 @@ func init() {
 func initEnvVars() {
 	apiKey = api.GetApiKeyFromEnv()
 	apiServer = api.GetApiServerFromEnv()
+	fxApiKey = api.GetFxApiKeyFromEnv()
 }
 
-func main() {
-	key := flag.String("apiKey", "", "Stock API key")
-	server := flag.String("apiServer", "", "Stock API server")
-	oauthCreds := flag.String("credentials", "", "Credentials file containing OAuth 2.0 credentials")
-	currency := flag.String("currency", "USD", "Currency")
-	debug := flag.Bool("debug", false, "Debug mode")
-	//requests := flag.Int("requests", 5, "Maximum API requests per minute. The free API key only allows for 5 API requests per minute")
-	help := flag.Bool("help", false, "Display help information")
-	portfolio := flag.String("rebalance", "", "Portfolio file containing source assets to rebalance against target assets")
-	oauthRefresh := flag.Bool("refresh", false, "Perform OAuth 2.0 refresh token exchange using OAuth credentials")
-	version := flag.Bool("version", false, "Display version information")
-	flag.Parse()
-
-	if len(apiKey) == 0 {
-		apiKey = *key
+// Returns the exit code of a portfolio error
+func getExitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOk
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, port.ErrInvalidFile):
+		return exitInvalidFile
+	case errors.Is(err, port.ErrInvalidValue):
+		return exitInvalidValue
+	case errors.Is(err, port.ErrUnknownSymbol):
+		return exitUnknownSymbol
+	case errors.Is(err, port.ErrFxUnavailable):
+		return exitFxUnavailable
+	case errors.Is(err, port.ErrInvalidAllocation):
+		return exitInvalidAllocation
+	case errors.Is(err, port.ErrInsufficientFunds):
+		return exitInsufficientFunds
+	case errors.Is(err, port.ErrInvalidCredentials):
+		return exitInvalidCredentials
+	case errors.Is(err, port.ErrAccountUnavailable):
+		return exitAccountUnavailable
+	case errors.Is(err, port.ErrOrderRejected):
+		return exitOrderRejected
+	case errors.Is(err, port.ErrHistoryUnavailable):
+		return exitHistoryUnavailable
 	}
+	return exitError
+}
 
-	if len(apiServer) == 0 {
-		apiServer = *server
+// Set the request rate limit and retry policy of a stock API or exchange rate
+// server. A rate limit of zero keeps the stock API default, and exchange rate
+// servers have no rate limit.
+func configureApi(server string, requests int, policy api.RetryPolicy) {
+	if av.IsApiAlphavantage(server) {
+		if requests > 0 {
+			av.ApiRequestsPerMinLimit = requests
+		}
+		av.ApiRetryPolicy = policy
+	} else if qt.IsApiQuestrade(server) {
+		if requests > 0 {
+			qt.ApiRequestsPerMinLimit = requests
+		}
+		qt.ApiRetryPolicy = policy
+	} else if exchangerate.IsApiExchangerate(server) {
+		exchangerate.ApiRetryPolicy = policy
+	} else if exchangeratesapi.IsApiExchangeratesapi(server) {
+		exchangeratesapi.ApiRetryPolicy = policy
 	}
+}
 
-	if *debug {
-		log.SetLevel(log.DebugLevel)
+func clearCacheDir(dir string) int {
+	if len(dir) > 0 {
+		if err := stock.ClearCacheDir(dir); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to clear cache directory:", err)
+			return exitError
+		}
 	}
+	return exitOk
+}
 
-	//av.ApiRequestsPerMinLimit = *requests
-
-	exitCode := 0
-	if *help {
-		flag.PrintDefaults()
-	} else if *version {
-		fmt.Println("stocker version", ver.String())
-	} else if len(apiServer) == 0 {
-		fmt.Fprintln(os.Stderr, "No API server was provided")
-		exitCode = 1
-	} else if len(apiKey) == 0 && len(*oauthCreds) == 0 {
-		fmt.Fprintln(os.Stderr, "No API key or credentials file was provided")
-		exitCode = 1
-	} else if len(*portfolio) > 0 {
-		log.Warn("Rebalancing requires making stock API calls")
-		//log.Warn("Only ", av.ApiRequestsPerMinLimit, " API calls to Alpha Vantage will be performed each minute")
-		if p, err := port.NewPortfolio(*portfolio, apiKey, apiServer, *oauthCreds, *oauthRefresh, *currency); err == nil {
-			p.Rebalance()
+// A command of the stocker app, which parses its own flags and arguments and
+// returns an exit code
+type command struct {
+	name    string
+	run     func(args []string) int
+	summary string
+}
+
+var commands = []command{
+	{"auth", auth, "Refresh OAuth 2.0 credentials (auth refresh)"},
+	{"backtest", backtest, "Replay the price history of a portfolio file and report its performance"},
+	{"fx", fx, "Look up exchange rates from one currency to other currencies"},
+	{"quote", quote, "Look up the latest quotes of symbols"},
+	{"rebalance", rebalance, "Rebalance a portfolio file, or invest a deposit or raise a withdrawal"},
+	{"search", search, "Search for the symbol that best matches each keyword"},
+	{"version", printVersion, "Display version information"},
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
 		}
+	}
+	return nil
+}
+
+func printVersion(args []string) int {
+	fmt.Println("stocker version", ver.String())
+	return exitOk
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, "Usage: stocker <command> [flags] [arguments]\n\nCommands:\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprint(w, "\nRun \"stocker help <command>\" for the flags of a command.\n")
+}
+
+// Run the command named by the first argument
+func run(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return exitUsage
+	}
+
+	name := args[0]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			if c := findCommand(args[1]); c != nil {
+				return c.run([]string{"-help"})
+			}
+		}
+		usage(os.Stdout)
+		return exitOk
+	case "-version", "--version":
+		name = "version"
+	}
+
+	if c := findCommand(name); c != nil {
+		return c.run(args[1:])
+	}
+
+	for _, arg := range args {
+		if arg == "-rebalance" || arg == "--rebalance" || strings.HasPrefix(arg, "-rebalance=") {
+			fmt.Fprintln(os.Stderr, "The -rebalance flag has been replaced by the rebalance command: stocker rebalance [flags] <portfolio file>")
+			return exitUsage
+		}
+	}
+
+	if strings.HasPrefix(name, "-") {
+		fmt.Fprintln(os.Stderr, "Flags must follow a command:", name)
 	} else {
-		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "Unknown command:", name)
 	}
+	usage(os.Stderr)
+	return exitUsage
+}
 
-	os.Exit(exitCode)
+func main() {
+	os.Exit(run(os.Args[1:]))
 }
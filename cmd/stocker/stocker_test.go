@@ -1,10 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/shanebarnes/stocker/internal/config"
+	port "github.com/shanebarnes/stocker/internal/portfolio"
 	"github.com/shanebarnes/stocker/internal/stock/api"
+	av "github.com/shanebarnes/stocker/internal/stock/api/alphavantage"
+	"github.com/shanebarnes/stocker/internal/stock/api/exchangerate"
+	"github.com/shanebarnes/stocker/internal/stock/api/exchangeratesapi"
+	qt "github.com/shanebarnes/stocker/internal/stock/api/questrade"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,20 +25,246 @@ func TestInitEnvVars(t *testing.T) {
 	// Save current environment variables before modifying
 	saveKey := api.GetApiKeyFromEnv()
 	saveServer := api.GetApiServerFromEnv()
+	saveFxKey := api.GetFxApiKeyFromEnv()
 
 	// Restore original environment variable values after tests
 	defer os.Setenv(api.ApiKeyEnvName, saveKey)
 	defer os.Setenv(api.ApiServerEnvName, saveServer)
+	defer os.Setenv(api.FxApiKeyEnvName, saveFxKey)
 
 	os.Setenv(api.ApiKeyEnvName, "")
 	os.Setenv(api.ApiServerEnvName, "")
+	os.Setenv(api.FxApiKeyEnvName, "")
 	initEnvVars()
 	assert.Equal(t, "", apiKey)
 	assert.Equal(t, "", apiServer)
+	assert.Equal(t, "", fxApiKey)
 
 	os.Setenv(api.ApiKeyEnvName, "SomeApiKey")
 	os.Setenv(api.ApiServerEnvName, "SomeApiServer")
+	os.Setenv(api.FxApiKeyEnvName, "SomeFxApiKey")
 	initEnvVars()
 	assert.Equal(t, "SomeApiKey", apiKey)
 	assert.Equal(t, "SomeApiServer", apiServer)
-}
\ No newline at end of file
+	assert.Equal(t, "SomeFxApiKey", fxApiKey)
+}
+func TestGetExitCode(t *testing.T) {
+	assert.Equal(t, exitOk, getExitCode(nil))
+	assert.Equal(t, exitError, getExitCode(errors.New("error")))
+	assert.Equal(t, exitInvalidFile, getExitCode(fmt.Errorf("%w: portfolio.json", port.ErrInvalidFile)))
+	assert.Equal(t, exitInvalidValue, getExitCode(fmt.Errorf("%w: qty", port.ErrInvalidValue)))
+	assert.Equal(t, exitUnknownSymbol, getExitCode(fmt.Errorf("Validation failed: %w", fmt.Errorf("%w: ZZZZ", port.ErrUnknownSymbol))))
+	assert.Equal(t, exitFxUnavailable, getExitCode(port.ErrFxUnavailable))
+	assert.Equal(t, exitInvalidAllocation, getExitCode(port.ErrInvalidAllocation))
+	assert.Equal(t, exitInsufficientFunds, getExitCode(port.ErrInsufficientFunds))
+	assert.Equal(t, exitInvalidCredentials, getExitCode(port.ErrInvalidCredentials))
+	assert.Equal(t, exitAccountUnavailable, getExitCode(port.ErrAccountUnavailable))
+	assert.Equal(t, exitOrderRejected, getExitCode(fmt.Errorf("%w: buy 10 AAA", port.ErrOrderRejected)))
+	assert.Equal(t, exitHistoryUnavailable, getExitCode(fmt.Errorf("%w: AAA", port.ErrHistoryUnavailable)))
+	assert.Equal(t, exitTimeout, getExitCode(fmt.Errorf("%w: AAA: %w", port.ErrUnknownSymbol, context.DeadlineExceeded)))
+	assert.Equal(t, exitInterrupted, getExitCode(fmt.Errorf("AAA: %w", context.Canceled)))
+}
+
+func TestConfigureApi(t *testing.T) {
+	saveAvLimit, saveAvPolicy := av.ApiRequestsPerMinLimit, av.ApiRetryPolicy
+	saveQtLimit, saveQtPolicy := qt.ApiRequestsPerMinLimit, qt.ApiRetryPolicy
+	saveErPolicy, saveEraPolicy := exchangerate.ApiRetryPolicy, exchangeratesapi.ApiRetryPolicy
+	defer func() {
+		av.ApiRequestsPerMinLimit, av.ApiRetryPolicy = saveAvLimit, saveAvPolicy
+		qt.ApiRequestsPerMinLimit, qt.ApiRetryPolicy = saveQtLimit, saveQtPolicy
+		exchangerate.ApiRetryPolicy, exchangeratesapi.ApiRetryPolicy = saveErPolicy, saveEraPolicy
+	}()
+
+	policy := api.RetryPolicy{BackoffCap: time.Second, BackoffDelay: time.Millisecond, Jitter: 0.5, Limit: 3}
+	configureApi("alphavantage.co", 75, policy)
+	assert.Equal(t, 75, av.ApiRequestsPerMinLimit)
+	assert.Equal(t, policy, av.ApiRetryPolicy)
+	assert.Equal(t, saveQtPolicy, qt.ApiRetryPolicy)
+
+	configureApi("api01.iq.questrade.com", 0, policy)
+	assert.Equal(t, saveQtLimit, qt.ApiRequestsPerMinLimit)
+	assert.Equal(t, policy, qt.ApiRetryPolicy)
+
+	// Exchange rate servers only use the retry policy
+	configureApi("api.exchangerate.host", 75, policy)
+	assert.Equal(t, policy, exchangerate.ApiRetryPolicy)
+	assert.Equal(t, saveEraPolicy, exchangeratesapi.ApiRetryPolicy)
+
+	configureApi("api.exchangeratesapi.io", 75, policy)
+	assert.Equal(t, policy, exchangeratesapi.ApiRetryPolicy)
+}
+
+const testApiServer = "file://../../examples/prices.csv"
+
+// Clear the API key and server globals for a test, restoring them afterwards.
+// The user's config file is not used.
+func clearTestEnvVars(t *testing.T) {
+	saveKey, saveServer, saveFxKey := apiKey, apiServer, fxApiKey
+	t.Cleanup(func() {
+		apiKey, apiServer, fxApiKey = saveKey, saveServer, saveFxKey
+	})
+	apiKey, apiServer, fxApiKey = "", "", ""
+	t.Setenv(config.ConfigEnvName, filepath.Join(t.TempDir(), "config.yaml"))
+	t.Setenv(config.ProfileEnvName, "")
+}
+
+func TestFindCommand(t *testing.T) {
+	for _, name := range []string{"auth", "backtest", "fx", "quote", "rebalance", "search", "version"} {
+		assert.NotNil(t, findCommand(name), name)
+	}
+	assert.Nil(t, findCommand("help"))
+	assert.Nil(t, findCommand("-rebalance"))
+}
+
+func TestRun(t *testing.T) {
+	assert.Equal(t, exitUsage, run([]string{}))
+	assert.Equal(t, exitOk, run([]string{"help"}))
+	assert.Equal(t, exitOk, run([]string{"help", "quote"}))
+	assert.Equal(t, exitOk, run([]string{"-version"}))
+	assert.Equal(t, exitUsage, run([]string{"bogus"}))
+	assert.Equal(t, exitUsage, run([]string{"-debug"}))
+
+	// The -rebalance flag was replaced by the rebalance command
+	assert.Equal(t, exitUsage, run([]string{"-apiServer", testApiServer, "-rebalance", "portfolio.json"}))
+}
+
+func TestRebalance_Usage(t *testing.T) {
+	clearTestEnvVars(t)
+	assert.Equal(t, exitOk, run([]string{"rebalance", "-help"}))
+	assert.Equal(t, exitUsage, run([]string{"rebalance", "-apiServer", testApiServer}))
+	assert.Equal(t, exitUsage, run([]string{"rebalance", "-apiServer", testApiServer, "-deposit", "1", "-withdraw", "1", "portfolio.json"}))
+	assert.Equal(t, exitUsage, run([]string{"rebalance", "-apiServer", testApiServer, "-confirm", "portfolio.json"}))
+	assert.Equal(t, exitUsage, run([]string{"rebalance", "portfolio.json"}))
+	assert.Equal(t, exitInvalidFile, run([]string{"rebalance", "-apiServer", testApiServer, "-noCache", filepath.Join(t.TempDir(), "missing.json")}))
+}
+
+func TestRebalance(t *testing.T) {
+	clearTestEnvVars(t)
+	outputFile := filepath.Join(t.TempDir(), "orders.csv")
+
+	// Flags can follow the portfolio file
+	assert.Equal(t, exitOk, run([]string{"rebalance", "../../examples/portfolio.json", "-apiServer", testApiServer, "-noCache", "-output", "csv", "-outputFile", outputFile}))
+	output, err := os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(output), "holdings,symbol,"))
+}
+
+func TestQuote(t *testing.T) {
+	clearTestEnvVars(t)
+	outputFile := filepath.Join(t.TempDir(), "quotes.csv")
+
+	assert.Equal(t, exitOk, run([]string{"quote", "-apiServer", testApiServer, "-noCache", "-output", "csv", "-outputFile", outputFile, "aapl", "AMZN"}))
+	output, err := os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "symbol,latest,open,high,low,close,volume\nAAPL,172.50,0.00,0.00,0.00,0.00,\nAMZN,128.25,0.00,0.00,0.00,0.00,\n", string(output))
+
+	// Quotes that are found are written even if others are not
+	assert.Equal(t, exitUnknownSymbol, run([]string{"quote", "-apiServer", testApiServer, "-noCache", "-output", "csv", "-outputFile", outputFile, "ZZZZ", "AAPL"}))
+	output, err = os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "symbol,latest,open,high,low,close,volume\nAAPL,172.50,0.00,0.00,0.00,0.00,\n", string(output))
+
+	assert.Equal(t, exitUsage, run([]string{"quote", "-apiServer", testApiServer}))
+}
+
+func TestQuote_QuoteServers(t *testing.T) {
+	clearTestEnvVars(t)
+	dir := t.TempDir()
+	prices := filepath.Join(dir, "prices.csv")
+	assert.Nil(t, os.WriteFile(prices, []byte("symbol,currency,price,description,type\nAAPL,USD,170.00,Apple Inc,Equity\n"), 0600))
+	outputFile := filepath.Join(dir, "quotes.csv")
+
+	// Quotes missing from the first server are looked up with the next server
+	assert.Equal(t, exitOk, run([]string{"quote", "-apiServer", testApiServer, "-quoteServers", "file://" + prices + "," + testApiServer, "-noCache", "-output", "csv", "-outputFile", outputFile, "AAPL", "AMZN"}))
+	output, err := os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "symbol,latest,open,high,low,close,volume\nAAPL,170.00,0.00,0.00,0.00,0.00,\nAMZN,128.25,0.00,0.00,0.00,0.00,\n", string(output))
+
+	assert.Equal(t, exitError, run([]string{"quote", "-apiServer", testApiServer, "-quoteServers", "example.com", "-noCache", "AAPL"}))
+}
+
+func TestSearch(t *testing.T) {
+	clearTestEnvVars(t)
+	outputFile := filepath.Join(t.TempDir(), "search.json")
+
+	assert.Equal(t, exitOk, run([]string{"search", "-apiServer", testApiServer, "-noCache", "-output", "json", "-outputFile", outputFile, "AAPL"}))
+	output, err := os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.Contains(t, string(output), `"description": "Apple Inc"`)
+}
+
+func TestFx(t *testing.T) {
+	clearTestEnvVars(t)
+	outputFile := filepath.Join(t.TempDir(), "fx.csv")
+
+	assert.Equal(t, exitOk, run([]string{"fx", "-apiServer", testApiServer, "-noCache", "-output", "csv", "-outputFile", outputFile, "usd", "cad"}))
+	output, err := os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(output), "from,to,rate\nUSD,CAD,"))
+
+	assert.Equal(t, exitFxUnavailable, run([]string{"fx", "-apiServer", testApiServer, "-noCache", "-outputFile", outputFile, "USD", "XYZ"}))
+	assert.Equal(t, exitUsage, run([]string{"fx", "-apiServer", testApiServer, "USD"}))
+}
+
+func TestFx_FxServers(t *testing.T) {
+	clearTestEnvVars(t)
+	outputFile := filepath.Join(t.TempDir(), "fx.csv")
+
+	// Exchange rates missing from the fixed table are looked up with the
+	// stock API server
+	assert.Equal(t, exitOk, run([]string{"fx", "-apiServer", testApiServer, "-fxServers", "fixed:USD/EUR=0.92," + testApiServer, "-noCache", "-output", "csv", "-outputFile", outputFile, "USD", "EUR", "CAD"}))
+	output, err := os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "from,to,rate\nUSD,EUR,0.9200\nUSD,CAD,1.3514\n", string(output))
+
+	assert.Equal(t, exitFxUnavailable, run([]string{"fx", "-apiServer", testApiServer, "-fxServers", "fixed:USD/EUR=0.92", "-noCache", "-outputFile", outputFile, "USD", "CAD"}))
+
+	// An access key is required by exchangeratesapi.io
+	assert.Equal(t, exitError, run([]string{"fx", "-apiServer", testApiServer, "-fxServers", "exchangeratesapi.io", "-noCache", "USD", "CAD"}))
+}
+
+func TestAuth(t *testing.T) {
+	clearTestEnvVars(t)
+	assert.Equal(t, exitUsage, run([]string{"auth", "-apiServer", testApiServer, "-credentials", "credentials.json"}))
+	assert.Equal(t, exitUsage, run([]string{"auth", "-apiServer", testApiServer, "-credentials", "credentials.json", "login"}))
+	assert.Equal(t, exitUsage, run([]string{"auth", "-apiServer", testApiServer, "refresh"}))
+
+	// Snapshots do not have credentials to refresh
+	assert.Equal(t, exitInvalidCredentials, run([]string{"auth", "refresh", "-apiServer", testApiServer, "-noCache", "-credentials", "../../examples/credentials.json"}))
+}
+
+func TestParseFlags(t *testing.T) {
+	flags := newFlagSet("test", "<arg>...", "Test command.")
+	output := flags.String("output", "", "")
+	args, _, ok := parseFlags(flags, []string{"a", "-output", "json", "b", "--", "-c"})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a", "b", "-c"}, args)
+	assert.Equal(t, "json", *output)
+
+	_, exitCode, ok := parseFlags(flags, []string{"-bogus"})
+	assert.False(t, ok)
+	assert.Equal(t, exitUsage, exitCode)
+
+	_, exitCode, ok = parseFlags(flags, []string{"-help"})
+	assert.False(t, ok)
+	assert.Equal(t, exitOk, exitCode)
+}
+
+func TestWriteRows(t *testing.T) {
+	columns := []string{"symbol", "latest"}
+	rows := [][]string{{"AAPL", "172.50"}}
+
+	var buf bytes.Buffer
+	assert.Nil(t, writeRows(&buf, columns, rows, port.OutputCsv))
+	assert.Equal(t, "symbol,latest\nAAPL,172.50\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, writeRows(&buf, columns, rows, port.OutputJson))
+	assert.JSONEq(t, `[{"symbol":"AAPL","latest":"172.50"}]`, buf.String())
+
+	buf.Reset()
+	assert.Nil(t, writeRows(&buf, columns, rows, port.OutputTable))
+	assert.Equal(t, "SYMBOL  LATEST  \nAAPL    172.50  \n", buf.String())
+
+	assert.NotNil(t, writeRows(&buf, columns, rows, "xml"))
+}
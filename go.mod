@@ -6,6 +6,8 @@ require (
 	github.com/robaho/fixed v0.0.0-20211205151907-ef6645865188
 	github.com/sirupsen/logrus v1.9.2
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/sys v0.8.0
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
 
 require (
@@ -13,6 +15,4 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.16 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/shopspring/decimal v0.0.0-20180709203117-cd690d0c9e24 // indirect
-	golang.org/x/sys v0.8.0 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Environment variable containing the config file, used instead of the
+	// default config file
+	ConfigEnvName = "STOCKER_CONFIG"
+
+	// Environment variable containing the profile used when no profile is
+	// provided on the command line
+	ProfileEnvName = "STOCKER_PROFILE"
+)
+
+// ErrProfileNotFound is returned when a profile is not in the config file
+var ErrProfileNotFound = errors.New("profile not found")
+
+// Profile bundles the settings of a stock API provider, an account and a
+// portfolio. Empty or zero settings are not used.
+type Profile struct {
+	Account       string        `yaml:"account"`       // Brokerage account number
+	ApiKey        string        `yaml:"apiKey"`        // Stock API key
+	ApiServer     string        `yaml:"apiServer"`     // Stock API server
+	Backoff       time.Duration `yaml:"backoff"`       // Delay before retrying a failed request
+	BackoffCap    time.Duration `yaml:"backoffCap"`    // Maximum delay between request retries
+	Credentials   string        `yaml:"credentials"`   // OAuth 2.0 credentials file
+	Currency      string        `yaml:"currency"`      // Base currency
+	FxApiKey      string        `yaml:"fxApiKey"`      // Access key of the exchange rate servers
+	FxServers     []string      `yaml:"fxServers"`     // Exchange rate servers tried in order
+	Portfolio     string        `yaml:"portfolio"`     // Default portfolio file
+	QuoteServers  []string      `yaml:"quoteServers"`  // Stock API servers tried in order for symbols, quotes and price history
+	Requests      int           `yaml:"requests"`      // Maximum requests per minute
+	Retries       int           `yaml:"retries"`       // Maximum request attempts
+	RetryAfterCap time.Duration `yaml:"retryAfterCap"` // Maximum delay requested by a server that is waited for
+}
+
+// Config contains named profiles and the profile used by default
+type Config struct {
+	DefaultProfile string             `yaml:"defaultProfile"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+	filename       string
+}
+
+// DefaultFilename returns the config file in the user config directory, or an
+// empty string if there is no user config directory
+func DefaultFilename() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "stocker", "config.yaml")
+}
+
+// GetFilenameFromEnv returns the config file from the environment, or the
+// default config file
+func GetFilenameFromEnv() string {
+	if filename := os.Getenv(ConfigEnvName); len(filename) > 0 {
+		return filename
+	}
+	return DefaultFilename()
+}
+
+// GetProfileFromEnv returns the profile name from the environment
+func GetProfileFromEnv() string {
+	return os.Getenv(ProfileEnvName)
+}
+
+// Load loads a config file. A config file that does not exist is empty unless
+// it is required.
+func Load(filename string, required bool) (*Config, error) {
+	cfg := Config{filename: filename}
+	if len(filename) == 0 {
+		return &cfg, nil
+	}
+
+	buf, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return &cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(buf, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &cfg, nil
+}
+
+// Returns a file path relative to the directory of the config file. Paths
+// starting with ~ are relative to the home directory.
+func (c *Config) resolvePath(path string) string {
+	if len(path) == 0 || filepath.IsAbs(path) {
+		return path
+	}
+
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return filepath.Join(filepath.Dir(c.filename), path)
+}
+
+// GetProfile returns a named profile, or the default profile if no name is
+// provided. An empty profile is returned if there is no default profile.
+func (c *Config) GetProfile(name string) (Profile, error) {
+	if len(name) == 0 {
+		name = c.DefaultProfile
+	}
+	if len(name) == 0 {
+		return Profile{}, nil
+	}
+
+	profile, exists := c.Profiles[name]
+	if !exists {
+		return Profile{}, fmt.Errorf("%w: %s in config file %s", ErrProfileNotFound, name, c.filename)
+	}
+
+	profile.Credentials = c.resolvePath(profile.Credentials)
+	profile.Portfolio = c.resolvePath(profile.Portfolio)
+	return profile, nil
+}
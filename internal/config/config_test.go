@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+defaultProfile: personal
+profiles:
+  personal:
+    apiServer: alphavantage.co
+    apiKey: SomeApiKey
+    currency: USD
+    portfolio: portfolios/personal.json
+    requests: 75
+    retries: 5
+    backoff: 500ms
+  rrsp:
+    apiServer: questrade.com
+    account: "26598145"
+    credentials: ~/questrade.json
+    currency: CAD
+    portfolio: /portfolios/rrsp.json
+`
+
+func newTestConfigFile(t *testing.T, contents string) string {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	assert.Nil(t, os.WriteFile(filename, []byte(contents), 0600))
+	return filename
+}
+
+func TestLoad(t *testing.T) {
+	filename := newTestConfigFile(t, testConfig)
+	cfg, err := Load(filename, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "personal", cfg.DefaultProfile)
+	assert.Equal(t, 2, len(cfg.Profiles))
+
+	// A missing config file is only an error if it is required
+	missing := filepath.Join(t.TempDir(), "config.yaml")
+	cfg, err = Load(missing, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(cfg.Profiles))
+	_, err = Load(missing, true)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	_, err = Load(newTestConfigFile(t, "profiles: [personal"), false)
+	assert.NotNil(t, err)
+}
+
+func TestGetProfile(t *testing.T) {
+	filename := newTestConfigFile(t, testConfig)
+	cfg, err := Load(filename, true)
+	assert.Nil(t, err)
+
+	// Relative paths are relative to the config file directory
+	profile, err := cfg.GetProfile("")
+	assert.Nil(t, err)
+	assert.Equal(t, "alphavantage.co", profile.ApiServer)
+	assert.Equal(t, "SomeApiKey", profile.ApiKey)
+	assert.Equal(t, filepath.Join(filepath.Dir(filename), "portfolios", "personal.json"), profile.Portfolio)
+	assert.Equal(t, 75, profile.Requests)
+	assert.Equal(t, 5, profile.Retries)
+	assert.Equal(t, 500*time.Millisecond, profile.Backoff)
+
+	home, err := os.UserHomeDir()
+	assert.Nil(t, err)
+	profile, err = cfg.GetProfile("rrsp")
+	assert.Nil(t, err)
+	assert.Equal(t, "26598145", profile.Account)
+	assert.Equal(t, filepath.Join(home, "questrade.json"), profile.Credentials)
+	assert.Equal(t, "/portfolios/rrsp.json", profile.Portfolio)
+
+	_, err = cfg.GetProfile("work")
+	assert.True(t, errors.Is(err, ErrProfileNotFound))
+
+	// Without a default profile, the profile is empty
+	cfg.DefaultProfile = ""
+	profile, err = cfg.GetProfile("")
+	assert.Nil(t, err)
+	assert.Equal(t, Profile{}, profile)
+}
+
+func TestGetFilenameFromEnv(t *testing.T) {
+	t.Setenv(ConfigEnvName, "")
+	assert.Equal(t, DefaultFilename(), GetFilenameFromEnv())
+
+	t.Setenv(ConfigEnvName, "/etc/stocker.yaml")
+	assert.Equal(t, "/etc/stocker.yaml", GetFilenameFromEnv())
+}
@@ -0,0 +1,141 @@
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+)
+
+const (
+	// Environment variable containing the passphrase used to encrypt
+	// credentials files at rest
+	PassphraseEnvName = "STOCKER_CREDENTIALS_PASSPHRASE"
+
+	lockFileExt = ".lock"
+)
+
+// ErrPassphraseRequired is returned when loading an encrypted credentials
+// file without a passphrase
+var ErrPassphraseRequired = errors.New("credentials file is encrypted and requires a passphrase")
+
+type fileStore struct {
+	filename   string
+	lock       *os.File
+	mtx        sync.Mutex // Guards the lock file
+	passphrase string
+}
+
+// GetPassphraseFromEnv returns the passphrase used to encrypt credentials
+// files, or an empty string if credentials files are not encrypted
+func GetPassphraseFromEnv() string {
+	return os.Getenv(PassphraseEnvName)
+}
+
+// NewFileStore creates a credentials store backed by a file that is only
+// readable by the current user. If a passphrase is provided, the file is
+// encrypted when saved. Unencrypted files can still be loaded so that they are
+// encrypted the next time the credentials are saved.
+func NewFileStore(filename, passphrase string) api.CredentialsStore {
+	return &fileStore{
+		filename:   filename,
+		passphrase: passphrase,
+	}
+}
+
+func (s *fileStore) Load() (api.OAuthCredentials, error) {
+	creds := api.OAuthCredentials{}
+
+	buf, err := ioutil.ReadFile(s.filename)
+	if err == nil && isEncrypted(buf) {
+		if len(s.passphrase) == 0 {
+			err = fmt.Errorf("%s: %w (set %s)", s.filename, ErrPassphraseRequired, PassphraseEnvName)
+		} else {
+			buf, err = decrypt(buf, s.passphrase)
+		}
+	}
+
+	if err == nil {
+		err = json.Unmarshal(buf, &creds)
+	}
+
+	return creds, err
+}
+
+// Lock takes an exclusive advisory lock on a lock file next to the
+// credentials file, blocking until other processes release it. The
+// credentials file itself is not locked since it is replaced when saved.
+func (s *fileStore) Lock() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.lock != nil {
+		return errors.New("credentials store is already locked")
+	}
+
+	file, err := os.OpenFile(s.filename+lockFileExt, os.O_CREATE|os.O_RDWR, 0600)
+	if err == nil {
+		if err = lockFile(file); err == nil {
+			s.lock = file
+		} else {
+			file.Close()
+		}
+	}
+	return err
+}
+
+// Write the credentials to a temporary file and then rename it so that a
+// refreshed token is never lost to a partially written credentials file
+func (s *fileStore) Save(creds *api.OAuthCredentials) error {
+	buf, err := json.MarshalIndent(creds, "", "  ")
+	if err == nil && len(s.passphrase) > 0 {
+		buf, err = encrypt(buf, s.passphrase)
+	}
+	if err != nil {
+		return err
+	}
+
+	var tmp *os.File
+	if tmp, err = ioutil.TempFile(filepath.Dir(s.filename), filepath.Base(s.filename)+".*.tmp"); err != nil {
+		return err
+	}
+
+	if err = tmp.Chmod(0600); err == nil {
+		_, err = tmp.Write(buf)
+	}
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.filename)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (s *fileStore) Unlock() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.lock == nil {
+		return errors.New("credentials store is not locked")
+	}
+
+	err := unlockFile(s.lock)
+	if cerr := s.lock.Close(); err == nil {
+		err = cerr
+	}
+	s.lock = nil
+	return err
+}
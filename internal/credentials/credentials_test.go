@@ -0,0 +1,121 @@
+package credentials
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCreds = api.OAuthCredentials{
+	AccessToken:  "AccessToken01",
+	ApiServer:    "https://api01.iq.questrade.com/",
+	ExpiresIn:    1800,
+	IssuedAt:     time.Unix(1700000000, 0).UTC(),
+	RefreshToken: "RefreshToken01",
+	TokenType:    "Bearer",
+}
+
+func init() {
+	// Deriving keys is intentionally slow
+	pbkdf2Iterations = 1000
+}
+
+func TestFileStore_Save(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "credentials.json")
+	assert.Nil(t, os.WriteFile(filename, []byte("{}"), 0644))
+
+	store := NewFileStore(filename, "")
+	assert.Nil(t, store.Save(&testCreds))
+
+	creds, err := store.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, testCreds, creds)
+
+	// The credentials file is only readable by the current user
+	info, err := os.Stat(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+}
+
+func TestFileStore_Encrypted(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "credentials.json")
+	store := NewFileStore(filename, "passphrase")
+	assert.Nil(t, store.Save(&testCreds))
+
+	buf, err := os.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.True(t, isEncrypted(buf))
+	assert.NotContains(t, string(buf), testCreds.RefreshToken)
+
+	creds, err := store.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, testCreds, creds)
+
+	_, err = NewFileStore(filename, "").Load()
+	assert.True(t, errors.Is(err, ErrPassphraseRequired))
+
+	_, err = NewFileStore(filename, "wrong").Load()
+	assert.NotNil(t, err)
+}
+
+func TestFileStore_EncryptUnencrypted(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "credentials.json")
+	assert.Nil(t, NewFileStore(filename, "").Save(&testCreds))
+
+	// Unencrypted credentials are encrypted the next time they are saved
+	store := NewFileStore(filename, "passphrase")
+	creds, err := store.Load()
+	assert.Nil(t, err)
+	assert.Nil(t, store.Save(&creds))
+
+	buf, err := os.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.True(t, isEncrypted(buf))
+}
+
+func TestFileStore_Lock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "credentials.json")
+	store := NewFileStore(filename, "")
+
+	assert.NotNil(t, store.Unlock())
+	assert.Nil(t, store.Lock())
+	assert.NotNil(t, store.Lock())
+
+	// A second store blocks until the first store is unlocked
+	locked := make(chan error)
+	go func() {
+		other := NewFileStore(filename, "")
+		err := other.Lock()
+		if err == nil {
+			err = other.Unlock()
+		}
+		locked <- err
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("credentials store locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.Nil(t, store.Unlock())
+	assert.Nil(t, <-locked)
+}
+
+func TestPbkdf2(t *testing.T) {
+	// RFC 7914 section 11 test vector
+	key := pbkdf2([]byte("passwd"), []byte("salt"), 1, 64)
+	assert.Equal(t, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783", hex.EncodeToString(key))
+}
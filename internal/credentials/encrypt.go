@@ -0,0 +1,124 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	encryptionCipher = "aes-256-gcm"
+	encryptionKdf    = "pbkdf2-sha256"
+	encryptionKeyLen = 32
+	encryptionSalt   = 16
+)
+
+// Number of PBKDF2 iterations used to derive a key from a passphrase
+var pbkdf2Iterations = 600000
+
+// Encrypted credentials file. The key is derived from a passphrase with
+// PBKDF2, and the credentials are encrypted and authenticated with AES-GCM.
+type encryptedFile struct {
+	Cipher     string `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+	Iterations int    `json:"iterations"`
+	Kdf        string `json:"kdf"`
+	Nonce      []byte `json:"nonce"`
+	Salt       []byte `json:"salt"`
+}
+
+func isEncrypted(buf []byte) bool {
+	file := encryptedFile{}
+	return json.Unmarshal(buf, &file) == nil && len(file.Ciphertext) > 0
+}
+
+// PBKDF2 with HMAC-SHA256 (RFC 8018)
+func pbkdf2(passphrase, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, passphrase)
+	key := make([]byte, 0, keyLen)
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+func newGcm(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2([]byte(passphrase), salt, iterations, encryptionKeyLen))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encrypt(plaintext []byte, passphrase string) ([]byte, error) {
+	file := encryptedFile{
+		Cipher:     encryptionCipher,
+		Iterations: pbkdf2Iterations,
+		Kdf:        encryptionKdf,
+		Salt:       make([]byte, encryptionSalt),
+	}
+
+	if _, err := rand.Read(file.Salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGcm(passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(file.Nonce); err != nil {
+		return nil, err
+	}
+	file.Ciphertext = gcm.Seal(nil, file.Nonce, plaintext, nil)
+
+	return json.MarshalIndent(file, "", "  ")
+}
+
+func decrypt(buf []byte, passphrase string) ([]byte, error) {
+	file := encryptedFile{}
+	if err := json.Unmarshal(buf, &file); err != nil {
+		return nil, err
+	}
+
+	if file.Cipher != encryptionCipher || file.Kdf != encryptionKdf || file.Iterations < 1 {
+		return nil, fmt.Errorf("unsupported credentials encryption: %s/%s", file.Cipher, file.Kdf)
+	}
+
+	gcm, err := newGcm(passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(file.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid credentials encryption nonce")
+	}
+
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		err = errors.New("failed to decrypt credentials: wrong passphrase or corrupted file")
+	}
+	return plaintext, err
+}
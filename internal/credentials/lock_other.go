@@ -0,0 +1,16 @@
+//go:build !unix && !windows
+
+package credentials
+
+import (
+	"os"
+)
+
+// Advisory file locks are not supported on this platform
+func lockFile(file *os.File) error {
+	return nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
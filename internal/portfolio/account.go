@@ -0,0 +1,51 @@
+package portfolio
+
+import (
+	"fmt"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// SyncAccount replaces the source assets with the positions and per-currency
+// cash balances of a brokerage account, so that only the target assets need
+// to be provided in the portfolio file
+func (p *Portfolio) SyncAccount(accountId string) error {
+	accountApi, ok := api.NewAccountApiContext(p.Api)
+	if !ok {
+		return fmt.Errorf("%w: stock API does not support accounts", ErrAccountUnavailable)
+	}
+
+	log.Info("Synchronizing source assets with account ", accountId)
+	positions, err := accountApi.GetPositionsContext(p.getContext(), accountId)
+	if err != nil {
+		return fmt.Errorf("%w: positions of account %s: %w", ErrAccountUnavailable, accountId, err)
+	}
+
+	balances, err := accountApi.GetBalancesContext(p.getContext(), accountId)
+	if err != nil {
+		return fmt.Errorf("%w: balances of account %s: %w", ErrAccountUnavailable, accountId, err)
+	}
+
+	if len(p.Assets.Source) > 0 {
+		log.Warn("Replacing source assets in portfolio file with account ", accountId)
+	}
+
+	source := AssetGroup{}
+	for _, position := range positions {
+		// Closed positions are still returned until the end of the day
+		if position.Qty.Sign() != 0 {
+			source[position.Symbol] = Asset{Qty: position.Qty.String()}
+		}
+	}
+	for _, balance := range balances {
+		if balance.Cash.Sign() != 0 {
+			source[balance.Currency] = Asset{Qty: balance.Cash.String(), Type: typeCurrency}
+		}
+	}
+
+	if err = p.copyAssetStringsToFixed(&source); err == nil {
+		p.Assets.Source = source
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package portfolio
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Stock API with a single brokerage account
+type testAccountApi struct {
+	countingApi
+	balances  []stock.Balance
+	positions []stock.Position
+}
+
+func (a *testAccountApi) GetAccounts() ([]stock.Account, error) {
+	return []stock.Account{{Id: "1234"}}, nil
+}
+
+func (a *testAccountApi) GetBalances(accountId string) ([]stock.Balance, error) {
+	if accountId != "1234" {
+		return nil, syscall.ENOENT
+	}
+	return a.balances, nil
+}
+
+func (a *testAccountApi) GetPositions(accountId string) ([]stock.Position, error) {
+	if accountId != "1234" {
+		return nil, syscall.ENOENT
+	}
+	return a.positions, nil
+}
+
+func TestSyncAccount(t *testing.T) {
+	stockApi := &testAccountApi{
+		countingApi: countingApi{calls: make(map[string]int)},
+		balances: []stock.Balance{
+			{Cash: fp.NewS("1500.25"), Currency: "CAD"},
+			{Cash: fp.NewF(0), Currency: "USD"},
+		},
+		positions: []stock.Position{
+			{Qty: fp.NewF(100), Symbol: "AAA"},
+			{Qty: fp.NewF(0), Symbol: "BBB"},
+			{Qty: fp.NewS("2.5"), Symbol: "CCC"},
+		},
+	}
+	p := Portfolio{Api: stockApi, currency: "USD", lotSize: fp.NewF(1)}
+	p.Assets.Source = AssetGroup{"ZZZ": {}}
+
+	assert.Nil(t, p.SyncAccount("1234"))
+	assert.Equal(t, 3, len(p.Assets.Source))
+	assert.Equal(t, "100.00", p.Assets.Source["AAA"].fp.Qty.StringN(2))
+	assert.Equal(t, "2.50", p.Assets.Source["CCC"].fp.Qty.StringN(2))
+	assert.Equal(t, "1500.25", p.Assets.Source["CAD"].fp.Qty.StringN(2))
+	assert.Equal(t, typeCurrency, p.Assets.Source["CAD"].Type)
+	assert.Equal(t, "1.00", p.Assets.Source["AAA"].fp.LotSize.StringN(2))
+
+	assert.True(t, errors.Is(p.SyncAccount("5678"), ErrAccountUnavailable))
+}
+
+func TestSyncAccount_Unsupported(t *testing.T) {
+	p := Portfolio{Api: &countingApi{calls: make(map[string]int)}, currency: "USD"}
+	assert.True(t, errors.Is(p.SyncAccount("1234"), ErrAccountUnavailable))
+}
@@ -0,0 +1,530 @@
+package portfolio
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// Backtest rebalancing and contribution frequencies. Assets are rebalanced on
+// the first trading day of each month or quarter, or on any trading day that
+// an asset has drifted outside of its band.
+const (
+	FrequencyBands     = "bands"
+	FrequencyMonthly   = "monthly"
+	FrequencyQuarterly = "quarterly"
+)
+
+// BacktestDateFormat is the layout of the start and end dates of a backtest
+const BacktestDateFormat = "2006-01-02"
+
+// Used to annualize the volatility of daily returns
+const tradingDaysPerYear = 252
+
+// BacktestOptions controls how a portfolio is rebalanced over its price
+// history
+type BacktestOptions struct {
+	Contribution          string // Cash deposited on the first trading day of each contribution period
+	ContributionFrequency string // FrequencyMonthly or FrequencyQuarterly
+	End                   time.Time
+	Frequency             string // FrequencyBands, FrequencyMonthly or FrequencyQuarterly
+	Initial               string // Cash deposited on the first trading day, along with the source assets
+	Start                 time.Time
+}
+
+// BacktestResult summarizes the performance of a backtest. Returns are
+// time-weighted so that contributions are not counted as growth. Turnover and
+// trades do not include the initial investment.
+type BacktestResult struct {
+	Cagr          string `json:"cagr"`          // Compound annual growth rate
+	Contributions string `json:"contributions"` // Cash deposited after the first trading day
+	Currency      string `json:"currency"`
+	End           string `json:"end"`
+	EndValue      string `json:"endValue"`
+	MaxDrawdown   string `json:"maxDrawdown"`
+	Rebalances    int    `json:"rebalances"`
+	Start         string `json:"start"`
+	StartValue    string `json:"startValue"`
+	Trades        int    `json:"trades"`
+	Turnover      string `json:"turnover"`   // Traded market value per year, as a percentage of the average market value
+	Volatility    string `json:"volatility"` // Annualized standard deviation of daily returns
+}
+
+// IsBacktestFrequency returns true if a backtest can rebalance at a frequency
+func IsBacktestFrequency(frequency string) bool {
+	switch frequency {
+	case FrequencyBands, FrequencyMonthly, FrequencyQuarterly:
+		return true
+	}
+	return false
+}
+
+// Returns true if two trading days are in different months or quarters
+func isNewPeriod(prev, day time.Time, frequency string) bool {
+	switch frequency {
+	case FrequencyMonthly:
+		return prev.Year() != day.Year() || prev.Month() != day.Month()
+	case FrequencyQuarterly:
+		return prev.Year() != day.Year() || (prev.Month()-1)/3 != (day.Month()-1)/3
+	}
+	return false
+}
+
+// Daily prices of the symbols in a backtest, aligned by trading day. Trading
+// starts once every symbol has a price, and missing prices are carried
+// forward from the previous trading day. Adjusted close prices are used so
+// that dividends are reinvested.
+type priceHistory struct {
+	days   []time.Time
+	prices map[string][]fp.Fixed
+}
+
+func newPriceHistory(ctx context.Context, stockApi api.StockApi, symbols []string, from, to time.Time) (*priceHistory, error) {
+	bars := make(map[string]map[time.Time]fp.Fixed)
+	days := []time.Time{}
+	for _, symbol := range symbols {
+		history, err := api.NewStockApiContext(stockApi).GetHistoryContext(ctx, symbol, stock.IntervalDaily, from, to)
+		if err == nil && len(history) == 0 {
+			err = syscall.ENOENT
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrHistoryUnavailable, symbol, err)
+		}
+
+		bars[symbol] = make(map[time.Time]fp.Fixed)
+		for _, bar := range history {
+			price := bar.AdjClose
+			if price.Sign() <= 0 {
+				price = bar.Close
+			}
+			if _, exists := bars[symbol][bar.Time]; !exists {
+				days = append(days, bar.Time)
+			}
+			bars[symbol][bar.Time] = price
+		}
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Before(days[j])
+	})
+
+	ph := priceHistory{prices: make(map[string][]fp.Fixed)}
+	last := make(map[string]fp.Fixed)
+	for i, day := range days {
+		if i > 0 && day.Equal(days[i-1]) {
+			continue
+		}
+		for _, symbol := range symbols {
+			if price, exists := bars[symbol][day]; exists {
+				last[symbol] = price
+			}
+		}
+		if len(last) < len(symbols) {
+			continue
+		}
+
+		ph.days = append(ph.days, day)
+		for symbol, price := range last {
+			ph.prices[symbol] = append(ph.prices[symbol], price)
+		}
+	}
+
+	if len(ph.days) == 0 {
+		return nil, fmt.Errorf("%w: no trading days with prices for every symbol", ErrHistoryUnavailable)
+	}
+	return &ph, nil
+}
+
+// Stock API that quotes the prices of one trading day of a price history.
+// Symbols and exchange rates are only requested from the stock API once, and
+// all other requests are passed through to it.
+type backtestApi struct {
+	api.StockApi
+	currencies map[string]stock.Currency
+	day        int
+	fx         api.FxApi
+	history    *priceHistory
+	mtx        sync.Mutex
+	symbols    map[string]stock.Symbol
+}
+
+func newBacktestApi(stockApi api.StockApi, fx api.FxApi, history *priceHistory) *backtestApi {
+	return &backtestApi{
+		StockApi:   stockApi,
+		currencies: make(map[string]stock.Currency),
+		fx:         fx,
+		history:    history,
+		symbols:    make(map[string]stock.Symbol),
+	}
+}
+
+func (b *backtestApi) GetCurrency(from, to string) (stock.Currency, error) {
+	return b.GetCurrencyContext(context.Background(), from, to)
+}
+
+func (b *backtestApi) GetCurrencyContext(ctx context.Context, from, to string) (stock.Currency, error) {
+	b.mtx.Lock()
+	ccy, exists := b.currencies[from+to]
+	b.mtx.Unlock()
+	if exists {
+		return ccy, nil
+	}
+
+	ccy, err := api.NewFxApiContext(b.fx).GetCurrencyContext(ctx, from, to)
+	if err == nil {
+		b.mtx.Lock()
+		b.currencies[from+to] = ccy
+		b.mtx.Unlock()
+	}
+	return ccy, err
+}
+
+func (b *backtestApi) GetHistoryContext(ctx context.Context, symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	return api.NewStockApiContext(b.StockApi).GetHistoryContext(ctx, symbol, interval, from, to)
+}
+
+func (b *backtestApi) GetQuote(symbol string) (stock.Quote, error) {
+	return b.GetQuoteContext(context.Background(), symbol)
+}
+
+func (b *backtestApi) GetQuoteContext(ctx context.Context, symbol string) (stock.Quote, error) {
+	prices, exists := b.history.prices[symbol]
+	if !exists {
+		return stock.Quote{}, fmt.Errorf("no price history for %s: %w", symbol, syscall.ENOENT)
+	}
+
+	qte := stock.Quote{Symbol: symbol}
+	qte.Prices.Latest = prices[b.day].Float()
+	return qte, nil
+}
+
+func (b *backtestApi) GetSymbol(symbol string) (stock.Symbol, error) {
+	return b.GetSymbolContext(context.Background(), symbol)
+}
+
+func (b *backtestApi) GetSymbolContext(ctx context.Context, symbol string) (stock.Symbol, error) {
+	b.mtx.Lock()
+	sym, exists := b.symbols[symbol]
+	b.mtx.Unlock()
+	if exists {
+		return sym, nil
+	}
+
+	sym, err := api.NewStockApiContext(b.StockApi).GetSymbolContext(ctx, symbol)
+	if err == nil {
+		b.mtx.Lock()
+		b.symbols[symbol] = sym
+		b.mtx.Unlock()
+	}
+	return sym, err
+}
+
+func (b *backtestApi) RefreshCredentialsContext(ctx context.Context) (*api.OAuthCredentials, error) {
+	return api.NewStockApiContext(b.StockApi).RefreshCredentialsContext(ctx)
+}
+
+// Returns a portfolio holding the assets of a trading day with the target
+// allocations of this portfolio
+func (p *Portfolio) newBacktestPortfolio(stockApi api.StockApi, holdings AssetGroup) *Portfolio {
+	sim := Portfolio{
+		Api:      stockApi,
+		band:     p.band,
+		Context:  p.Context,
+		currency: p.currency,
+		lotSize:  p.lotSize,
+		Workers:  p.Workers,
+	}
+
+	sim.Assets.Source = AssetGroup{}
+	for symbol, asset := range holdings {
+		sim.Assets.Source[symbol] = asset
+	}
+
+	sim.Assets.Target = AssetGroup{}
+	for symbol, asset := range p.Assets.Target {
+		sim.Assets.Target[symbol] = Asset{
+			Band:    asset.Band,
+			LotSize: asset.LotSize,
+			Type:    asset.Type,
+			fp: fpAsset{
+				Alloc:   asset.fp.Alloc,
+				Band:    asset.fp.Band,
+				LotSize: asset.fp.LotSize,
+			},
+		}
+	}
+	return &sim
+}
+
+// Returns the number of trades and the total market value traded to turn the
+// source assets into the target assets, along with the assets held afterwards
+func (p *Portfolio) getBacktestTrades() (int, fp.Fixed, AssetGroup) {
+	trades := 0
+	traded := fp.NewF(0)
+	holdings := AssetGroup{}
+	for symbol, asset := range p.Assets.Target {
+		if symbol != p.currency && asset.Type != typeCurrency && asset.Order != nil && asset.fp.QtyDiff.Sign() != 0 {
+			trades++
+			traded = traded.Add(asset.fp.PriceDiff.Abs())
+		}
+		if symbol == p.currency {
+			asset.Type = typeCurrency
+		}
+		if asset.fp.Qty.Sign() != 0 {
+			holdings[symbol] = Asset{Type: asset.Type, fp: fpAsset{LotSize: asset.fp.LotSize, Qty: asset.fp.Qty}}
+		}
+	}
+	return trades, traded, holdings
+}
+
+// Backtest rebalances the target allocations of the portfolio over the daily
+// price history of its assets, starting with the source assets and an initial
+// deposit. Exchange rates are not historical, so the latest exchange rates are
+// used for every trading day.
+func (p *Portfolio) Backtest(opts BacktestOptions) (BacktestResult, error) {
+	result := BacktestResult{Currency: p.currency}
+
+	var parser fixedParser
+	initial := parser.parse("initial", opts.Initial)
+	contribution := parser.parse("contribution", opts.Contribution)
+	if err := parser.err; err != nil {
+		return result, err
+	} else if !IsBacktestFrequency(opts.Frequency) {
+		return result, fmt.Errorf("%w: backtest frequency: %s", ErrInvalidValue, opts.Frequency)
+	} else if opts.Frequency == FrequencyBands && !p.hasBands() {
+		// Without bands, every asset would be rebalanced on every trading day
+		return result, fmt.Errorf("%w: backtest frequency %s requires a portfolio or asset band", ErrInvalidValue, opts.Frequency)
+	} else if contribution.Sign() != 0 && opts.ContributionFrequency != FrequencyMonthly && opts.ContributionFrequency != FrequencyQuarterly {
+		return result, fmt.Errorf("%w: contribution frequency: %s", ErrInvalidValue, opts.ContributionFrequency)
+	} else if initial.Sign() < 0 || contribution.Sign() < 0 {
+		return result, fmt.Errorf("%w: initial deposit and contributions must not be negative", ErrInvalidValue)
+	} else if !opts.Start.Before(opts.End) {
+		return result, fmt.Errorf("%w: backtest start %s is not before end %s", ErrInvalidValue, opts.Start.Format(BacktestDateFormat), opts.End.Format(BacktestDateFormat))
+	}
+
+	// Currencies are held as cash rather than traded
+	symbols := []string{}
+	seen := make(map[string]bool)
+	for _, group := range []AssetGroup{p.Assets.Source, p.Assets.Target} {
+		for symbol, asset := range group {
+			if !seen[symbol] && symbol != p.currency && strings.ToLower(asset.Type) != typeCurrency {
+				symbols = append(symbols, symbol)
+			}
+			seen[symbol] = true
+		}
+	}
+	sort.Strings(symbols)
+	if len(symbols) == 0 {
+		return result, fmt.Errorf("%w: backtest requires at least one asset that is not a currency", ErrInvalidValue)
+	}
+
+	holdings := AssetGroup{}
+	for symbol, asset := range p.Assets.Source {
+		holdings[symbol] = Asset{Type: asset.Type, fp: fpAsset{LotSize: asset.fp.LotSize, Qty: asset.fp.Qty}}
+	}
+	cash := holdings[p.currency]
+	cash.Type = typeCurrency
+	cash.fp.Qty = cash.fp.Qty.Add(initial)
+	holdings[p.currency] = cash
+
+	log.Info("Looking up daily price history of ", len(symbols), " symbols")
+	history, err := newPriceHistory(p.getContext(), p.Api, symbols, opts.Start, opts.End)
+	if err != nil {
+		return result, err
+	}
+	hist := newBacktestApi(p.Api, p.getFxApi(), history)
+
+	values := make([]float64, len(history.days))
+	flows := make([]float64, len(history.days))
+	traded := fp.NewF(0)
+	deposited := fp.NewF(0)
+	for day := range history.days {
+		hist.day = day
+
+		flow := fp.NewF(0)
+		if day > 0 && isNewPeriod(history.days[day-1], history.days[day], opts.ContributionFrequency) {
+			flow = contribution
+		}
+
+		// Contributions are invested in underweight assets on trading days
+		// that are not scheduled rebalances
+		rebalance := day == 0
+		if day > 0 && opts.Frequency == FrequencyBands {
+			rebalance = flow.Sign() == 0
+		} else if day > 0 {
+			rebalance = isNewPeriod(history.days[day-1], history.days[day], opts.Frequency)
+		}
+
+		if rebalance && flow.Sign() > 0 {
+			cash := holdings[p.currency]
+			cash.Type = typeCurrency
+			cash.fp.Qty = cash.fp.Qty.Add(flow)
+			holdings[p.currency] = cash
+		}
+
+		var value fp.Fixed
+		sim := p.newBacktestPortfolio(hist, holdings)
+		if err = sim.validate(); err == nil {
+			value, err = sim.liquidate()
+		}
+
+		if err != nil {
+			// Error
+		} else if rebalance {
+			sim.UseBands = day > 0 && opts.Frequency == FrequencyBands
+			err = sim.allocate(value)
+		} else if flow.Sign() > 0 {
+			err = sim.contribute(value, flow)
+			value = value.Add(flow)
+		}
+
+		if err != nil {
+			return result, fmt.Errorf("Backtest failed on %s: %w", history.days[day].Format(BacktestDateFormat), err)
+		}
+
+		if rebalance || flow.Sign() > 0 {
+			trades, tradeValue, newHoldings := sim.getBacktestTrades()
+			if day > 0 {
+				if rebalance && trades > 0 {
+					result.Rebalances++
+				}
+				result.Trades += trades
+				traded = traded.Add(tradeValue)
+				deposited = deposited.Add(flow)
+			}
+			holdings = newHoldings
+		}
+
+		values[day] = value.Float()
+		flows[day] = flow.Float()
+	}
+
+	last := len(history.days) - 1
+	result.Contributions = deposited.Round(2).StringN(2) + p.currency
+	result.End = history.days[last].Format(BacktestDateFormat)
+	result.EndValue = fp.NewF(values[last]).Round(2).StringN(2) + p.currency
+	result.Start = history.days[0].Format(BacktestDateFormat)
+	result.StartValue = fp.NewF(values[0]).Round(2).StringN(2) + p.currency
+
+	years := history.days[last].Sub(history.days[0]).Hours() / 24 / 365.25
+	stats := getBacktestStats(values, flows, traded.Float(), years)
+	result.Cagr = formatPercent(stats.cagr)
+	result.MaxDrawdown = formatPercent(stats.maxDrawdown)
+	result.Turnover = formatPercent(stats.turnover)
+	result.Volatility = formatPercent(stats.volatility)
+	return result, nil
+}
+
+type backtestStats struct {
+	cagr        float64
+	maxDrawdown float64
+	turnover    float64
+	volatility  float64
+}
+
+// Find time-weighted statistics from the market value and contribution of
+// each trading day
+func getBacktestStats(values, flows []float64, traded, years float64) backtestStats {
+	stats := backtestStats{}
+	returns := []float64{}
+	index, peak, total := 1., 1., 0.
+	for i, value := range values {
+		total += value
+		if i == 0 || values[i-1] <= 0 {
+			continue
+		}
+
+		r := (value-flows[i])/values[i-1] - 1
+		returns = append(returns, r)
+		index *= 1 + r
+		if index > peak {
+			peak = index
+		} else if drawdown := 1 - index/peak; drawdown > stats.maxDrawdown {
+			stats.maxDrawdown = drawdown
+		}
+	}
+
+	if years > 0 && index > 0 {
+		stats.cagr = math.Pow(index, 1/years) - 1
+	}
+
+	if len(returns) > 1 {
+		mean := 0.
+		for _, r := range returns {
+			mean += r
+		}
+		mean /= float64(len(returns))
+
+		variance := 0.
+		for _, r := range returns {
+			variance += (r - mean) * (r - mean)
+		}
+		variance /= float64(len(returns) - 1)
+		stats.volatility = math.Sqrt(variance * tradingDaysPerYear)
+	}
+
+	if average := total / float64(len(values)); years > 0 && average > 0 {
+		stats.turnover = traded / 2 / average / years
+	}
+	return stats
+}
+
+func formatPercent(f float64) string {
+	return strconv.FormatFloat(f*100, 'f', 2, 64) + "%"
+}
+
+// WriteBacktestResult writes a backtest result in the json, csv or table
+// format
+func WriteBacktestResult(w io.Writer, result BacktestResult, format string) error {
+	rows := [][]string{
+		{"start", result.Start},
+		{"end", result.End},
+		{"startValue", result.StartValue},
+		{"endValue", result.EndValue},
+		{"contributions", result.Contributions},
+		{"cagr", result.Cagr},
+		{"volatility", result.Volatility},
+		{"maxDrawdown", result.MaxDrawdown},
+		{"turnover", result.Turnover},
+		{"rebalances", strconv.Itoa(result.Rebalances)},
+		{"trades", strconv.Itoa(result.Trades)},
+	}
+
+	var err error
+	switch format {
+	case OutputCsv:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"metric", "value"})
+		cw.WriteAll(rows)
+		err = cw.Error()
+	case OutputJson:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(result)
+	case OutputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "BACKTEST")
+		for _, row := range rows {
+			fmt.Fprintf(tw, "%s\t%s\t\n", row[0], row[1])
+		}
+		err = tw.Flush()
+	default:
+		err = fmt.Errorf("Invalid output format: %s", format)
+	}
+	return err
+}
@@ -0,0 +1,264 @@
+package portfolio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/stretchr/testify/assert"
+)
+
+var testBacktestStart = time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Stock API with a daily price history for each symbol, starting on the first
+// day of the backtest. Days without a price are skipped.
+type testHistoryApi struct {
+	countingApi
+	prices map[string][]float64
+}
+
+func (a *testHistoryApi) GetHistory(symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	a.count("history:" + symbol)
+	prices, exists := a.prices[symbol]
+	if !exists {
+		return nil, syscall.ENOENT
+	}
+
+	bars := []stock.Bar{}
+	for i, price := range prices {
+		day := testBacktestStart.AddDate(0, 0, i)
+		if price > 0 && !day.Before(from) && !day.After(to) {
+			bars = append(bars, stock.Bar{AdjClose: fp.NewF(price), Close: fp.NewF(price), Time: day})
+		}
+	}
+	return bars, nil
+}
+
+// Returns daily prices that grow at a constant rate
+func newTestPrices(days int, price, growth float64) []float64 {
+	prices := make([]float64, days)
+	for i := range prices {
+		prices[i] = price
+		price *= 1 + growth
+	}
+	return prices
+}
+
+func newTestBacktestPortfolio(prices map[string][]float64, alloc map[string]float64) *Portfolio {
+	p := Portfolio{Api: &testHistoryApi{countingApi: countingApi{calls: make(map[string]int)}, prices: prices}, currency: "USD"}
+	p.Assets.Source = AssetGroup{"USD": {Type: "Currency", fp: fpAsset{Qty: fp.NewF(1000)}}}
+	p.Assets.Target = AssetGroup{}
+	for symbol, a := range alloc {
+		p.Assets.Target[symbol] = Asset{fp: fpAsset{Alloc: fp.NewF(a)}}
+	}
+	return &p
+}
+
+func newTestBacktestOptions(frequency string, days int) BacktestOptions {
+	return BacktestOptions{
+		End:       testBacktestStart.AddDate(0, 0, days-1),
+		Frequency: frequency,
+		Start:     testBacktestStart,
+	}
+}
+
+func TestIsBacktestFrequency(t *testing.T) {
+	assert.True(t, IsBacktestFrequency(FrequencyBands))
+	assert.True(t, IsBacktestFrequency(FrequencyMonthly))
+	assert.True(t, IsBacktestFrequency(FrequencyQuarterly))
+	assert.False(t, IsBacktestFrequency("weekly"))
+}
+
+func TestIsNewPeriod(t *testing.T) {
+	jan31 := time.Date(2023, time.January, 31, 0, 0, 0, 0, time.UTC)
+	feb1 := time.Date(2023, time.February, 1, 0, 0, 0, 0, time.UTC)
+	apr3 := time.Date(2023, time.April, 3, 0, 0, 0, 0, time.UTC)
+	assert.True(t, isNewPeriod(jan31, feb1, FrequencyMonthly))
+	assert.False(t, isNewPeriod(jan31, feb1, FrequencyQuarterly))
+	assert.True(t, isNewPeriod(feb1, apr3, FrequencyQuarterly))
+	assert.True(t, isNewPeriod(time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC), feb1.AddDate(0, -1, 0), FrequencyQuarterly))
+	assert.False(t, isNewPeriod(jan31, feb1, ""))
+}
+
+func TestNewPriceHistory(t *testing.T) {
+	stockApi := &testHistoryApi{countingApi: countingApi{calls: make(map[string]int)}, prices: map[string][]float64{
+		"AAA": {10, 11, 0, 13},
+		"BBB": {0, 21, 22, 23},
+	}}
+
+	// Trading starts once every symbol has a price, and missing prices are
+	// carried forward
+	ph, err := newPriceHistory(context.Background(), stockApi, []string{"AAA", "BBB"}, testBacktestStart, testBacktestStart.AddDate(0, 0, 3))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(ph.days))
+	assert.Equal(t, testBacktestStart.AddDate(0, 0, 1), ph.days[0])
+	assert.Equal(t, []fp.Fixed{fp.NewF(11), fp.NewF(11), fp.NewF(13)}, ph.prices["AAA"])
+	assert.Equal(t, []fp.Fixed{fp.NewF(21), fp.NewF(22), fp.NewF(23)}, ph.prices["BBB"])
+
+	_, err = newPriceHistory(context.Background(), stockApi, []string{"AAA", "ZZZZ"}, testBacktestStart, testBacktestStart.AddDate(0, 0, 3))
+	assert.True(t, errors.Is(err, ErrHistoryUnavailable))
+}
+
+func TestBacktest_Contributions(t *testing.T) {
+	p := newTestBacktestPortfolio(map[string][]float64{
+		"AAA": newTestPrices(90, 10, 0),
+		"BBB": newTestPrices(90, 20, 0),
+	}, map[string]float64{"AAA": 50, "BBB": 50})
+
+	opts := newTestBacktestOptions(FrequencyMonthly, 90)
+	opts.Contribution = "100"
+	opts.ContributionFrequency = FrequencyMonthly
+	result, err := p.Backtest(opts)
+	assert.Nil(t, err)
+
+	// Contributions are not counted as growth
+	assert.Equal(t, "2023-01-01", result.Start)
+	assert.Equal(t, "2023-03-31", result.End)
+	assert.Equal(t, "1000.00USD", result.StartValue)
+	assert.Equal(t, "1200.00USD", result.EndValue)
+	assert.Equal(t, "200.00USD", result.Contributions)
+	assert.Equal(t, "0.00%", result.Cagr)
+	assert.Equal(t, "0.00%", result.MaxDrawdown)
+	assert.Equal(t, "0.00%", result.Volatility)
+
+	// Each contribution buys both assets at the start of February and March
+	assert.Equal(t, 2, result.Rebalances)
+	assert.Equal(t, 4, result.Trades)
+
+	// Contributions that are not on a rebalance day only buy underweight assets
+	p = newTestBacktestPortfolio(map[string][]float64{
+		"AAA": newTestPrices(90, 10, 0),
+		"BBB": newTestPrices(90, 20, 0),
+	}, map[string]float64{"AAA": 50, "BBB": 50})
+	opts.Frequency = FrequencyQuarterly
+	result, err = p.Backtest(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "1200.00USD", result.EndValue)
+	assert.Equal(t, 0, result.Rebalances)
+	assert.Equal(t, 4, result.Trades)
+}
+
+func TestBacktest_Drawdown(t *testing.T) {
+	prices := append(newTestPrices(30, 10, 0), newTestPrices(30, 5, 0)...)
+	prices = append(prices, newTestPrices(30, 10, 0)...)
+	p := newTestBacktestPortfolio(map[string][]float64{"AAA": prices}, map[string]float64{"AAA": 100})
+
+	result, err := p.Backtest(newTestBacktestOptions(FrequencyMonthly, 90))
+	assert.Nil(t, err)
+	assert.Equal(t, "1000.00USD", result.EndValue)
+	assert.Equal(t, "0.00%", result.Cagr)
+	assert.Equal(t, "50.00%", result.MaxDrawdown)
+	assert.NotEqual(t, "0.00%", result.Volatility)
+	assert.Equal(t, 0, result.Trades)
+}
+
+func TestBacktest_Bands(t *testing.T) {
+	prices := map[string][]float64{
+		"AAA": newTestPrices(90, 10, 0.01),
+		"BBB": newTestPrices(90, 10, 0),
+	}
+
+	p := newTestBacktestPortfolio(prices, map[string]float64{"AAA": 50, "BBB": 50})
+	monthly, err := p.Backtest(newTestBacktestOptions(FrequencyMonthly, 90))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, monthly.Rebalances)
+
+	// Assets are only rebalanced once they drift outside of their band
+	p = newTestBacktestPortfolio(prices, map[string]float64{"AAA": 50, "BBB": 50})
+	p.band = newTestFpBand(t, &Band{Absolute: "15"}, fpBand{})
+	for symbol, asset := range p.Assets.Target {
+		asset.fp.Band = p.band
+		p.Assets.Target[symbol] = asset
+	}
+	bands, err := p.Backtest(newTestBacktestOptions(FrequencyBands, 90))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, bands.Rebalances)
+	assert.Less(t, bands.Trades, monthly.Trades)
+	assert.NotEqual(t, "0.00%", bands.Cagr)
+	assert.NotEqual(t, "0.00%", bands.Turnover)
+}
+
+func TestBacktest_BandsNotSet(t *testing.T) {
+	p := newTestBacktestPortfolio(map[string][]float64{"AAA": newTestPrices(10, 10, 0)}, map[string]float64{"AAA": 100})
+
+	// Without bands, every trading day would be a full rebalance
+	_, err := p.Backtest(newTestBacktestOptions(FrequencyBands, 10))
+	assert.True(t, errors.Is(err, ErrInvalidValue))
+	assert.Contains(t, err.Error(), "band")
+
+	// A band for a single asset is enough
+	asset := p.Assets.Target["AAA"]
+	asset.fp.Band = newTestFpBand(t, &Band{Relative: "25"}, fpBand{})
+	p.Assets.Target["AAA"] = asset
+	_, err = p.Backtest(newTestBacktestOptions(FrequencyBands, 10))
+	assert.Nil(t, err)
+}
+
+func TestBacktest_CurrencyOnly(t *testing.T) {
+	p := newTestBacktestPortfolio(map[string][]float64{}, map[string]float64{"USD": 100})
+
+	// There is no price history to replay
+	_, err := p.Backtest(newTestBacktestOptions(FrequencyMonthly, 10))
+	assert.True(t, errors.Is(err, ErrInvalidValue))
+
+	// A price history without trading days is not replayed either
+	_, err = newPriceHistory(context.Background(), p.Api, []string{}, testBacktestStart, testBacktestStart.AddDate(0, 0, 3))
+	assert.True(t, errors.Is(err, ErrHistoryUnavailable))
+}
+
+func TestBacktest_InvalidOptions(t *testing.T) {
+	p := newTestBacktestPortfolio(map[string][]float64{"AAA": newTestPrices(10, 10, 0)}, map[string]float64{"AAA": 100})
+
+	opts := newTestBacktestOptions("weekly", 10)
+	_, err := p.Backtest(opts)
+	assert.True(t, errors.Is(err, ErrInvalidValue))
+
+	opts = newTestBacktestOptions(FrequencyMonthly, 10)
+	opts.Contribution = "100"
+	_, err = p.Backtest(opts)
+	assert.True(t, errors.Is(err, ErrInvalidValue))
+
+	opts = newTestBacktestOptions(FrequencyMonthly, 10)
+	opts.Initial = "-1"
+	_, err = p.Backtest(opts)
+	assert.True(t, errors.Is(err, ErrInvalidValue))
+
+	opts = newTestBacktestOptions(FrequencyMonthly, 10)
+	opts.End = opts.Start
+	_, err = p.Backtest(opts)
+	assert.True(t, errors.Is(err, ErrInvalidValue))
+
+	p.Assets.Target = AssetGroup{"ZZZZ": {fp: fpAsset{Alloc: fp.NewF(100)}}}
+	_, err = p.Backtest(newTestBacktestOptions(FrequencyMonthly, 10))
+	assert.True(t, errors.Is(err, ErrHistoryUnavailable))
+}
+
+func TestWriteBacktestResult(t *testing.T) {
+	result := BacktestResult{Cagr: "7.25%", EndValue: "1500.00USD", Trades: 12}
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteBacktestResult(&buf, result, OutputJson))
+	decoded := BacktestResult{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, result, decoded)
+
+	buf.Reset()
+	assert.Nil(t, WriteBacktestResult(&buf, result, OutputCsv))
+	assert.True(t, strings.HasPrefix(buf.String(), "metric,value\n"))
+	assert.Contains(t, buf.String(), "cagr,7.25%\n")
+	assert.Contains(t, buf.String(), "trades,12\n")
+
+	buf.Reset()
+	assert.Nil(t, WriteBacktestResult(&buf, result, OutputTable))
+	assert.Contains(t, buf.String(), "BACKTEST")
+	assert.Contains(t, buf.String(), "1500.00USD")
+
+	assert.NotNil(t, WriteBacktestResult(&buf, result, "xml"))
+}
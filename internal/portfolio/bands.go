@@ -0,0 +1,124 @@
+package portfolio
+
+import (
+	"fmt"
+
+	fp "github.com/robaho/fixed"
+	log "github.com/sirupsen/logrus"
+)
+
+// Band is the drift from a target allocation that is tolerated before an
+// asset is rebalanced. When both thresholds are set, the smaller one applies
+// (e.g. the 5/25 rule uses an absolute threshold of 5 and a relative
+// threshold of 25).
+type Band struct {
+	Absolute string `json:"absolute,omitempty"` // Percentage points from the target allocation
+	Relative string `json:"relative,omitempty"` // Percentage of the target allocation
+}
+
+// Used for internal fixed point representation of bands
+type fpBand struct {
+	Absolute    fp.Fixed
+	HasAbsolute bool
+	HasRelative bool
+	Relative    fp.Fixed
+}
+
+// Parse a band, using the default band for thresholds that are not set
+func newFpBand(band *Band, def fpBand) (fpBand, error) {
+	var parser fixedParser
+	b := def
+	if band != nil {
+		if len(band.Absolute) > 0 {
+			b.Absolute = parser.parse("band.absolute", band.Absolute)
+			b.HasAbsolute = true
+		}
+		if len(band.Relative) > 0 {
+			b.Relative = parser.parse("band.relative", band.Relative)
+			b.HasRelative = true
+		}
+	}
+	return b, parser.err
+}
+
+// Maximum drift (in percentage points) allowed from a target allocation, or
+// false if no band is set
+func (b fpBand) getThreshold(targetAlloc fp.Fixed) (fp.Fixed, bool) {
+	threshold := b.Absolute
+	if b.HasRelative {
+		relative := targetAlloc.Mul(b.Relative).Div(fp.NewF(100))
+		if !b.HasAbsolute || relative.LessThan(threshold) {
+			threshold = relative
+		}
+	}
+	return threshold, b.HasAbsolute || b.HasRelative
+}
+
+func (b fpBand) validate() error {
+	var err error
+	if b.Absolute.Sign() < 0 || b.Relative.Sign() < 0 {
+		err = fmt.Errorf("%w: band %s/%s", ErrInvalidValue, b.Absolute.String(), b.Relative.String())
+	}
+	return err
+}
+
+// Returns true if a band is set for any target asset, either for the asset or
+// for the whole portfolio
+func (p *Portfolio) hasBands() bool {
+	for symbol, asset := range p.Assets.Target {
+		if symbol == p.currency {
+			continue
+		}
+		if _, banded := asset.fp.Band.getThreshold(asset.fp.Alloc); banded {
+			return true
+		}
+	}
+	return false
+}
+
+// Keep source quantities of target assets whose source allocation is within
+// their band. Returns the funds left over for the remaining target assets,
+// and the total target allocation of the remaining target assets (including
+// cash).
+func (p *Portfolio) holdAssetsInBand(funds fp.Fixed) (fp.Fixed, fp.Fixed) {
+	budget := funds
+	budgetAlloc := fp.NewF(100)
+
+	for symbol, asset := range p.Assets.Target {
+		if symbol == p.currency {
+			continue
+		}
+
+		src, held := p.Assets.Source[symbol]
+		if !held {
+			continue
+		}
+
+		threshold, banded := asset.fp.Band.getThreshold(asset.fp.Alloc)
+		drift := src.fp.Alloc.Sub(asset.fp.Alloc)
+		if drift.Sign() < 0 {
+			drift = drift.Mul(fp.NewF(-1))
+		}
+
+		if banded && drift.LessThanOrEqual(threshold) {
+			log.Debug(symbol, ": drift of ", drift.Round(4).StringN(4), "% is within band of ", threshold.Round(4).StringN(4), "%")
+			budget = budget.Sub(src.fp.MarketValue)
+			budgetAlloc = budgetAlloc.Sub(asset.fp.Alloc)
+
+			asset.fp.InBand = true
+			asset.fp.Fxr = src.fp.Fxr
+			asset.fp.MarketValue = src.fp.MarketValue
+			asset.fp.Price = src.fp.Price
+			asset.fp.Qty = src.fp.Qty
+			if funds.GreaterThan(fp.NewF(0)) {
+				asset.fp.Alloc = getAllocation(src.fp.MarketValue, funds)
+			}
+			asset.Currency = src.Currency
+			asset.Name = src.Name
+			asset.Type = src.Type
+			p.Assets.Target[symbol] = asset
+		}
+	}
+
+	return budget, budgetAlloc
+}
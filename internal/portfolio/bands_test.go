@@ -0,0 +1,77 @@
+package portfolio
+
+import (
+	"errors"
+	"testing"
+
+	fp "github.com/robaho/fixed"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFpBand(t *testing.T, band *Band, def fpBand) fpBand {
+	b, err := newFpBand(band, def)
+	assert.Nil(t, err)
+	return b
+}
+
+func TestNewFpBand_InvalidValue(t *testing.T) {
+	_, err := newFpBand(&Band{Absolute: "five"}, fpBand{})
+	assert.True(t, errors.Is(err, ErrInvalidValue))
+}
+
+func TestGetThreshold(t *testing.T) {
+	_, banded := fpBand{}.getThreshold(fp.NewF(50))
+	assert.False(t, banded)
+
+	band := newTestFpBand(t, &Band{Absolute: "5", Relative: "25"}, fpBand{})
+	threshold, banded := band.getThreshold(fp.NewF(50))
+	assert.True(t, banded)
+	assert.Equal(t, "5.00", threshold.StringN(2))
+
+	threshold, banded = band.getThreshold(fp.NewF(10))
+	assert.True(t, banded)
+	assert.Equal(t, "2.50", threshold.StringN(2))
+
+	band = newTestFpBand(t, &Band{Relative: "10"}, band)
+	threshold, _ = band.getThreshold(fp.NewF(80))
+	assert.Equal(t, "5.00", threshold.StringN(2))
+	threshold, _ = band.getThreshold(fp.NewF(20))
+	assert.Equal(t, "2.00", threshold.StringN(2))
+
+	band = newTestFpBand(t, &Band{Relative: "10"}, fpBand{})
+	threshold, _ = band.getThreshold(fp.NewF(80))
+	assert.Equal(t, "8.00", threshold.StringN(2))
+}
+
+func TestBandValidate(t *testing.T) {
+	assert.Nil(t, newTestFpBand(t, &Band{Absolute: "5", Relative: "25"}, fpBand{}).validate())
+	assert.NotNil(t, newTestFpBand(t, &Band{Absolute: "-5"}, fpBand{}).validate())
+	assert.NotNil(t, newTestFpBand(t, &Band{Relative: "-25"}, fpBand{}).validate())
+}
+
+func TestHoldAssetsInBand(t *testing.T) {
+	band := newTestFpBand(t, &Band{Absolute: "5", Relative: "25"}, fpBand{})
+
+	p := Portfolio{currency: "USD"}
+	p.Assets.Source = AssetGroup{
+		"AAA": Asset{fp: fpAsset{Alloc: fp.NewF(54), MarketValue: fp.NewF(540), Qty: fp.NewF(54)}},
+		"BBB": Asset{fp: fpAsset{Alloc: fp.NewF(46), MarketValue: fp.NewF(460), Qty: fp.NewF(46)}},
+	}
+	p.Assets.Target = AssetGroup{
+		"AAA": Asset{fp: fpAsset{Alloc: fp.NewF(50), Band: band}},
+		"BBB": Asset{fp: fpAsset{Alloc: fp.NewF(40), Band: band}},
+		"CCC": Asset{fp: fpAsset{Alloc: fp.NewF(5), Band: band}},
+		"USD": Asset{fp: fpAsset{Alloc: fp.NewF(5), Band: band}},
+	}
+
+	budget, budgetAlloc := p.holdAssetsInBand(fp.NewF(1000))
+	assert.Equal(t, "460.00", budget.StringN(2))
+	assert.Equal(t, "50.00", budgetAlloc.StringN(2))
+
+	assert.True(t, p.Assets.Target["AAA"].fp.InBand)
+	assert.Equal(t, "54.00", p.Assets.Target["AAA"].fp.Qty.StringN(2))
+	assert.Equal(t, "54.00", p.Assets.Target["AAA"].fp.Alloc.StringN(2))
+	assert.False(t, p.Assets.Target["BBB"].fp.InBand)
+	assert.False(t, p.Assets.Target["CCC"].fp.InBand)
+	assert.False(t, p.Assets.Target["USD"].fp.InBand)
+}
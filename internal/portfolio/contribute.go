@@ -0,0 +1,172 @@
+package portfolio
+
+import (
+	"fmt"
+
+	fp "github.com/robaho/fixed"
+	log "github.com/sirupsen/logrus"
+)
+
+// Round a quantity up to a whole number of lots. A lot size of zero allows any
+// fractional quantity.
+func roundUpToLotSize(qty, lotSize fp.Fixed) fp.Fixed {
+	lots := roundDownToLotSize(qty, lotSize)
+	if lots.LessThan(qty) {
+		lots = lots.Add(lotSize)
+	}
+	return lots
+}
+
+// Move the target assets as close to their target allocations as possible by
+// only buying underweight assets with a deposit, or by only selling overweight
+// assets for a withdrawal. Source assets that are not sold are carried over
+// into the target assets.
+func (p *Portfolio) contribute(value, amount fp.Fixed) error {
+	var err error
+	zero := fp.NewF(0)
+	funds := value.Add(amount)
+	allocation := zero
+
+	if funds.LessThan(zero) {
+		return fmt.Errorf("%w: withdrawal of %s%s exceeds source assets total market value of %s%s", ErrInsufficientFunds, amount.Mul(fp.NewF(-1)).Round(2).StringN(2), p.currency, value.Round(2).StringN(2), p.currency)
+	}
+
+	cash := p.getTargetCash()
+	p.Assets.Target[p.currency] = cash
+
+	targetAlloc := make(map[string]fp.Fixed)
+	for symbol, asset := range p.Assets.Target {
+		allocation = allocation.Add(asset.fp.Alloc)
+		targetAlloc[symbol] = asset.fp.Alloc
+	}
+
+	if !allocation.Equal(fp.NewF(100)) {
+		return fmt.Errorf("%w: %s", ErrInvalidAllocation, allocation.Round(2).StringN(2))
+	}
+
+	// Start with the source assets, including those without a target allocation
+	for symbol, src := range p.Assets.Source {
+		if symbol == p.currency {
+			continue
+		}
+		asset, exists := p.Assets.Target[symbol]
+		if !exists {
+			asset = src
+			asset.fp.Alloc = zero
+		}
+		asset.Currency = src.Currency
+		asset.Name = src.Name
+		asset.Type = src.Type
+		asset.fp.Fxr = src.fp.Fxr
+		asset.fp.MarketValue = src.fp.MarketValue
+		asset.fp.Price = src.fp.Price
+		asset.fp.Qty = src.fp.Qty
+		p.Assets.Target[symbol] = asset
+	}
+
+	for symbol, asset := range p.Assets.Target {
+		if symbol != p.currency && asset.fp.Price.LessThanOrEqual(zero) {
+			if err = p.initializeAsset(symbol, &asset); err != nil {
+				return err
+			}
+			asset.fp.MarketValue = zero
+			asset.fp.Qty = zero
+			p.Assets.Target[symbol] = asset
+		}
+	}
+
+	// Difference between the target and current market value of each asset
+	cashValue := zero
+	if src, exists := p.Assets.Source[p.currency]; exists {
+		cashValue = src.fp.MarketValue
+	}
+	cashExcess := cashValue.Sub(funds.Mul(targetAlloc[p.currency]).Div(fp.NewF(100)))
+	gaps := make(map[string]fp.Fixed)
+	total := zero
+	for symbol, asset := range p.Assets.Target {
+		if symbol == p.currency {
+			continue
+		}
+		gap := funds.Mul(targetAlloc[symbol]).Div(fp.NewF(100)).Sub(asset.fp.MarketValue)
+		if amount.Sign() < 0 {
+			gap = gap.Mul(fp.NewF(-1))
+		}
+		if gap.GreaterThan(zero) {
+			gaps[symbol] = gap
+			total = total.Add(gap)
+		}
+	}
+
+	// Cash in excess of its target allocation is invested along with a
+	// deposit, or withdrawn before selling any assets. Cash short of its target
+	// allocation is topped up first.
+	cashLeft := cashValue.Add(amount)
+	needed := amount.Add(cashExcess)
+	if amount.Sign() < 0 {
+		needed = needed.Mul(fp.NewF(-1))
+	}
+
+	if needed.GreaterThan(zero) && total.GreaterThan(zero) {
+		scale := fp.NewF(1)
+		if needed.LessThan(total) {
+			scale = needed.Div(total)
+		}
+
+		for symbol, gap := range gaps {
+			asset := p.Assets.Target[symbol]
+			qty := gap.Mul(scale).Div(asset.fp.Price.Mul(asset.fp.Fxr))
+			if amount.Sign() < 0 {
+				// Sell enough to raise the withdrawal, but no more than is held
+				if asset.Type != typeCurrency {
+					qty = roundUpToLotSize(qty, asset.fp.LotSize)
+				}
+				if qty.GreaterThan(asset.fp.Qty) {
+					qty = asset.fp.Qty
+				}
+				qty = qty.Mul(fp.NewF(-1))
+			} else if asset.Type != typeCurrency {
+				qty = roundDownToLotSize(qty, asset.fp.LotSize)
+			}
+
+			mvp := qty.Mul(asset.fp.Price).Mul(asset.fp.Fxr)
+			asset.fp.Qty = asset.fp.Qty.Add(qty)
+			asset.fp.MarketValue = asset.fp.MarketValue.Add(mvp)
+			cashLeft = cashLeft.Sub(mvp)
+			p.Assets.Target[symbol] = asset
+			log.Debug(symbol, ": contribution order of ", qty.String(), " units")
+		}
+	}
+
+	for symbol, asset := range p.Assets.Target {
+		if symbol != p.currency && funds.GreaterThan(zero) {
+			asset.fp.Alloc = getAllocation(asset.fp.MarketValue, funds)
+			p.Assets.Target[symbol] = asset
+		}
+	}
+
+	if amount.Sign() > 0 {
+		cashLeft = p.redistributeResidualCash(funds, cashLeft, targetAlloc, true)
+	}
+
+	p.completeTarget(cash, cashLeft, funds)
+	return err
+}
+
+// Contribute invests a deposit by only buying underweight target assets, or
+// raises a withdrawal (a negative amount) by only selling overweight assets.
+func (p *Portfolio) Contribute(amount string) error {
+	var value fp.Fixed
+
+	fpAmount, err := newFixedFromString("contribution", amount)
+	if err != nil {
+		// Invalid amount
+	} else if err = p.validate(); err != nil {
+		err = fmt.Errorf("Validation failed: %w", err)
+	} else if value, err = p.liquidate(); err != nil {
+		err = fmt.Errorf("Liquidation failed: %w", err)
+	} else if err = p.contribute(value, fpAmount); err != nil {
+		err = fmt.Errorf("Contribution failed: %w", err)
+	}
+
+	return err
+}
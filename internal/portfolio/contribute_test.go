@@ -0,0 +1,77 @@
+package portfolio
+
+import (
+	"testing"
+
+	fp "github.com/robaho/fixed"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestContributePortfolio() *Portfolio {
+	p := Portfolio{currency: "USD"}
+	p.Assets.Source = AssetGroup{
+		"AAA": newTestTargetAsset(10, 60),
+		"BBB": newTestTargetAsset(20, 20),
+		"USD": newTestTargetAsset(1, 0),
+	}
+	p.Assets.Target = AssetGroup{
+		"AAA": {fp: fpAsset{Alloc: fp.NewF(50), LotSize: fp.NewF(1)}},
+		"BBB": {fp: fpAsset{Alloc: fp.NewF(50), LotSize: fp.NewF(1)}},
+	}
+	return &p
+}
+
+func TestRoundUpToLotSize(t *testing.T) {
+	assert.Equal(t, "12.3456", roundUpToLotSize(fp.NewS("12.3456"), fp.NewF(0)).StringN(4))
+	assert.Equal(t, "13.0000", roundUpToLotSize(fp.NewS("12.3456"), fp.NewF(1)).StringN(4))
+	assert.Equal(t, "12.0000", roundUpToLotSize(fp.NewS("12"), fp.NewF(1)).StringN(4))
+	assert.Equal(t, "100.0000", roundUpToLotSize(fp.NewS("0.01"), fp.NewF(100)).StringN(4))
+}
+
+func TestContribute_Deposit(t *testing.T) {
+	p := newTestContributePortfolio()
+
+	// Only the underweight asset is bought
+	assert.Nil(t, p.contribute(fp.NewF(1000), fp.NewF(150)))
+	assert.Equal(t, "60.00", p.Assets.Target["AAA"].fp.Qty.StringN(2))
+	assert.Equal(t, "27.00", p.Assets.Target["BBB"].fp.Qty.StringN(2))
+	assert.Equal(t, "10.00", p.Assets.Target["USD"].fp.Qty.StringN(2))
+	assert.Equal(t, "+0.00", p.Assets.Target["AAA"].Order.Qty)
+	assert.Equal(t, "+7.00", p.Assets.Target["BBB"].Order.Qty)
+}
+
+func TestContribute_DepositResidualCash(t *testing.T) {
+	p := Portfolio{currency: "USD"}
+	p.Assets.Source = AssetGroup{
+		"AAA": newTestTargetAsset(10, 70),
+		"BBB": newTestTargetAsset(400, 1),
+		"USD": newTestTargetAsset(1, 0),
+	}
+	p.Assets.Target = AssetGroup{
+		"AAA": {fp: fpAsset{Alloc: fp.NewF(50), LotSize: fp.NewF(1)}},
+		"BBB": {fp: fpAsset{Alloc: fp.NewF(50), LotSize: fp.NewF(1)}},
+	}
+
+	// The deposit is too small to buy a lot of the underweight asset, and the
+	// residual cash is not used to buy more of the overweight asset
+	assert.Nil(t, p.contribute(fp.NewF(1100), fp.NewF(200)))
+	assert.Equal(t, "70.00", p.Assets.Target["AAA"].fp.Qty.StringN(2))
+	assert.Equal(t, "1.00", p.Assets.Target["BBB"].fp.Qty.StringN(2))
+	assert.Equal(t, "200.00", p.Assets.Target["USD"].fp.Qty.StringN(2))
+}
+
+func TestContribute_Withdrawal(t *testing.T) {
+	p := newTestContributePortfolio()
+
+	// Only the overweight asset is sold, rounding up to whole lots
+	assert.Nil(t, p.contribute(fp.NewF(1000), fp.NewS("-95")))
+	assert.Equal(t, "50.00", p.Assets.Target["AAA"].fp.Qty.StringN(2))
+	assert.Equal(t, "20.00", p.Assets.Target["BBB"].fp.Qty.StringN(2))
+	assert.Equal(t, "5.00", p.Assets.Target["USD"].fp.Qty.StringN(2))
+	assert.Equal(t, "-10.00", p.Assets.Target["AAA"].Order.Qty)
+}
+
+func TestContribute_WithdrawalExceedsValue(t *testing.T) {
+	p := newTestContributePortfolio()
+	assert.NotNil(t, p.contribute(fp.NewF(1000), fp.NewF(-1001)))
+}
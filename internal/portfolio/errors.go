@@ -0,0 +1,37 @@
+package portfolio
+
+import (
+	"errors"
+
+	fp "github.com/robaho/fixed"
+)
+
+// Errors returned by the portfolio package are wrapped around one of these
+// errors, which can be checked for with errors.Is
+var (
+	ErrAccountUnavailable = errors.New("account unavailable")
+	ErrFxUnavailable      = errors.New("exchange rate unavailable")
+	ErrHistoryUnavailable = errors.New("price history unavailable")
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrInvalidAllocation  = errors.New("invalid allocation total")
+	ErrInvalidApiServer   = errors.New("invalid API server")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidFile        = errors.New("invalid file")
+	ErrInvalidValue       = errors.New("invalid value")
+	ErrOrderRejected      = errors.New("order rejected")
+	ErrUnknownSymbol      = errors.New("unknown symbol")
+)
+
+// Parses fixed point values from strings, keeping the first error so that
+// several values can be parsed before checking for errors
+type fixedParser struct {
+	err error
+}
+
+func (fpp *fixedParser) parse(key, val string) fp.Fixed {
+	f, err := newFixedFromString(key, val)
+	if err != nil && fpp.err == nil {
+		fpp.err = err
+	}
+	return f
+}
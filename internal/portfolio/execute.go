@@ -0,0 +1,129 @@
+package portfolio
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// Order types used when executing orders
+const (
+	OrderTypeLimit  = "limit"
+	OrderTypeMarket = "market"
+)
+
+// OrderExecution is the previewed impact of an order and, once the order is
+// placed, the order ID assigned by the broker
+type OrderExecution struct {
+	Action            string `json:"action"`
+	BuyingPowerEffect string `json:"buyingPowerEffect"`
+	Commission        string `json:"commission"`
+	LimitPrice        string `json:"limitPrice,omitempty"`
+	OrderId           string `json:"orderId,omitempty"`
+	Qty               string `json:"quantity"`
+	Symbol            string `json:"symbol"`
+}
+
+// IsOrderType returns true if orders can be executed with an order type
+func IsOrderType(orderType string) bool {
+	switch orderType {
+	case OrderTypeLimit, OrderTypeMarket:
+		return true
+	}
+	return false
+}
+
+// Returns the orders of the target assets that can be placed with a broker,
+// with sells before buys so that the cash raised is available for the buys.
+// Limit orders use the price found for each asset.
+func (p *Portfolio) getTradeOrders(orderType string) []stock.Order {
+	orders := []stock.Order{}
+	for _, symbol := range getSortedSymbols(p.Assets.Target) {
+		asset := p.Assets.Target[symbol]
+		if symbol == p.currency || asset.Order == nil || asset.fp.QtyDiff.Sign() == 0 {
+			continue
+		}
+
+		if strings.ToLower(asset.Type) == typeCurrency {
+			log.Warn("Skipping currency conversion order for ", symbol)
+			continue
+		}
+
+		order := stock.Order{
+			Action: stock.OrderBuy,
+			Qty:    asset.fp.QtyDiff,
+			Symbol: symbol,
+		}
+		if order.Qty.Sign() < 0 {
+			order.Action = stock.OrderSell
+			order.Qty = order.Qty.Mul(fp.NewF(-1))
+		}
+		if orderType == OrderTypeLimit {
+			order.LimitPrice = asset.fp.Price.Round(2)
+		}
+		orders = append(orders, order)
+	}
+
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].Action == stock.OrderSell && orders[j].Action != stock.OrderSell
+	})
+	return orders
+}
+
+// ExecuteOrders previews the orders of the last rebalance, contribution or
+// withdrawal in a brokerage account, and then places the orders if place is
+// true. No orders are placed unless every order preview succeeds. Orders are
+// placed one at a time, sells before buys, stopping at the first rejected
+// order. The previews and order IDs are included in the report.
+func (p *Portfolio) ExecuteOrders(accountId, orderType string, place bool) error {
+	orderApi, ok := api.NewOrderApiContext(p.Api)
+	if !ok {
+		return fmt.Errorf("%w: stock API does not support orders", ErrAccountUnavailable)
+	}
+
+	if !IsOrderType(orderType) {
+		return fmt.Errorf("%w: order type: %s", ErrInvalidValue, orderType)
+	}
+
+	orders := p.getTradeOrders(orderType)
+	executions := make([]OrderExecution, 0, len(orders))
+	for _, order := range orders {
+		impact, err := orderApi.GetOrderImpactContext(p.getContext(), accountId, order)
+		if err != nil {
+			return fmt.Errorf("%w: preview of %s %s %s: %w", ErrOrderRejected, order.Action, order.Qty.String(), order.Symbol, err)
+		}
+
+		exec := OrderExecution{
+			Action:            order.Action,
+			BuyingPowerEffect: impact.BuyingPowerEffect.Round(2).StringN(2),
+			Commission:        impact.Commission.Round(2).StringN(2),
+			Qty:               order.Qty.String(),
+			Symbol:            order.Symbol,
+		}
+		if order.LimitPrice.Sign() > 0 {
+			exec.LimitPrice = order.LimitPrice.StringN(2)
+		}
+		log.Info("Previewed order to ", exec.Action, " ", exec.Qty, " ", exec.Symbol, " with commission ", exec.Commission, " and buying power effect ", exec.BuyingPowerEffect)
+		executions = append(executions, exec)
+	}
+	p.executions = executions
+
+	if !place {
+		return nil
+	}
+
+	for i, order := range orders {
+		orderId, err := orderApi.PlaceOrderContext(p.getContext(), accountId, order)
+		if err != nil {
+			return fmt.Errorf("%w: %s %s %s (%d of %d orders placed): %w", ErrOrderRejected, order.Action, order.Qty.String(), order.Symbol, i, len(orders), err)
+		}
+		log.Info("Placed order ", orderId, " to ", order.Action, " ", order.Qty.String(), " ", order.Symbol)
+		p.executions[i].OrderId = orderId
+	}
+	return nil
+}
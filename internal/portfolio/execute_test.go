@@ -0,0 +1,111 @@
+package portfolio
+
+import (
+	"errors"
+	"strconv"
+	"syscall"
+	"testing"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Stock API that previews and places orders, rejecting orders for a symbol
+type testOrderApi struct {
+	countingApi
+	placed []stock.Order
+	reject string
+}
+
+func (a *testOrderApi) GetOrderImpact(accountId string, order stock.Order) (stock.OrderImpact, error) {
+	if order.Symbol == a.reject {
+		return stock.OrderImpact{}, syscall.EINVAL
+	}
+	return stock.OrderImpact{Commission: fp.NewS("4.95"), Price: order.LimitPrice}, nil
+}
+
+func (a *testOrderApi) PlaceOrder(accountId string, order stock.Order) (string, error) {
+	a.placed = append(a.placed, order)
+	return strconv.Itoa(1000 + len(a.placed)), nil
+}
+
+func newTestOrderPortfolio(stockApi *testOrderApi) *Portfolio {
+	newOrderAsset := func(qtyDiff, price float64) Asset {
+		return Asset{Order: &order{}, fp: fpAsset{Price: fp.NewF(price), QtyDiff: fp.NewF(qtyDiff)}}
+	}
+
+	p := Portfolio{Api: stockApi, currency: "USD"}
+	p.Assets.Target = AssetGroup{
+		"AAA": newOrderAsset(5, 10.125),
+		"BBB": newOrderAsset(-3, 20),
+		"CAD": {Order: &order{}, Type: "Currency", fp: fpAsset{QtyDiff: fp.NewF(100)}},
+		"CCC": newOrderAsset(0, 30),
+		"USD": newOrderAsset(-80, 1),
+	}
+	return &p
+}
+
+func TestIsOrderType(t *testing.T) {
+	assert.True(t, IsOrderType(OrderTypeLimit))
+	assert.True(t, IsOrderType(OrderTypeMarket))
+	assert.False(t, IsOrderType("stop"))
+}
+
+func TestGetTradeOrders(t *testing.T) {
+	p := newTestOrderPortfolio(&testOrderApi{})
+
+	// Sells are placed before buys, and cash and currencies are not traded
+	orders := p.getTradeOrders(OrderTypeLimit)
+	assert.Equal(t, 2, len(orders))
+	assert.Equal(t, "BBB", orders[0].Symbol)
+	assert.Equal(t, stock.OrderSell, orders[0].Action)
+	assert.Equal(t, "3.00", orders[0].Qty.StringN(2))
+	assert.Equal(t, "AAA", orders[1].Symbol)
+	assert.Equal(t, stock.OrderBuy, orders[1].Action)
+	assert.Equal(t, "10.13", orders[1].LimitPrice.StringN(2))
+
+	orders = p.getTradeOrders(OrderTypeMarket)
+	assert.Equal(t, 0, orders[0].LimitPrice.Sign())
+}
+
+func TestExecuteOrders_Preview(t *testing.T) {
+	stockApi := &testOrderApi{}
+	p := newTestOrderPortfolio(stockApi)
+
+	assert.Nil(t, p.ExecuteOrders("1234", OrderTypeLimit, false))
+	assert.Equal(t, 0, len(stockApi.placed))
+
+	report := p.GetReport()
+	assert.Equal(t, []OrderExecution{
+		{Action: stock.OrderSell, BuyingPowerEffect: "0.00", Commission: "4.95", LimitPrice: "20.00", Qty: "3", Symbol: "BBB"},
+		{Action: stock.OrderBuy, BuyingPowerEffect: "0.00", Commission: "4.95", LimitPrice: "10.13", Qty: "5", Symbol: "AAA"},
+	}, report.Executions)
+}
+
+func TestExecuteOrders_Place(t *testing.T) {
+	stockApi := &testOrderApi{}
+	p := newTestOrderPortfolio(stockApi)
+
+	assert.Nil(t, p.ExecuteOrders("1234", OrderTypeMarket, true))
+	assert.Equal(t, 2, len(stockApi.placed))
+	assert.Equal(t, "BBB", stockApi.placed[0].Symbol)
+	assert.Equal(t, "1001", p.executions[0].OrderId)
+	assert.Equal(t, "1002", p.executions[1].OrderId)
+	assert.Equal(t, "", p.executions[1].LimitPrice)
+}
+
+func TestExecuteOrders_Rejected(t *testing.T) {
+	stockApi := &testOrderApi{reject: "AAA"}
+	p := newTestOrderPortfolio(stockApi)
+
+	// No orders are placed unless every preview succeeds
+	assert.True(t, errors.Is(p.ExecuteOrders("1234", OrderTypeLimit, true), ErrOrderRejected))
+	assert.Equal(t, 0, len(stockApi.placed))
+}
+
+func TestExecuteOrders_Unsupported(t *testing.T) {
+	p := Portfolio{Api: &countingApi{calls: make(map[string]int)}, currency: "USD"}
+	assert.True(t, errors.Is(p.ExecuteOrders("1234", OrderTypeLimit, true), ErrAccountUnavailable))
+	assert.True(t, errors.Is(newTestOrderPortfolio(&testOrderApi{}).ExecuteOrders("1234", "stop", true), ErrInvalidValue))
+}
@@ -0,0 +1,137 @@
+package portfolio
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	fp "github.com/robaho/fixed"
+)
+
+// DefaultLookupWorkers is the default maximum number of concurrent stock API
+// lookups. Each stock API also limits its own request rate.
+const DefaultLookupWorkers = 4
+
+// Symbol, quote and exchange rate information found for an asset
+type assetLookup struct {
+	Currency string
+	Fxr      fp.Fixed
+	Name     string
+	Price    fp.Fixed
+	Type     string
+}
+
+// Assets that have already been looked up, so that each asset is only looked
+// up once by the validation, liquidation and allocation phases
+type assetLookups struct {
+	assets map[string]assetLookup
+	mtx    sync.Mutex
+}
+
+func (l *assetLookups) get(key string) (assetLookup, bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	lookup, exists := l.assets[key]
+	return lookup, exists
+}
+
+func (l *assetLookups) add(key string, lookup assetLookup) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.assets == nil {
+		l.assets = make(map[string]assetLookup)
+	}
+	l.assets[key] = lookup
+}
+
+// Currency assets are looked up differently than other assets with the same
+// symbol
+func getAssetLookupKey(symbol string, asset *Asset) string {
+	if strings.ToLower(asset.Type) == typeCurrency {
+		return typeCurrency + ":" + symbol
+	}
+	return symbol
+}
+
+// Set the symbol, quote and exchange rate information of an asset, only
+// using the stock API if the asset has not already been looked up
+func (p *Portfolio) initializeAsset(symbol string, asset *Asset) error {
+	key := getAssetLookupKey(symbol, asset)
+	if lookup, exists := p.lookups.get(key); exists {
+		asset.Currency = lookup.Currency
+		asset.Name = lookup.Name
+		asset.Type = lookup.Type
+		asset.fp.Fxr = lookup.Fxr
+		asset.fp.Price = lookup.Price
+		return nil
+	}
+
+	err := p.fetchAsset(symbol, asset)
+	if err == nil {
+		p.lookups.add(key, assetLookup{
+			Currency: asset.Currency,
+			Fxr:      asset.fp.Fxr,
+			Name:     asset.Name,
+			Price:    asset.fp.Price,
+			Type:     asset.Type,
+		})
+	}
+	return err
+}
+
+// Look up the assets of asset groups using a bounded pool of workers. Returns
+// the error of the first failed asset in symbol order.
+func (p *Portfolio) lookupAssets(groups ...AssetGroup) error {
+	type job struct {
+		asset  Asset
+		err    error
+		symbol string
+	}
+
+	keys := []string{}
+	jobs := make(map[string]*job)
+	for _, group := range groups {
+		for symbol, asset := range group {
+			key := getAssetLookupKey(symbol, &asset)
+			if _, exists := jobs[key]; !exists {
+				keys = append(keys, key)
+				jobs[key] = &job{asset: asset, symbol: symbol}
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(keys) {
+		workers = len(keys)
+	}
+
+	queue := make(chan *job)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				j.err = p.initializeAsset(j.symbol, &j.asset)
+			}
+		}()
+	}
+
+	for _, key := range keys {
+		queue <- jobs[key]
+	}
+	close(queue)
+	wg.Wait()
+
+	var err error
+	for _, key := range keys {
+		if err = jobs[key].err; err != nil {
+			break
+		}
+	}
+	return err
+}
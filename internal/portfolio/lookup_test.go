@@ -0,0 +1,120 @@
+package portfolio
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/shanebarnes/stocker/internal/stock/api/fixedrate"
+	"github.com/stretchr/testify/assert"
+)
+
+// Stock API that counts the lookups of each symbol
+type countingApi struct {
+	calls map[string]int
+	mtx   sync.Mutex
+}
+
+func (c *countingApi) count(key string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.calls[key]++
+}
+
+func (c *countingApi) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	c.count("currency:" + currency)
+	return stock.Currency{Currency: currency, Rates: map[string]fp.Fixed{currencyTo: fp.NewS("0.75")}}, nil
+}
+
+func (c *countingApi) GetHistory(symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	c.count("history:" + symbol)
+	return nil, syscall.ENOTSUP
+}
+
+func (c *countingApi) GetQuote(symbol string) (stock.Quote, error) {
+	c.count("quote:" + symbol)
+	qte := stock.Quote{Symbol: symbol}
+	qte.Prices.Latest = 10
+	return qte, nil
+}
+
+func (c *countingApi) GetSymbol(symbol string) (stock.Symbol, error) {
+	c.count("symbol:" + symbol)
+	if symbol == "ZZZZ" {
+		return stock.Symbol{}, syscall.ENOENT
+	}
+	return stock.Symbol{Currency: "USD", Symbol: symbol, Type: "Equity"}, nil
+}
+
+func (c *countingApi) RefreshCredentials() (*api.OAuthCredentials, error) {
+	return nil, syscall.ENOTSUP
+}
+
+func TestLookupAssets(t *testing.T) {
+	stockApi := &countingApi{calls: make(map[string]int)}
+	p := Portfolio{Api: stockApi, currency: "USD", Workers: 3}
+	p.Assets.Source = AssetGroup{"AAA": {}, "BBB": {}, "CAD": {Type: "Currency"}}
+	p.Assets.Target = AssetGroup{"AAA": {}, "CCC": {}, "DDD": {}}
+
+	assert.Nil(t, p.lookupAssets(p.Assets.Source, p.Assets.Target))
+
+	// Looked up assets are reused
+	asset := Asset{Type: "Currency"}
+	assert.Nil(t, p.initializeAsset("CAD", &asset))
+	assert.Equal(t, "0.75", asset.fp.Fxr.StringN(2))
+	asset = Asset{}
+	assert.Nil(t, p.initializeAsset("AAA", &asset))
+	assert.Equal(t, "10.00", asset.fp.Price.StringN(2))
+	assert.Equal(t, "Equity", asset.Type)
+
+	assert.Equal(t, map[string]int{
+		"currency:CAD": 1,
+		"quote:AAA":    1, "quote:BBB": 1, "quote:CCC": 1, "quote:DDD": 1,
+		"symbol:AAA": 1, "symbol:BBB": 1, "symbol:CCC": 1, "symbol:DDD": 1,
+	}, stockApi.calls)
+}
+
+func TestLookupAssets_Error(t *testing.T) {
+	stockApi := &countingApi{calls: make(map[string]int)}
+	p := Portfolio{Api: stockApi, currency: "USD"}
+	p.Assets.Source = AssetGroup{"AAA": {}, "ZZZZ": {}}
+
+	err := p.lookupAssets(p.Assets.Source)
+	assert.True(t, errors.Is(err, ErrUnknownSymbol))
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+}
+
+func TestLookupAssets_Context(t *testing.T) {
+	stockApi := &countingApi{calls: make(map[string]int)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := Portfolio{Api: stockApi, Context: ctx, currency: "USD", Workers: 2}
+	p.Assets.Target = AssetGroup{"AAA": {}, "BBB": {}}
+
+	// Cancelled lookups are not reported as unknown symbols
+	err := p.lookupAssets(p.Assets.Target)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, errors.Is(err, ErrUnknownSymbol))
+	assert.Empty(t, stockApi.calls)
+}
+
+func TestLookupAssets_Fx(t *testing.T) {
+	stockApi := &countingApi{calls: make(map[string]int)}
+	fx, err := fixedrate.NewFxFixedRate("fixed:CAD/USD=0.74")
+	assert.Nil(t, err)
+	p := Portfolio{Api: stockApi, currency: "USD", Fx: fx}
+	p.Assets.Source = AssetGroup{"CAD": {Type: "Currency"}}
+
+	// Exchange rates are looked up with the exchange rate API
+	assert.Nil(t, p.lookupAssets(p.Assets.Source))
+	asset := Asset{Type: "Currency"}
+	assert.Nil(t, p.initializeAsset("CAD", &asset))
+	assert.Equal(t, "0.74", asset.fp.Fxr.StringN(2))
+	assert.Equal(t, 0, stockApi.calls["currency:CAD"])
+}
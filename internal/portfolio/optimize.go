@@ -0,0 +1,119 @@
+package portfolio
+
+import (
+	"math"
+
+	fp "github.com/robaho/fixed"
+	log "github.com/sirupsen/logrus"
+)
+
+// Difference between the actual and target allocations of a portfolio
+type allocationDeviation struct {
+	Before fp.Fixed // Before residual cash is redistributed
+	After  fp.Fixed // After residual cash is redistributed
+}
+
+// Allocation percentage of a market value within the total funds
+func getAllocation(marketValue, funds fp.Fixed) fp.Fixed {
+	return marketValue.Mul(fp.NewF(100)).Div(funds)
+}
+
+// Root sum of squared differences (in percentage points) between the actual
+// and target allocations of all target assets, including residual cash
+func (p *Portfolio) getAllocationDeviation(funds, cashLeft fp.Fixed, targetAlloc map[string]fp.Fixed) fp.Fixed {
+	deviation := fp.NewF(0)
+	for symbol, alloc := range targetAlloc {
+		var actual fp.Fixed
+		if symbol == p.currency {
+			actual = getAllocation(cashLeft, funds)
+		} else {
+			actual = getAllocation(p.Assets.Target[symbol].fp.MarketValue, funds)
+		}
+		diff := actual.Sub(alloc)
+		deviation = deviation.Add(diff.Mul(diff))
+	}
+	return fp.NewF(math.Sqrt(deviation.Float()))
+}
+
+// Greedily buy additional lots of the target assets with cash left over after
+// rounding target quantities down to whole lots. Each purchase is the one that
+// most reduces the squared tracking error against the target allocations, and
+// purchases stop once no further lot is affordable or improves the tracking
+// error. With underweightOnly, assets at or above their target allocations are
+// never bought. Returns the cash left after all purchases.
+func (p *Portfolio) redistributeResidualCash(funds, cashLeft fp.Fixed, targetAlloc map[string]fp.Fixed, underweightOnly bool) fp.Fixed {
+	zero := fp.NewF(0)
+	if funds.LessThanOrEqual(zero) {
+		return cashLeft
+	}
+
+	p.deviation = &allocationDeviation{Before: p.getAllocationDeviation(funds, cashLeft, targetAlloc)}
+
+	for {
+		best := ""
+		bestGain := zero
+		bestCost := zero
+		bestQty := zero
+
+		cashDev := getAllocation(cashLeft, funds).Sub(targetAlloc[p.currency])
+		for symbol, alloc := range targetAlloc {
+			asset := p.Assets.Target[symbol]
+			if symbol == p.currency || asset.Type == typeCurrency || asset.fp.InBand || asset.fp.LotSize.Sign() <= 0 || asset.fp.Price.Sign() <= 0 {
+				continue
+			}
+
+			lotCost := asset.fp.LotSize.Mul(asset.fp.Price).Mul(asset.fp.Fxr)
+			if lotCost.GreaterThan(cashLeft) {
+				continue
+			}
+
+			assetDev := getAllocation(asset.fp.MarketValue, funds).Sub(alloc)
+			if underweightOnly && assetDev.Sign() >= 0 {
+				continue
+			}
+
+			// Moving half of the difference between the cash and asset
+			// deviations from cash into the asset minimizes their combined
+			// squared deviation. Buy at least one lot and no more than the
+			// cash left.
+			shift := funds.Mul(cashDev.Sub(assetDev)).Div(fp.NewF(200))
+			lots := roundDownToLotSize(shift.Div(lotCost), fp.NewF(1))
+			if lots.LessThan(fp.NewF(1)) {
+				lots = fp.NewF(1)
+			} else if maxLots := roundDownToLotSize(cashLeft.Div(lotCost), fp.NewF(1)); lots.GreaterThan(maxLots) {
+				lots = maxLots
+			}
+			cost := lotCost.Mul(lots)
+
+			newAssetDev := getAllocation(asset.fp.MarketValue.Add(cost), funds).Sub(alloc)
+			newCashDev := getAllocation(cashLeft.Sub(cost), funds).Sub(targetAlloc[p.currency])
+
+			gain := assetDev.Mul(assetDev).Add(cashDev.Mul(cashDev))
+			gain = gain.Sub(newAssetDev.Mul(newAssetDev)).Sub(newCashDev.Mul(newCashDev))
+			if gain.GreaterThan(bestGain) {
+				best = symbol
+				bestGain = gain
+				bestCost = cost
+				bestQty = asset.fp.LotSize.Mul(lots)
+			}
+		}
+
+		if len(best) == 0 {
+			break
+		}
+
+		asset := p.Assets.Target[best]
+		asset.fp.Qty = asset.fp.Qty.Add(bestQty)
+		asset.fp.MarketValue = asset.fp.MarketValue.Add(bestCost)
+		asset.fp.Alloc = getAllocation(asset.fp.MarketValue, funds)
+		p.Assets.Target[best] = asset
+		cashLeft = cashLeft.Sub(bestCost)
+		log.Debug(best, ": buying an additional ", bestQty.String(), " units with residual cash")
+	}
+
+	p.deviation.After = p.getAllocationDeviation(funds, cashLeft, targetAlloc)
+	log.Debug("Target allocation deviation before redistributing residual cash: ", p.deviation.Before.Round(4).StringN(4), "%")
+	log.Debug("Target allocation deviation after redistributing residual cash: ", p.deviation.After.Round(4).StringN(4), "%")
+
+	return cashLeft
+}
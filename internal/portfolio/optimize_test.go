@@ -0,0 +1,64 @@
+package portfolio
+
+import (
+	"testing"
+
+	fp "github.com/robaho/fixed"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTargetAsset(price, qty float64) Asset {
+	return Asset{fp: fpAsset{
+		Fxr:         fp.NewF(1),
+		LotSize:     fp.NewF(1),
+		MarketValue: fp.NewF(price * qty),
+		Price:       fp.NewF(price),
+		Qty:         fp.NewF(qty),
+	}}
+}
+
+func TestRedistributeResidualCash(t *testing.T) {
+	p := Portfolio{currency: "USD"}
+	p.Assets.Target = AssetGroup{
+		"AAA": newTestTargetAsset(40, 12),
+		"BBB": newTestTargetAsset(90, 5),
+	}
+	targetAlloc := map[string]fp.Fixed{"AAA": fp.NewF(50), "BBB": fp.NewF(50), "USD": fp.NewF(0)}
+
+	cashLeft := p.redistributeResidualCash(fp.NewF(1000), fp.NewF(70), targetAlloc, false)
+	assert.Equal(t, "30.00", cashLeft.StringN(2))
+	assert.Equal(t, "13.00", p.Assets.Target["AAA"].fp.Qty.StringN(2))
+	assert.Equal(t, "5.00", p.Assets.Target["BBB"].fp.Qty.StringN(2))
+	assert.Equal(t, "52.00", p.Assets.Target["AAA"].fp.Alloc.StringN(2))
+	assert.Equal(t, "8.8318", p.deviation.Before.Round(4).StringN(4))
+	assert.Equal(t, "6.1644", p.deviation.After.Round(4).StringN(4))
+}
+
+func TestRedistributeResidualCash_CashTarget(t *testing.T) {
+	p := Portfolio{currency: "USD"}
+	p.Assets.Target = AssetGroup{
+		"AAA": newTestTargetAsset(40, 12),
+	}
+	targetAlloc := map[string]fp.Fixed{"AAA": fp.NewF(50), "USD": fp.NewF(50)}
+
+	// Buying more would move cash further from its target allocation
+	cashLeft := p.redistributeResidualCash(fp.NewF(1000), fp.NewF(520), targetAlloc, false)
+	assert.Equal(t, "520.00", cashLeft.StringN(2))
+	assert.Equal(t, "12.00", p.Assets.Target["AAA"].fp.Qty.StringN(2))
+}
+
+func TestRedistributeResidualCash_MultipleLots(t *testing.T) {
+	p := Portfolio{currency: "USD"}
+	p.Assets.Target = AssetGroup{
+		"AAA": newTestTargetAsset(1, 0),
+	}
+	asset := p.Assets.Target["AAA"]
+	asset.fp.LotSize = fp.NewS("0.01")
+	p.Assets.Target["AAA"] = asset
+	targetAlloc := map[string]fp.Fixed{"AAA": fp.NewF(100)}
+
+	cashLeft := p.redistributeResidualCash(fp.NewF(1000), fp.NewF(1000), targetAlloc, false)
+	assert.Equal(t, "0.00", cashLeft.StringN(2))
+	assert.Equal(t, "1000.00", p.Assets.Target["AAA"].fp.Qty.StringN(2))
+	assert.Equal(t, "0.0000", p.deviation.After.Round(4).StringN(4))
+}
@@ -1,28 +1,43 @@
 package portfolio
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"strings"
 	"syscall"
 
 	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/credentials"
 	"github.com/shanebarnes/stocker/internal/stock"
 	"github.com/shanebarnes/stocker/internal/stock/api"
 	av "github.com/shanebarnes/stocker/internal/stock/api/alphavantage"
+	"github.com/shanebarnes/stocker/internal/stock/api/exchangerate"
+	"github.com/shanebarnes/stocker/internal/stock/api/exchangeratesapi"
+	"github.com/shanebarnes/stocker/internal/stock/api/fallback"
+	"github.com/shanebarnes/stocker/internal/stock/api/fixedrate"
 	qt "github.com/shanebarnes/stocker/internal/stock/api/questrade"
+	"github.com/shanebarnes/stocker/internal/stock/api/snapshot"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
 	typeCurrency = "currency"
+
+	// Default number of units in a lot (whole shares)
+	defaultLotSize = 1
 )
 
 // Used for internal fixed point representation of assets
 type fpAsset struct {
 	Alloc       fp.Fixed
+	Band        fpBand
 	Fxr         fp.Fixed
+	InBand      bool
+	LotSize     fp.Fixed
 	MarketValue fp.Fixed
 	Price       fp.Fixed
 	PriceDiff   fp.Fixed
@@ -37,9 +52,11 @@ type order struct {
 
 type Asset struct {
 	Alloc       string `json:"allocation"`
+	Band        *Band  `json:"band,omitempty"`
 	Currency    string `json:"currency"`
 	fp          fpAsset
 	Fxr         string `json:"exchangeRate"`
+	LotSize     string `json:"lotSize,omitempty"`
 	MarketValue string `json:"marketValue"`
 	Name        string `json:"name"`
 	Order       *order `json:"order,omitempty"`
@@ -57,9 +74,20 @@ type AssetRebalance struct {
 }
 
 type Portfolio struct {
-	Api      api.StockApi
-	Assets   AssetRebalance `json:"assets"`
-	currency string
+	Api        api.StockApi
+	Assets     AssetRebalance `json:"assets"`
+	Band       *Band          `json:"band,omitempty"` // Default band of all assets
+	band       fpBand
+	Context    context.Context `json:"-"` // Cancels stock API requests once done, or never if not provided
+	currency   string
+	deviation  *allocationDeviation // Set once residual cash is redistributed
+	executions []OrderExecution
+	Fx         api.FxApi `json:"-"`                 // Exchange rate API, or the stock API if not provided
+	LotSize    string    `json:"lotSize,omitempty"` // Default lot size of all assets
+	lookups    assetLookups
+	lotSize    fp.Fixed
+	UseBands   bool `json:"-"` // Only rebalance assets that have drifted outside of their band
+	Workers    int  `json:"-"` // Maximum number of concurrent stock API lookups
 }
 
 func (p *Portfolio) allocate(funds fp.Fixed) error {
@@ -67,47 +95,46 @@ func (p *Portfolio) allocate(funds fp.Fixed) error {
 	allocation := fp.NewF(0)
 
 	log.Info("Re-allocating source assets to match target allocations")
-	// Create new target cash asset if it does not already exist
-	cash, exists := p.Assets.Target[p.currency]
-	if exists {
-		cash.fp.Price = fp.NewF(1)
-		cash.fp.Fxr = fp.NewF(1)
-	} else {
-		cash = Asset{
-			fp:   fpAsset{Alloc: fp.NewF(0), Price: fp.NewF(1), Fxr: fp.NewF(1)},
-			Type: typeCurrency,
-		}
-	}
-
-	cash.Currency = p.currency
-	cash.Name = p.currency
+	cash := p.getTargetCash()
 	cash.fp.Qty = funds
 	p.Assets.Target[p.currency] = cash
 
-	for _, v := range p.Assets.Target {
+	// Remember target allocations before they are replaced by actual allocations
+	targetAlloc := make(map[string]fp.Fixed)
+	for k, v := range p.Assets.Target {
 		allocation = allocation.Add(v.fp.Alloc)
+		targetAlloc[k] = v.fp.Alloc
 	}
 
 	cashLeft := cash.fp.Qty
 
 	if allocation.Equal(fp.NewF(100)) {
+		// Funds available to target assets and their total target allocation
+		budget := funds
+		budgetAlloc := fp.NewF(100)
+		if p.UseBands {
+			budget, budgetAlloc = p.holdAssetsInBand(funds)
+		}
+
 		for symbol, asset := range p.Assets.Target {
-			if symbol != p.currency && asset.fp.Alloc.GreaterThan(fp.NewF(0)) {
+			if asset.fp.InBand {
+				cashLeft = cashLeft.Sub(asset.fp.MarketValue)
+			} else if symbol != p.currency && asset.fp.Alloc.GreaterThan(fp.NewF(0)) {
 				if asset.fp.Price.LessThanOrEqual(fp.NewF(0)) {
 					err = p.initializeAsset(symbol, &asset)
 				}
 
 				if err == nil && asset.fp.Price.GreaterThan(fp.NewF(0)) {
-					// asset.Qty = math.Floor(cash.Qty * asset.Alloc / 100. / (asset.Price * asset.Fxr))
-					qty := cash.fp.Qty.Mul(asset.fp.Alloc)
-					qty = qty.Div(fp.NewF(100))
+					// asset.Qty = math.Floor(budget * asset.Alloc / budgetAlloc / (asset.Price * asset.Fxr))
+					qty := budget.Mul(asset.fp.Alloc)
+					qty = qty.Div(budgetAlloc)
 					qty = qty.Div(asset.fp.Price.Mul(asset.fp.Fxr))
 
-					// Currency quantities do not need to be integers
+					// Currency quantities do not need to be a multiple of a lot size
 					if asset.Type == typeCurrency {
 						asset.fp.Qty = qty
 					} else {
-						asset.fp.Qty = fp.NewI(qty.Int(), 0)
+						asset.fp.Qty = roundDownToLotSize(qty, asset.fp.LotSize)
 					}
 
 					// asset.MarketValue = math.Round(asset.Qty * asset.Price * asset.Fxr)
@@ -125,30 +152,38 @@ func (p *Portfolio) allocate(funds fp.Fixed) error {
 			p.Assets.Target[symbol] = asset
 		}
 
-		cash.fp.MarketValue = cashLeft
-		// cash.Alloc = math.Round(cash.MarketValue * 100. / cash.Qty)
-		cash.fp.Alloc = cash.fp.MarketValue.Mul(fp.NewF(100))
-		cash.fp.Alloc = cash.fp.Alloc.Div(cash.fp.Qty)
-		cash.fp.Qty = cashLeft
-		p.Assets.Target[p.currency] = cash
-		p.diffAssets(&p.Assets.Source, &p.Assets.Target)
-		p.copyAssetFixedToStrings(&p.Assets.Target)
-		log.Info("target portfolio:", GetPrettyString(p.Assets.Target))
-		log.Info("Target assets total market value: ", funds.Round(2).StringN(2), p.currency)
+		cashLeft = p.redistributeResidualCash(cash.fp.Qty, cashLeft, targetAlloc, false)
+		p.completeTarget(cash, cashLeft, funds)
 	} else {
-		err = fmt.Errorf("Invalid portfolio allocation total: %s", allocation.Round(2).StringN(2))
+		err = fmt.Errorf("%w: %s", ErrInvalidAllocation, allocation.Round(2).StringN(2))
 	}
 
 	return err
 }
 
+// Set the cash left in the target assets and find the orders needed to turn
+// the source assets into the target assets
+func (p *Portfolio) completeTarget(cash Asset, cashLeft, funds fp.Fixed) {
+	cash.fp.MarketValue = cashLeft
+	// cash.Alloc = math.Round(cash.MarketValue * 100. / funds)
+	if funds.GreaterThan(fp.NewF(0)) {
+		cash.fp.Alloc = getAllocation(cash.fp.MarketValue, funds)
+	}
+	cash.fp.Qty = cashLeft
+	p.Assets.Target[p.currency] = cash
+	p.diffAssets(&p.Assets.Source, &p.Assets.Target)
+	p.copyAssetFixedToStrings(&p.Assets.Target)
+	log.Info("target portfolio:", GetPrettyString(p.Assets.Target))
+	log.Info("Target assets total market value: ", funds.Round(2).StringN(2), p.currency)
+}
+
 func (p *Portfolio) copyAssetFixedToStrings(group *AssetGroup) {
 	for symbol, asset := range *group {
 		asset.Alloc = asset.fp.Alloc.Round(4).StringN(4) + "%"
 		asset.Fxr = asset.fp.Fxr.Round(4).StringN(4)
 		asset.MarketValue = asset.fp.MarketValue.Round(2).StringN(2) + p.currency
 		asset.Price = asset.fp.Price.Round(2).StringN(2)
-		asset.Qty = asset.fp.Qty.Round(2).StringN(2)
+		asset.Qty = asset.fp.Qty.Round(getQtyPlaces(&asset)).StringN(getQtyPlaces(&asset))
 		(*group)[symbol] = asset
 	}
 }
@@ -175,6 +210,13 @@ func (p *Portfolio) diffAssets(source, target *AssetGroup) {
 		}
 		tgtAsset.fp.PriceDiff = tgtAsset.fp.QtyDiff.Mul(tgtAsset.fp.Price).Mul(tgtAsset.fp.Fxr)
 
+		// Assets within their band are not traded
+		if tgtAsset.fp.InBand {
+			tgtAsset.Order = nil
+			(*target)[symbol] = tgtAsset
+			continue
+		}
+
 		sign := ""
 		if tgtAsset.fp.QtyDiff.Sign() != -1 {
 			sign = "+"
@@ -182,20 +224,51 @@ func (p *Portfolio) diffAssets(source, target *AssetGroup) {
 
 		tgtAsset.Order = &order{}
 		tgtAsset.Order.MarketValue = sign + tgtAsset.fp.PriceDiff.Round(2).StringN(2) + p.currency
-		tgtAsset.Order.Qty = sign + tgtAsset.fp.QtyDiff.Round(2).StringN(2)
+		tgtAsset.Order.Qty = sign + tgtAsset.fp.QtyDiff.Round(getQtyPlaces(&tgtAsset)).StringN(getQtyPlaces(&tgtAsset))
 		(*target)[symbol] = tgtAsset
 	}
 }
 
-func (p *Portfolio) copyAssetStringsToFixed(group *AssetGroup) {
-	for i, asset := range *group {
-		asset.fp.Alloc = newFixedFromString("alloc", asset.Alloc)
-		asset.fp.Fxr = newFixedFromString("fxr", asset.Fxr)
-		asset.fp.MarketValue = newFixedFromString("mvp", asset.MarketValue)
-		asset.fp.Price = newFixedFromString("price", asset.Price)
-		asset.fp.Qty = newFixedFromString("qty", asset.Qty)
-		(*group)[i] = asset
+func (p *Portfolio) copyAssetStringsToFixed(group *AssetGroup) error {
+	var err error
+	for symbol, asset := range *group {
+		var parser fixedParser
+		asset.fp.Alloc = parser.parse(symbol+".allocation", asset.Alloc)
+		asset.fp.Fxr = parser.parse(symbol+".exchangeRate", asset.Fxr)
+		if len(asset.LotSize) > 0 {
+			asset.fp.LotSize = parser.parse(symbol+".lotSize", asset.LotSize)
+		} else {
+			asset.fp.LotSize = p.lotSize
+		}
+		asset.fp.MarketValue = parser.parse(symbol+".marketValue", asset.MarketValue)
+		asset.fp.Price = parser.parse(symbol+".price", asset.Price)
+		asset.fp.Qty = parser.parse(symbol+".quantity", asset.Qty)
+		if err = parser.err; err == nil {
+			asset.fp.Band, err = newFpBand(asset.Band, p.band)
+		}
+		if err != nil {
+			break
+		}
+		(*group)[symbol] = asset
+	}
+	return err
+}
+
+// Number of decimal places needed to display an asset quantity
+func getQtyPlaces(asset *Asset) int {
+	places := 2
+	if asset.Type != typeCurrency {
+		if asset.fp.LotSize.Sign() == 0 {
+			places = 6
+		} else {
+			// Show enough decimal places for fractional lot sizes
+			lot := asset.fp.LotSize
+			for places < 6 && !lot.Round(places).Equal(lot) {
+				places++
+			}
+		}
 	}
+	return places
 }
 
 func GetPrettyString(v interface{}) string {
@@ -207,14 +280,35 @@ func GetPrettyString(v interface{}) string {
 	return str
 }
 
-func getStockApi(apiKey, apiServer string, creds api.OAuthCredentials) (api.StockApi, error) {
+// Returns a persistent cache for a stock API if a cache directory is provided
+func getStockApiCache(cacheDir, name string) (*stock.Cache, error) {
+	if len(cacheDir) == 0 {
+		return stock.NewCache(), nil
+	}
+
+	cache, err := stock.NewFileCache(filepath.Join(cacheDir, name+stock.CacheFileExt), stock.DefaultCacheTtl())
+	if err != nil {
+		log.Warn("Ignoring invalid cache file: ", err)
+		err = cache.Clear()
+	}
+	return cache, err
+}
+
+func getStockApi(apiKey, apiServer string, creds api.OAuthCredentials, store api.CredentialsStore, cacheDir string) (api.StockApi, error) {
 	var api api.StockApi
+	var cache *stock.Cache
 	var err error
 
 	if av.IsApiAlphavantage(apiServer) {
-		api = av.NewApiAlphavantage(apiKey)
+		if cache, err = getStockApiCache(cacheDir, "alphavantage"); err == nil {
+			api = av.NewApiAlphavantage(apiKey, cache)
+		}
 	} else if qt.IsApiQuestrade(apiServer) {
-		api = qt.NewApiQuestrade(apiKey, apiServer, creds)
+		if cache, err = getStockApiCache(cacheDir, "questrade"); err == nil {
+			api = qt.NewApiQuestrade(apiKey, apiServer, creds, cache, store)
+		}
+	} else if snapshot.IsApiSnapshot(apiServer) {
+		api, err = snapshot.NewApiSnapshot(apiServer)
 	} else {
 		err = syscall.EINVAL
 	}
@@ -222,10 +316,48 @@ func getStockApi(apiKey, apiServer string, creds api.OAuthCredentials) (api.Stoc
 	return api, err
 }
 
-func (p *Portfolio) initializeAsset(symbol string, asset *Asset) error {
+// Returns the target cash asset, creating it if it does not already exist
+func (p *Portfolio) getTargetCash() Asset {
+	cash, exists := p.Assets.Target[p.currency]
+	if exists {
+		cash.fp.Price = fp.NewF(1)
+		cash.fp.Fxr = fp.NewF(1)
+	} else {
+		cash = Asset{
+			fp:   fpAsset{Alloc: fp.NewF(0), Price: fp.NewF(1), Fxr: fp.NewF(1)},
+			Type: typeCurrency,
+		}
+	}
+
+	cash.Currency = p.currency
+	cash.Name = p.currency
+	return cash
+}
+
+// Returns the context of stock API requests
+func (p *Portfolio) getContext() context.Context {
+	if p.Context != nil {
+		return p.Context
+	}
+	return context.Background()
+}
+
+// Returns the exchange rate API
+func (p *Portfolio) getFxApi() api.FxApi {
+	if p.Fx != nil {
+		return p.Fx
+	}
+	return p.Api
+}
+
+// Look up the symbol, quote and exchange rate information of an asset using
+// the stock API
+func (p *Portfolio) fetchAsset(symbol string, asset *Asset) error {
 	var err error
 	var search stock.Symbol
 
+	ctx := p.getContext()
+	stockApi := api.NewStockApiContext(p.Api)
 	log.Debug(symbol, ": searching for symbol information")
 
 	asset.Type = strings.ToLower(asset.Type)
@@ -236,10 +368,10 @@ func (p *Portfolio) initializeAsset(symbol string, asset *Asset) error {
 		asset.Name = symbol
 		asset.Type = typeCurrency
 		log.Debug(symbol, ": ", asset)
-	} else if search, err = p.Api.GetSymbol(symbol); err == nil {
+	} else if search, err = stockApi.GetSymbolContext(ctx, symbol); err == nil {
 		log.Debug(symbol, ": searching for symbol quote information")
 		var quote stock.Quote
-		if quote, err = p.Api.GetQuote(symbol); err == nil {
+		if quote, err = stockApi.GetQuoteContext(ctx, symbol); err == nil {
 			asset.fp.Price = fp.NewF(quote.Prices.Latest)
 		}
 
@@ -255,18 +387,25 @@ func (p *Portfolio) initializeAsset(symbol string, asset *Asset) error {
 		} else {
 			log.Debug(symbol, ": searching for exchange rate from ", search.Currency, " to ", p.currency)
 			var ccy stock.Currency
-			ccy, err = p.Api.GetCurrency(search.Currency, p.currency)
+			ccy, err = api.NewFxApiContext(p.getFxApi()).GetCurrencyContext(ctx, search.Currency, p.currency)
 			if err == nil {
 				asset.fp.Fxr = ccy.Rates[p.currency]
 				//asset.fp.Fxr, err = p.getExchangeRate(search.Currency)
+			} else if ctx.Err() != nil {
+				err = fmt.Errorf("exchange rate from %s to %s for %s: %w", search.Currency, p.currency, symbol, err)
 			} else {
 				log.Debug("Error getting currency ", symbol, ": ", err)
+				err = fmt.Errorf("%w: %s to %s for %s: %w", ErrFxUnavailable, search.Currency, p.currency, symbol, err)
 			}
 		}
+	} else if errors.Is(err, api.ErrRefreshTokenInvalid) {
+		err = fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	} else if ctx.Err() != nil {
+		// The symbol may exist, but the lookup was cancelled
+		err = fmt.Errorf("%s: %w", symbol, err)
 	} else {
 		log.Debug("Error getting symbol ", symbol, ": ", err)
-		// TODO: Wrap error?
-		//err = fmt.Errorf("%v: %w", err, syscall.EACCES)
+		err = fmt.Errorf("%w: %s: %w", ErrUnknownSymbol, symbol, err)
 	}
 
 	return err
@@ -287,7 +426,6 @@ func (p *Portfolio) liquidate() (fp.Fixed, error) {
 			asset.fp.MarketValue = mvp
 			p.Assets.Source[symbol] = asset
 		} else {
-			log.Fatal("Error liquidating source assets:", err)
 			break
 		}
 	}
@@ -303,108 +441,277 @@ func (p *Portfolio) liquidate() (fp.Fixed, error) {
 		}
 	}
 
-	if cash.LessThan(fp.NewF(0)) {
-		log.Fatal("Source assets cannot be liquidated")
+	if err == nil && cash.LessThan(fp.NewF(0)) {
+		err = fmt.Errorf("%w: source assets total market value of %s%s", ErrInvalidValue, cash.Round(2).StringN(2), p.currency)
 	}
 
-	p.copyAssetFixedToStrings(&p.Assets.Source)
-	log.Info("source portfolio:", GetPrettyString(p.Assets.Source))
-	log.Info("Source assets total market value: ", cash.Round(2).StringN(2), p.currency)
+	if err == nil {
+		p.copyAssetFixedToStrings(&p.Assets.Source)
+		log.Info("source portfolio:", GetPrettyString(p.Assets.Source))
+		log.Info("Source assets total market value: ", cash.Round(2).StringN(2), p.currency)
+	}
 
 	return cash, err
 }
 
-func newFixedFromString(key, val string) fp.Fixed {
+func newFixedFromString(key, val string) (fp.Fixed, error) {
 	if len(val) == 0 {
-		return fp.NewF(0)
+		return fp.NewF(0), nil
 	}
-	fp, err := fp.NewSErr(val)
+	f, err := fp.NewSErr(val)
 	if err != nil {
-		log.Fatal(key, ": invalid value ", val)
+		err = fmt.Errorf("%w: %s: %s", ErrInvalidValue, key, val)
 	}
 
-	return fp
+	return f, err
+}
+
+// NewStockApi creates the stock API of a stock API server. OAuth credentials
+// are loaded from the credentials file (if any), and refreshed credentials are
+// saved back to it since refresh tokens can only be used once. Stock API
+// responses are cached in the cache directory, or only in memory if no cache
+// directory is provided.
+func NewStockApi(apiKey, apiServer, oauthCredsFile string, oauthRefresh bool, cacheDir string) (api.StockApi, error) {
+	return NewFallbackStockApi(apiKey, apiServer, nil, oauthCredsFile, oauthRefresh, cacheDir)
 }
 
-func NewPortfolio(filename, apiKey, apiServer, oauthCredsFile string, oauthRefresh bool, currency string) (*Portfolio, error) {
+// Load the credentials of a credentials file, if any
+func loadCredentials(oauthCredsFile string) (api.OAuthCredentials, api.CredentialsStore, error) {
 	creds := api.OAuthCredentials{}
+	var store api.CredentialsStore
 	if len(oauthCredsFile) > 0 {
-		file, err := ioutil.ReadFile(oauthCredsFile)
-		if err == nil {
-			err = json.Unmarshal([]byte(file), &creds)
+		var err error
+		store = credentials.NewFileStore(oauthCredsFile, credentials.GetPassphraseFromEnv())
+		if creds, err = store.Load(); err != nil {
+			return creds, nil, fmt.Errorf("%w: credentials file %s: %w", ErrInvalidFile, oauthCredsFile, err)
 		}
+	}
+	return creds, store, nil
+}
 
-		if err != nil {
-			log.Fatal("Invalid credentials file:", err)
+// NewFallbackStockApi creates a stock API that tries the quote servers in order
+// for symbols, quotes and price history, failing over to the next server if a
+// server returns an error. The stock API server is used if there are no quote
+// servers, and for exchange rates, accounts and orders. Only the stock API of
+// the stock API server is created if there are no other servers (see
+// NewStockApi).
+func NewFallbackStockApi(apiKey, apiServer string, quoteServers []string, oauthCredsFile string, oauthRefresh bool, cacheDir string) (api.StockApi, error) {
+	return NewFallbackStockApiContext(context.Background(), apiKey, apiServer, quoteServers, oauthCredsFile, oauthRefresh, cacheDir)
+}
+
+// NewFallbackStockApiContext creates a fallback stock API, refreshing its
+// credentials (if requested) until the context is done
+func NewFallbackStockApiContext(ctx context.Context, apiKey, apiServer string, quoteServers []string, oauthCredsFile string, oauthRefresh bool, cacheDir string) (api.StockApi, error) {
+	creds, store, err := loadCredentials(oauthCredsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each stock API server is only created once
+	providers := map[string]fallback.Provider{}
+	getProviders := func(servers []string) ([]fallback.Provider, error) {
+		list := []fallback.Provider{}
+		for _, server := range servers {
+			provider, exists := providers[server]
+			if !exists {
+				stockApi, err := getStockApi(apiKey, server, creds, store, cacheDir)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %s: %w", ErrInvalidApiServer, server, err)
+				}
+				provider = fallback.Provider{Api: stockApi, Name: server}
+				providers[server] = provider
+			}
+			list = append(list, provider)
 		}
+		return list, nil
 	}
 
-	api, err := getStockApi(apiKey, apiServer, creds)
+	var primary, quotes []fallback.Provider
+	if primary, err = getProviders([]string{apiServer}); err == nil {
+		quotes, err = getProviders(quoteServers)
+	}
 	if err != nil {
-		log.Fatal("Invalid API server: ", apiServer)
+		return nil, err
+	}
+
+	stockApi := primary[0].Api
+	if len(providers) > 1 {
+		stockApi = fallback.NewApiFallback(primary[0], map[string][]fallback.Provider{
+			fallback.OperationHistory: quotes,
+			fallback.OperationQuote:   quotes,
+			fallback.OperationSymbol:  quotes,
+		})
 	}
 
 	if oauthRefresh {
-		if refreshCreds, err := api.RefreshCredentials(); err == nil {
-			ioutil.WriteFile(oauthCredsFile, []byte(GetPrettyString(refreshCreds)), 0644)
-		} else {
-			log.Fatal("Failed to refresh credentials:", err)
+		if _, err := api.NewStockApiContext(stockApi).RefreshCredentialsContext(ctx); err != nil {
+			return nil, fmt.Errorf("%w: failed to refresh credentials: %w", ErrInvalidCredentials, err)
+		}
+	}
+	return stockApi, nil
+}
+
+// Returns the exchange rate API of an exchange rate server
+func getFxApi(fxApiKey, fxServer, apiKey, cacheDir string) (api.FxApi, error) {
+	var fx api.FxApi
+	var cache *stock.Cache
+	var err error
+
+	if exchangerate.IsApiExchangerate(fxServer) {
+		if cache, err = getStockApiCache(cacheDir, "exchangerate"); err == nil {
+			fx = exchangerate.NewFxExchangerate(fxApiKey, cache)
+		}
+	} else if exchangeratesapi.IsApiExchangeratesapi(fxServer) {
+		if len(fxApiKey) == 0 {
+			err = fmt.Errorf("access key required: %w", syscall.EINVAL)
+		} else if cache, err = getStockApiCache(cacheDir, "exchangeratesapi"); err == nil {
+			fx = exchangeratesapi.NewFxExchangeratesapi(fxApiKey, cache)
+		}
+	} else if fixedrate.IsApiFixedRate(fxServer) {
+		fx, err = fixedrate.NewFxFixedRate(fxServer)
+	} else if av.IsApiAlphavantage(fxServer) || snapshot.IsApiSnapshot(fxServer) {
+		fx, err = getStockApi(apiKey, fxServer, api.OAuthCredentials{}, nil, cacheDir)
+	} else {
+		err = syscall.EINVAL
+	}
+
+	return fx, err
+}
+
+// NewFxApi creates an exchange rate API that tries the exchange rate servers in
+// order, failing over to the next server if a server returns an error. The
+// servers can be exchangerate.host, exchangeratesapi.io (which requires an
+// access key), a fixed table of exchange rates (e.g. fixed:CAD/USD=0.74), or
+// the alphavantage.co or snapshot stock APIs. The stock API is used for the
+// stock API server, and if there are no exchange rate servers.
+func NewFxApi(stockApi api.StockApi, apiKey, apiServer, fxApiKey string, fxServers []string, cacheDir string) (api.FxApi, error) {
+	if len(fxServers) == 0 {
+		return stockApi, nil
+	}
+
+	providers := []fallback.FxProvider{}
+	for _, server := range fxServers {
+		var fx api.FxApi = stockApi
+		if server != apiServer {
+			var err error
+			if fx, err = getFxApi(fxApiKey, server, apiKey, cacheDir); err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrInvalidApiServer, server, err)
+			}
 		}
+		providers = append(providers, fallback.FxProvider{Api: fx, Name: server})
 	}
 
+	if len(providers) == 1 {
+		return providers[0].Api, nil
+	}
+	return fallback.NewFxFallback(providers), nil
+}
+
+// NewPortfolio loads a portfolio file with the stock API of a stock API server
+// (see NewStockApi)
+func NewPortfolio(filename, apiKey, apiServer, oauthCredsFile string, oauthRefresh bool, currency, cacheDir string) (*Portfolio, error) {
+	api, err := NewStockApi(apiKey, apiServer, oauthCredsFile, oauthRefresh, cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	return NewPortfolioWithApi(filename, api, currency)
+}
+
+// NewPortfolioWithApi loads a portfolio file with a stock API
+func NewPortfolioWithApi(filename string, api api.StockApi, currency string) (*Portfolio, error) {
 	portfolio := Portfolio{
 		Api:      api,
 		currency: strings.ToUpper(currency),
+		Workers:  DefaultLookupWorkers,
 	}
 
+	var err error
 	var file []byte
 	if file, err = ioutil.ReadFile(filename); err == nil {
-		if err = json.Unmarshal([]byte(file), &portfolio); err == nil {
-			portfolio.copyAssetStringsToFixed(&portfolio.Assets.Source)
-			portfolio.copyAssetStringsToFixed(&portfolio.Assets.Target)
+		if err = json.Unmarshal([]byte(file), &portfolio); err != nil {
+			err = fmt.Errorf("%w: portfolio file %s: %w", ErrInvalidFile, filename, err)
+		} else if err = portfolio.parseOptions(); err == nil {
+			if err = portfolio.copyAssetStringsToFixed(&portfolio.Assets.Source); err == nil {
+				err = portfolio.copyAssetStringsToFixed(&portfolio.Assets.Target)
+			}
+			if err == nil {
+				err = portfolio.validateOptions()
+			}
 		}
+	} else {
+		err = fmt.Errorf("%w: portfolio file %s: %w", ErrInvalidFile, filename, err)
 	}
 
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	return &portfolio, err
 }
 
+// Parse the portfolio-wide options that are the defaults of all assets
+func (p *Portfolio) parseOptions() error {
+	var err error
+	if len(p.LotSize) > 0 {
+		p.lotSize, err = newFixedFromString("lotSize", p.LotSize)
+	} else {
+		p.lotSize = fp.NewI(defaultLotSize, 0)
+	}
+	if err == nil {
+		p.band, err = newFpBand(p.Band, fpBand{})
+	}
+	return err
+}
+
+// Round a quantity down to a whole number of lots. A lot size of zero allows
+// any fractional quantity.
+func roundDownToLotSize(qty, lotSize fp.Fixed) fp.Fixed {
+	if lotSize.Sign() <= 0 {
+		return qty
+	}
+	// Round away division error before truncating to whole lots
+	lots := qty.Div(lotSize).Round(6)
+	return fp.NewI(lots.Int(), 0).Mul(lotSize)
+}
+
 func (p *Portfolio) Rebalance() error {
 	var err error
 	var cash fp.Fixed
 
 	if err = p.validate(); err != nil {
-		log.Fatal("Validation failed: ", err)
+		err = fmt.Errorf("Validation failed: %w", err)
 	} else if cash, err = p.liquidate(); err != nil {
-		log.Fatal("Liquidation failed: ", err)
+		err = fmt.Errorf("Liquidation failed: %w", err)
 	} else if err = p.allocate(cash); err != nil {
-		log.Fatal("Allocation failed: ", err)
+		err = fmt.Errorf("Allocation failed: %w", err)
 	}
 
 	return err
 }
 
-func (p *Portfolio) validate() error {
+func (p *Portfolio) validateOptions() error {
 	var err error
-
-	log.Info("Validating source assets")
-	for symbol, asset := range p.Assets.Source {
-		if err = p.initializeAsset(symbol, &asset); err != nil {
-			break
-		}
+	if p.lotSize.Sign() < 0 {
+		err = fmt.Errorf("%w: portfolio lot size %s", ErrInvalidValue, p.LotSize)
+	} else if err = p.band.validate(); err != nil {
+		err = fmt.Errorf("Invalid portfolio band: %w", err)
 	}
 
-	if err == nil {
-		log.Info("Validating target assets")
-		for symbol, asset := range p.Assets.Target {
-			if err = p.initializeAsset(symbol, &asset); err != nil {
-				break
+	for symbol, asset := range p.Assets.Target {
+		if err == nil && asset.fp.LotSize.Sign() < 0 {
+			err = fmt.Errorf("%w: lot size for %s: %s", ErrInvalidValue, symbol, asset.LotSize)
+		} else if err == nil {
+			if err = asset.fp.Band.validate(); err != nil {
+				err = fmt.Errorf("Invalid band for %s: %w", symbol, err)
 			}
 		}
 	}
-
 	return err
 }
+
+// Look up all source and target assets so that their information can be
+// reused when liquidating and allocating
+func (p *Portfolio) validate() error {
+	log.Info("Validating source and target assets")
+	return p.lookupAssets(p.Assets.Source, p.Assets.Target)
+}
@@ -0,0 +1,185 @@
+package portfolio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock/api/fallback"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetQtyPlaces(t *testing.T) {
+	asset := Asset{Type: typeCurrency}
+	assert.Equal(t, 2, getQtyPlaces(&asset))
+
+	asset = Asset{fp: fpAsset{LotSize: fp.NewF(0)}}
+	assert.Equal(t, 6, getQtyPlaces(&asset))
+
+	asset = Asset{fp: fpAsset{LotSize: fp.NewF(1)}}
+	assert.Equal(t, 2, getQtyPlaces(&asset))
+
+	asset = Asset{fp: fpAsset{LotSize: fp.NewF(100)}}
+	assert.Equal(t, 2, getQtyPlaces(&asset))
+
+	asset = Asset{fp: fpAsset{LotSize: fp.NewS("0.001")}}
+	assert.Equal(t, 3, getQtyPlaces(&asset))
+}
+
+func TestRoundDownToLotSize(t *testing.T) {
+	assert.Equal(t, "12.3456", roundDownToLotSize(fp.NewS("12.3456"), fp.NewF(0)).StringN(4))
+	assert.Equal(t, "12.0000", roundDownToLotSize(fp.NewS("12.3456"), fp.NewF(1)).StringN(4))
+	assert.Equal(t, "12.3450", roundDownToLotSize(fp.NewS("12.3456"), fp.NewS("0.005")).StringN(4))
+	assert.Equal(t, "0.0000", roundDownToLotSize(fp.NewS("99.99"), fp.NewF(100)).StringN(4))
+	assert.Equal(t, "200.0000", roundDownToLotSize(fp.NewS("250"), fp.NewF(100)).StringN(4))
+	assert.Equal(t, "0.3000", roundDownToLotSize(fp.NewS("0.3"), fp.NewS("0.1")).StringN(4))
+}
+
+const testApiServer = "file://../../examples/prices.csv"
+
+func newTestPortfolioFile(t *testing.T, contents string) string {
+	filename := filepath.Join(t.TempDir(), "portfolio.json")
+	assert.Nil(t, os.WriteFile(filename, []byte(contents), 0644))
+	return filename
+}
+
+func TestNewFixedFromString(t *testing.T) {
+	f, err := newFixedFromString("qty", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "0.00", f.StringN(2))
+
+	f, err = newFixedFromString("qty", "12.5")
+	assert.Nil(t, err)
+	assert.Equal(t, "12.50", f.StringN(2))
+
+	_, err = newFixedFromString("qty", "twelve")
+	assert.True(t, errors.Is(err, ErrInvalidValue))
+}
+
+func TestNewStockApi(t *testing.T) {
+	stockApi, err := NewStockApi("", testApiServer, "", false, "")
+	assert.Nil(t, err)
+	_, err = stockApi.GetQuote("AAPL")
+	assert.Nil(t, err)
+
+	_, err = NewStockApi("", "https://example.com", "", false, "")
+	assert.True(t, errors.Is(err, ErrInvalidApiServer))
+
+	_, err = NewStockApi("", testApiServer, filepath.Join(t.TempDir(), "missing.json"), false, "")
+	assert.True(t, errors.Is(err, ErrInvalidFile))
+
+	_, err = NewStockApi("", testApiServer, "", true, "")
+	assert.True(t, errors.Is(err, ErrInvalidCredentials))
+}
+
+func TestNewFallbackStockApi(t *testing.T) {
+	// A quote missing from a snapshot fails over to the next server
+	filename := filepath.Join(t.TempDir(), "prices.csv")
+	assert.Nil(t, os.WriteFile(filename, []byte("symbol,currency,price,description,type\nMSFT,USD,330.10,Microsoft Corporation,Equity\n"), 0600))
+	stockApi, err := NewFallbackStockApi("", testApiServer, []string{"file://" + filename, testApiServer}, "", false, "")
+	assert.Nil(t, err)
+	fb, ok := stockApi.(*fallback.Fallback)
+	assert.True(t, ok)
+
+	_, err = stockApi.GetQuote("AAPL")
+	assert.Nil(t, err)
+	provider, _ := fb.GetSource(fallback.OperationQuote, "AAPL")
+	assert.Equal(t, testApiServer, provider)
+
+	// Exchange rates use the stock API server
+	_, err = stockApi.GetCurrency("CAD", "USD")
+	assert.Nil(t, err)
+
+	// Only the stock API of the stock API server is needed
+	stockApi, err = NewFallbackStockApi("", testApiServer, []string{testApiServer}, "", false, "")
+	assert.Nil(t, err)
+	_, ok = stockApi.(*fallback.Fallback)
+	assert.False(t, ok)
+
+	_, err = NewFallbackStockApi("", testApiServer, []string{"https://example.com"}, "", false, "")
+	assert.True(t, errors.Is(err, ErrInvalidApiServer))
+}
+
+func TestNewFxApi(t *testing.T) {
+	stockApi, err := NewStockApi("", testApiServer, "", false, "")
+	assert.Nil(t, err)
+
+	// The stock API is used if there are no exchange rate servers
+	fx, err := NewFxApi(stockApi, "", testApiServer, "", nil, "")
+	assert.Nil(t, err)
+	assert.Equal(t, stockApi, fx)
+
+	fx, err = NewFxApi(stockApi, "", testApiServer, "", []string{"fixed:EUR/USD=1.08"}, "")
+	assert.Nil(t, err)
+	ccy, err := fx.GetCurrency("EUR", "USD")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.08", ccy.Rates["USD"].StringN(2))
+
+	// Exchange rates missing from the fixed table are looked up with the
+	// stock API
+	fx, err = NewFxApi(stockApi, "", testApiServer, "", []string{"fixed:EUR/USD=1.08", testApiServer}, "")
+	assert.Nil(t, err)
+	ccy, err = fx.GetCurrency("CAD", "USD")
+	assert.Nil(t, err)
+	assert.Equal(t, "0.74", ccy.Rates["USD"].StringN(2))
+
+	_, err = NewFxApi(stockApi, "", testApiServer, "", []string{"exchangeratesapi.io"}, "")
+	assert.True(t, errors.Is(err, ErrInvalidApiServer))
+
+	_, err = NewFxApi(stockApi, "", testApiServer, "", []string{"fixed:EUR=1.08"}, "")
+	assert.True(t, errors.Is(err, ErrInvalidApiServer))
+
+	_, err = NewFxApi(stockApi, "", testApiServer, "", []string{"https://example.com"}, "")
+	assert.True(t, errors.Is(err, ErrInvalidApiServer))
+}
+
+func TestNewPortfolio_InvalidFile(t *testing.T) {
+	_, err := NewPortfolio(filepath.Join(t.TempDir(), "missing.json"), "", testApiServer, "", false, "USD", "")
+	assert.True(t, errors.Is(err, ErrInvalidFile))
+
+	_, err = NewPortfolio(newTestPortfolioFile(t, "{"), "", testApiServer, "", false, "USD", "")
+	assert.True(t, errors.Is(err, ErrInvalidFile))
+}
+
+func TestNewPortfolio_InvalidApiServer(t *testing.T) {
+	_, err := NewPortfolio(newTestPortfolioFile(t, "{}"), "", "https://example.com", "", false, "USD", "")
+	assert.True(t, errors.Is(err, ErrInvalidApiServer))
+}
+
+func TestNewPortfolio_InvalidValue(t *testing.T) {
+	_, err := NewPortfolio(newTestPortfolioFile(t, `{"assets":{"source":{"AAPL":{"quantity":"ten"}}}}`), "", testApiServer, "", false, "USD", "")
+	assert.True(t, errors.Is(err, ErrInvalidValue))
+
+	_, err = NewPortfolio(newTestPortfolioFile(t, `{"lotSize":"-1"}`), "", testApiServer, "", false, "USD", "")
+	assert.True(t, errors.Is(err, ErrInvalidValue))
+}
+
+func TestRebalance_UnknownSymbol(t *testing.T) {
+	p, err := NewPortfolio(newTestPortfolioFile(t, `{"assets":{"source":{"ZZZZ":{"quantity":"1"}},"target":{"AAPL":{"allocation":"100"}}}}`), "", testApiServer, "", false, "USD", "")
+	assert.Nil(t, err)
+	err = p.Rebalance()
+	assert.True(t, errors.Is(err, ErrUnknownSymbol))
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+}
+
+func TestRebalance_FxUnavailable(t *testing.T) {
+	p, err := NewPortfolio(newTestPortfolioFile(t, `{"assets":{"source":{"AAPL":{"quantity":"1"}},"target":{"AAPL":{"allocation":"100"}}}}`), "", testApiServer, "", false, "EUR", "")
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(p.Rebalance(), ErrFxUnavailable))
+}
+
+func TestRebalance_InvalidAllocation(t *testing.T) {
+	p, err := NewPortfolio(newTestPortfolioFile(t, `{"assets":{"source":{"AAPL":{"quantity":"1"}},"target":{"AAPL":{"allocation":"90"}}}}`), "", testApiServer, "", false, "USD", "")
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(p.Rebalance(), ErrInvalidAllocation))
+}
+
+func TestContribute_InvalidAmount(t *testing.T) {
+	p, err := NewPortfolio(newTestPortfolioFile(t, `{"assets":{"source":{"AAPL":{"quantity":"1"}},"target":{"AAPL":{"allocation":"100"}}}}`), "", testApiServer, "", false, "USD", "")
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(p.Contribute("lots"), ErrInvalidValue))
+	assert.True(t, errors.Is(p.Contribute("-1000"), ErrInsufficientFunds))
+}
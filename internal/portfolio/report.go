@@ -0,0 +1,228 @@
+package portfolio
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shanebarnes/stocker/internal/stock"
+)
+
+// Report output formats
+const (
+	OutputCsv   = "csv"
+	OutputJson  = "json"
+	OutputTable = "table"
+)
+
+const (
+	orderBuy  = stock.OrderBuy
+	orderSell = stock.OrderSell
+)
+
+// ReportOrder is a buy or sell needed to turn the source assets into the
+// target assets
+type ReportOrder struct {
+	Action      string `json:"action"`
+	Currency    string `json:"currency"`
+	MarketValue string `json:"marketValue"`
+	Price       string `json:"price"`
+	Qty         string `json:"quantity"`
+	Symbol      string `json:"symbol"`
+}
+
+// ReportDeviation is the deviation (in percentage points) of the target
+// holdings from the target allocations, before and after residual cash is
+// used to buy additional lots
+type ReportDeviation struct {
+	After  string `json:"after"`
+	Before string `json:"before"`
+}
+
+// Report is a machine-readable summary of the source holdings, the target
+// holdings and the orders between them
+type Report struct {
+	Currency   string           `json:"currency"`
+	Deviation  *ReportDeviation `json:"deviation,omitempty"`
+	Executions []OrderExecution `json:"executions,omitempty"`
+	Orders     []ReportOrder    `json:"orders"`
+	Source     AssetGroup       `json:"source"`
+	Target     AssetGroup       `json:"target"`
+}
+
+// IsOutputFormat returns true if a report can be written in a format
+func IsOutputFormat(format string) bool {
+	switch format {
+	case OutputCsv, OutputJson, OutputTable:
+		return true
+	}
+	return false
+}
+
+func getSortedSymbols(group AssetGroup) []string {
+	symbols := make([]string, 0, len(group))
+	for symbol := range group {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// GetReport returns the source holdings, target holdings and orders of the
+// last rebalance, contribution or withdrawal
+func (p *Portfolio) GetReport() Report {
+	report := Report{
+		Currency:   p.currency,
+		Executions: p.executions,
+		Orders:     []ReportOrder{},
+		Source:     p.Assets.Source,
+		Target:     p.Assets.Target,
+	}
+
+	if p.deviation != nil {
+		report.Deviation = &ReportDeviation{
+			After:  p.deviation.After.Round(4).StringN(4),
+			Before: p.deviation.Before.Round(4).StringN(4),
+		}
+	}
+
+	// The cash order is the result of the other orders rather than a trade
+	for _, symbol := range getSortedSymbols(p.Assets.Target) {
+		asset := p.Assets.Target[symbol]
+		if symbol == p.currency || asset.Order == nil || asset.fp.QtyDiff.Sign() == 0 {
+			continue
+		}
+
+		action := orderBuy
+		if asset.fp.QtyDiff.Sign() < 0 {
+			action = orderSell
+		}
+
+		report.Orders = append(report.Orders, ReportOrder{
+			Action:      action,
+			Currency:    p.currency,
+			MarketValue: strings.TrimSuffix(strings.TrimLeft(asset.Order.MarketValue, "+-"), p.currency),
+			Price:       asset.Price,
+			Qty:         strings.TrimLeft(asset.Order.Qty, "+-"),
+			Symbol:      symbol,
+		})
+	}
+
+	return report
+}
+
+// WriteReport writes a report in the json, csv or table format
+func WriteReport(w io.Writer, report Report, format string) error {
+	var err error
+	switch format {
+	case OutputCsv:
+		err = writeReportCsv(w, report)
+	case OutputJson:
+		err = writeReportJson(w, report)
+	case OutputTable:
+		err = writeReportTable(w, report)
+	default:
+		err = fmt.Errorf("Invalid output format: %s", format)
+	}
+	return err
+}
+
+func writeReportJson(w io.Writer, report Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// Source and target holdings are written as one table, with the orders of
+// target holdings in the last columns
+func writeReportCsv(w io.Writer, report Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"holdings", "symbol", "name", "type", "currency", "quantity", "price", "exchangeRate", "marketValue", "allocation", "orderQuantity", "orderMarketValue"})
+
+	groups := []struct {
+		name  string
+		group AssetGroup
+	}{
+		{"source", report.Source},
+		{"target", report.Target},
+	}
+	for _, g := range groups {
+		for _, symbol := range getSortedSymbols(g.group) {
+			asset := g.group[symbol]
+			orderQty, orderMarketValue := "", ""
+			if asset.Order != nil {
+				orderQty = asset.Order.Qty
+				orderMarketValue = strings.TrimSuffix(asset.Order.MarketValue, report.Currency)
+			}
+			cw.Write([]string{
+				g.name,
+				symbol,
+				asset.Name,
+				asset.Type,
+				asset.Currency,
+				asset.Qty,
+				asset.Price,
+				asset.Fxr,
+				strings.TrimSuffix(asset.MarketValue, report.Currency),
+				strings.TrimSuffix(asset.Alloc, "%"),
+				orderQty,
+				orderMarketValue,
+			})
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeReportTable(w io.Writer, report Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	writeHoldings := func(title string, group AssetGroup) {
+		fmt.Fprintln(tw, title)
+		fmt.Fprintln(tw, "SYMBOL\tQUANTITY\tPRICE\tMARKET VALUE\tALLOCATION\t")
+		for _, symbol := range getSortedSymbols(group) {
+			asset := group[symbol]
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t\n", symbol, asset.Qty, asset.Price, asset.MarketValue, asset.Alloc)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	writeHoldings("SOURCE HOLDINGS", report.Source)
+	writeHoldings("TARGET HOLDINGS", report.Target)
+
+	fmt.Fprintln(tw, "ORDERS")
+	fmt.Fprintln(tw, "SYMBOL\tACTION\tQUANTITY\tPRICE\tMARKET VALUE\t")
+	for _, order := range report.Orders {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s%s\t\n", order.Symbol, order.Action, order.Qty, order.Price, order.MarketValue, order.Currency)
+	}
+
+	if report.Deviation != nil {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "ALLOCATION DEVIATION")
+		fmt.Fprintln(tw, "BEFORE\tAFTER\t")
+		fmt.Fprintf(tw, "%s%%\t%s%%\t\n", report.Deviation.Before, report.Deviation.After)
+	}
+
+	if len(report.Executions) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "EXECUTIONS")
+		fmt.Fprintln(tw, "SYMBOL\tACTION\tQUANTITY\tLIMIT PRICE\tCOMMISSION\tBUYING POWER EFFECT\tORDER ID\t")
+		for _, exec := range report.Executions {
+			limitPrice, orderId := exec.LimitPrice, exec.OrderId
+			if len(limitPrice) == 0 {
+				limitPrice = "market"
+			}
+			if len(orderId) == 0 {
+				orderId = "preview"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", exec.Symbol, exec.Action, exec.Qty, limitPrice, exec.Commission, exec.BuyingPowerEffect, orderId)
+		}
+	}
+
+	return tw.Flush()
+}
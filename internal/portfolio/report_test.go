@@ -0,0 +1,94 @@
+package portfolio
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	fp "github.com/robaho/fixed"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestReport(t *testing.T) Report {
+	p := newTestContributePortfolio()
+	p.copyAssetFixedToStrings(&p.Assets.Source)
+	assert.Nil(t, p.contribute(fp.NewF(1000), fp.NewS("-95")))
+	return p.GetReport()
+}
+
+func TestIsOutputFormat(t *testing.T) {
+	assert.True(t, IsOutputFormat(OutputCsv))
+	assert.True(t, IsOutputFormat(OutputJson))
+	assert.True(t, IsOutputFormat(OutputTable))
+	assert.False(t, IsOutputFormat("xml"))
+	assert.False(t, IsOutputFormat(""))
+}
+
+func TestGetReport(t *testing.T) {
+	report := newTestReport(t)
+	assert.Equal(t, "USD", report.Currency)
+	assert.Equal(t, []ReportOrder{
+		{Action: orderSell, Currency: "USD", MarketValue: "100.00", Price: "10.00", Qty: "10.00", Symbol: "AAA"},
+	}, report.Orders)
+	assert.Equal(t, 3, len(report.Source))
+	assert.Equal(t, 3, len(report.Target))
+}
+
+func TestWriteReport_Json(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, newTestReport(t), OutputJson))
+
+	var report Report
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, "sell", report.Orders[0].Action)
+	assert.Equal(t, "50.00", report.Target["AAA"].Qty)
+	assert.Equal(t, "-10.00", report.Target["AAA"].Order.Qty)
+}
+
+func TestWriteReport_Csv(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, newTestReport(t), OutputCsv))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 7, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "holdings,symbol,"))
+	assert.Equal(t, "source,AAA,,,,60.00,10.00,1.0000,600.00,0.0000,,", lines[1])
+	assert.Equal(t, "target,AAA,,,,50.00,10.00,1.0000,500.00,55.2486,-10.00,-100.00", lines[4])
+}
+
+func TestWriteReport_Table(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, newTestReport(t), OutputTable))
+	assert.Contains(t, buf.String(), "SOURCE HOLDINGS")
+	assert.Contains(t, buf.String(), "TARGET HOLDINGS")
+	assert.Regexp(t, `AAA\s+sell\s+10.00\s+10.00\s+100.00USD`, buf.String())
+}
+
+func TestWriteReport_InvalidFormat(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NotNil(t, WriteReport(&buf, Report{}, "xml"))
+}
+
+func TestWriteReport_Deviation(t *testing.T) {
+	p := newTestContributePortfolio()
+	p.copyAssetFixedToStrings(&p.Assets.Source)
+	assert.Nil(t, p.contribute(fp.NewF(1000), fp.NewF(150)))
+	report := p.GetReport()
+	if assert.NotNil(t, report.Deviation) {
+		assert.Equal(t, p.deviation.Before.Round(4).StringN(4), report.Deviation.Before)
+		assert.Equal(t, p.deviation.After.Round(4).StringN(4), report.Deviation.After)
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteReport(&buf, report, OutputJson))
+	assert.Contains(t, buf.String(), `"deviation": {`)
+
+	buf.Reset()
+	assert.Nil(t, WriteReport(&buf, report, OutputTable))
+	assert.Contains(t, buf.String(), "ALLOCATION DEVIATION")
+	assert.Contains(t, buf.String(), report.Deviation.Before+"%")
+
+	// Withdrawals do not redistribute residual cash
+	assert.Nil(t, newTestReport(t).Deviation)
+}
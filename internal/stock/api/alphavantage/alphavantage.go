@@ -1,9 +1,12 @@
 package alphavantage
 
 import (
+	"context"
+	"fmt"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	fp "github.com/robaho/fixed"
 	"github.com/shanebarnes/stocker/internal/stock"
@@ -13,15 +16,23 @@ import (
 type av struct {
 	apiKey string
 	cache  *stock.Cache
+	opts   []api.Option
 }
 
 func (a *av) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	return a.GetCurrencyContext(context.Background(), currency, currencyTo)
+}
+
+func (a *av) GetCurrencyContext(ctx context.Context, currency, currencyTo string) (stock.Currency, error) {
 	ccy, err := a.cache.GetCurrency(currency, currencyTo)
 	if err != nil {
 		var xr *ExchangeRate
-		if xr, err = GetCurrencyExchangeRateInfo(currency, currencyTo, a.apiKey); err == nil {
+		if xr, err = GetCurrencyExchangeRateInfoContext(ctx, currency, currencyTo, a.apiKey, a.opts...); err == nil {
 			var rate float64
-			if rate, err = strconv.ParseFloat(xr.ExchangeRate, 64); err == nil {
+			if len(xr.ExchangeRate) == 0 {
+				// Invalid currencies have an empty exchange rate
+				err = fmt.Errorf("alphavantage: no exchange rate from %s to %s: %w", currency, currencyTo, syscall.ENOENT)
+			} else if rate, err = strconv.ParseFloat(xr.ExchangeRate, 64); err == nil {
 				ccy.Currency = xr.FromCode
 				ccy.Name = xr.FromName
 				ccy.Rates = make(map[string]fp.Fixed)
@@ -34,18 +45,40 @@ func (a *av) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
 	return ccy, err
 }
 
+func (a *av) GetHistory(symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	return a.GetHistoryContext(context.Background(), symbol, interval, from, to)
+}
+
+func (a *av) GetHistoryContext(ctx context.Context, symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	ts, err := GetTimeSeriesAdjustedContext(ctx, symbol, interval, getTimeSeriesOutputSize(interval, from, time.Now()), a.apiKey, a.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return getTimeSeriesBars(ts, from, to)
+}
+
 func (a *av) GetQuote(symbol string) (stock.Quote, error) {
+	return a.GetQuoteContext(context.Background(), symbol)
+}
+
+func (a *av) GetQuoteContext(ctx context.Context, symbol string) (stock.Quote, error) {
 	qte, err := a.cache.GetQuote(symbol)
 	if err != nil {
 		var quote *SymbolQuote
-		if quote, err = GetSymbolQuote(symbol, a.apiKey); err == nil {
+		if quote, err = GetSymbolQuoteContext(ctx, symbol, a.apiKey, a.opts...); err != nil {
+			// Error
+		} else if len(quote.Symbol) == 0 {
+			// Unknown symbols have an empty quote
+			err = fmt.Errorf("alphavantage: no quote for %s: %w", symbol, syscall.ENOENT)
+		} else {
 			qte.Symbol = quote.Symbol
 			qte.Prices.Close, _ = strconv.ParseFloat(quote.PreviousClose, 64)
 			qte.Prices.High, _ = strconv.ParseFloat(quote.High, 64)
 			qte.Prices.Low, _ = strconv.ParseFloat(quote.Low, 64)
 			qte.Prices.Open, _ = strconv.ParseFloat(quote.Open, 64)
+			// Global quotes have no separate trading hours price, only the
+			// date of the latest trading day
 			qte.Prices.Latest, _ = strconv.ParseFloat(quote.Price, 64)
-			qte.Prices.LatestTrHrs, _ = strconv.ParseFloat(quote.LatestTradingDay, 64)
 			qte.Volume = quote.Volume
 
 			a.cache.AddQuote(qte)
@@ -55,10 +88,14 @@ func (a *av) GetQuote(symbol string) (stock.Quote, error) {
 }
 
 func (a *av) GetSymbol(symbol string) (stock.Symbol, error) {
+	return a.GetSymbolContext(context.Background(), symbol)
+}
+
+func (a *av) GetSymbolContext(ctx context.Context, symbol string) (stock.Symbol, error) {
 	sym, err := a.cache.GetSymbol(symbol)
 	if err != nil {
 		var match *SymbolSearchMatch
-		if match, err = GetSymbolSearch(symbol, a.apiKey); err == nil {
+		if match, err = GetSymbolSearchContext(ctx, symbol, a.apiKey, a.opts...); err == nil {
 			sym.Currency = match.Currency
 			sym.Description = match.Name
 			sym.Symbol = match.Symbol
@@ -74,13 +111,25 @@ func IsApiAlphavantage(apiServer string) bool {
 	return strings.HasSuffix(apiServer, "alphavantage.co")
 }
 
-func NewApiAlphavantage(apiKey string) api.StockApi {
+// NewApiAlphavantage creates an Alpha Vantage stock API. An in-memory cache
+// is used if no cache is provided. The options select the HTTP client and
+// server of the API.
+func NewApiAlphavantage(apiKey string, cache *stock.Cache, opts ...api.Option) api.StockApi {
+	if cache == nil {
+		cache = stock.NewCache()
+	}
+
 	return &av{
 		apiKey: apiKey,
-		cache: stock.NewCache(),
+		cache:  cache,
+		opts:   opts,
 	}
 }
 
 func (a *av) RefreshCredentials() (*api.OAuthCredentials, error) {
 	return nil, syscall.ENOTSUP
 }
+
+func (a *av) RefreshCredentialsContext(ctx context.Context) (*api.OAuthCredentials, error) {
+	return a.RefreshCredentials()
+}
@@ -1,16 +1,18 @@
 package alphavantage
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
-	"io/ioutil"
 	"net/http"
 	"time"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
 )
 
 var (
 	ApiRequestsPerMinLimit = 5// 0
-	apiLastRequestTime = time.Time{}
+	ApiRetryPolicy = api.DefaultRetryPolicy()
+	apiLimiter = api.NewRateLimiter(apiGetRequestInterval(), 1)
 )
 
 type apiNote struct {
@@ -26,20 +28,20 @@ func apiGetRequestInterval() time.Duration {
 }
 
 func ApiGetResponseBody(url string) ([]byte, error) {
-	var body []byte
+	return ApiGetResponseBodyContext(context.Background(), url)
+}
 
-	interval := apiGetRequestInterval()
-	if elapsed := time.Since(apiLastRequestTime); elapsed < interval {
-		time.Sleep(interval - elapsed)
+// ApiGetResponseBodyContext waits for the request limit and makes a request
+// until the context is done. The options select the HTTP client and server.
+func ApiGetResponseBodyContext(ctx context.Context, url string, opts ...api.Option) ([]byte, error) {
+	// Pick up any change to the request limit before waiting for a token
+	apiLimiter.SetRate(apiGetRequestInterval(), 1)
+	if err := apiLimiter.WaitContext(ctx); err != nil {
+		return nil, err
 	}
-	apiLastRequestTime = time.Now()
 
-	res, err := http.Get(url)
-	// TODO: check that res.Status == http.StatusOK?
+	body, err := api.GetApiResponseBodyWithRetryContext(ctx, url, "", ApiRetryPolicy, isApiResponseRetryable, opts...)
 	if err == nil {
-		defer res.Body.Close()
-		body, err = ioutil.ReadAll(res.Body)
-
 		// A 200 status code is returned when the API call limit is reached.
 		// Inspect response body for API call limit "note".
 		err = apiIsRequestLimitError(body)
@@ -47,11 +49,15 @@ func ApiGetResponseBody(url string) ([]byte, error) {
 	return body, err
 }
 
+func isApiResponseRetryable(res *http.Response) bool {
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError
+}
+
 func apiIsRequestLimitError(body []byte) error {
 	note := apiNote{}
 	err := json.Unmarshal(body, &note)
 	if err == nil && len(note.Note) > 0 {
-		err = errors.New(note.Note)
+		err = &api.RequestLimitError{Message: note.Note}
 	} else {
 		err = nil
 	}
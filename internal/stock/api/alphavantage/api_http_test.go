@@ -2,10 +2,12 @@ package alphavantage
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"testing"
 	"time"
 
+	"github.com/shanebarnes/stocker/internal/stock/api"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -35,6 +37,18 @@ func TestApiGetResponseBody(t *testing.T) {
 	assert.Less(t, 0, len(body))
 }
 
+func TestApiGetResponseBodyContext(t *testing.T) {
+	// No request is made once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	body, err := ApiGetResponseBodyContext(ctx, "https://www.alphavantage.co/query?function=SYMBOL_SEARCH&keywords=AAPL&apikey=")
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, len(body))
+
+	_, err = NewApiAlphavantage("", nil).(api.StockApiContext).GetQuoteContext(ctx, "AAPL")
+	assert.Equal(t, context.Canceled, err)
+}
+
 func TestApiIsRequestLimitError(t *testing.T) {
 	note := apiNote{
 		Note: "Thank you for using Alpha Vantage! Our standard API call frequency is 5 calls per minute and 500 calls per day. Please visit https://www.alphavantage.co/premium/ if you would like to target a higher API call frequency.",
@@ -45,6 +59,7 @@ func TestApiIsRequestLimitError(t *testing.T) {
 	err := apiIsRequestLimitError(buf.Bytes())
 	assert.NotNil(t, err)
 	assert.Equal(t, err.Error(), note.Note)
+	assert.True(t, api.IsRequestLimit(err))
 
 	match := SymbolSearchMatch{}
 	buf = new(bytes.Buffer)
@@ -0,0 +1,115 @@
+package alphavantage
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/shanebarnes/stocker/internal/stock/api/apitest"
+)
+
+func formatContractPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', 4, 64)
+}
+
+// Serves the contract market data in the Alpha Vantage format
+func serveContract(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	symbol := query.Get("symbol")
+	if len(symbol) == 0 {
+		symbol = query.Get("keywords")
+	}
+
+	var res interface{}
+	if symbol == apitest.LimitedSymbol {
+		res = map[string]string{"Note": "Thank you for using Alpha Vantage! Our standard API call frequency is 5 calls per minute and 500 calls per day."}
+	} else {
+		switch query.Get("function") {
+		case "CURRENCY_EXCHANGE_RATE":
+			if query.Get("from_currency") == apitest.Currency && query.Get("to_currency") == apitest.CurrencyTo {
+				res = map[string]interface{}{"Realtime Currency Exchange Rate": map[string]string{
+					"1. From_Currency Code": apitest.Currency,
+					"2. From_Currency Name": "United States Dollar",
+					"3. To_Currency Code":   apitest.CurrencyTo,
+					"4. To_Currency Name":   "Canadian Dollar",
+					"5. Exchange Rate":      apitest.Rate,
+					"6. Last Refreshed":     "2023-06-02 21:45:01",
+					"7. Time Zone":          "UTC",
+				}}
+			} else {
+				res = map[string]string{"Error Message": "Invalid API call. Please retry or visit the documentation (https://www.alphavantage.co/documentation/) for CURRENCY_EXCHANGE_RATE."}
+			}
+		case "GLOBAL_QUOTE":
+			quote := map[string]string{}
+			if symbol == apitest.Symbol {
+				quote = map[string]string{
+					"01. symbol":             apitest.Quote.Symbol,
+					"02. open":               formatContractPrice(apitest.Quote.Prices.Open),
+					"03. high":               formatContractPrice(apitest.Quote.Prices.High),
+					"04. low":                formatContractPrice(apitest.Quote.Prices.Low),
+					"05. price":              formatContractPrice(apitest.Quote.Prices.Latest),
+					"06. volume":             apitest.Quote.Volume,
+					"07. latest trading day": "2023-06-02",
+					"08. previous close":     formatContractPrice(apitest.Quote.Prices.Close),
+				}
+			}
+			res = map[string]interface{}{"Global Quote": quote}
+		case "SYMBOL_SEARCH":
+			matches := []map[string]string{}
+			if symbol == apitest.Symbol {
+				matches = append(matches, map[string]string{
+					"1. symbol":   apitest.SymbolInfo.Symbol,
+					"2. name":     apitest.SymbolInfo.Description,
+					"3. type":     "ETF",
+					"4. region":   "United States",
+					"8. currency": apitest.SymbolInfo.Currency,
+				})
+			}
+			res = map[string]interface{}{"bestMatches": matches}
+		case "TIME_SERIES_DAILY_ADJUSTED":
+			if symbol == apitest.Symbol {
+				ts := map[string]map[string]string{}
+				for _, bar := range apitest.Bars {
+					ts[bar.Time.Format(timeSeriesDate)] = map[string]string{
+						"1. open":              bar.Open.String(),
+						"2. high":              bar.High.String(),
+						"3. low":               bar.Low.String(),
+						"4. close":             bar.Close.String(),
+						"5. adjusted close":    bar.AdjClose.String(),
+						"6. volume":            strconv.FormatInt(bar.Volume, 10),
+						"7. dividend amount":   "0.0000",
+						"8. split coefficient": "1.0",
+					}
+				}
+				res = map[string]interface{}{"Time Series (Daily)": ts}
+			} else {
+				res = map[string]string{"Error Message": "Invalid API call. Please retry or visit the documentation (https://www.alphavantage.co/documentation/) for TIME_SERIES_DAILY_ADJUSTED."}
+			}
+		default:
+			http.Error(w, "unknown function", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func TestContract(t *testing.T) {
+	saveLimit := ApiRequestsPerMinLimit
+	t.Cleanup(func() {
+		ApiRequestsPerMinLimit = saveLimit
+	})
+	ApiRequestsPerMinLimit = 0
+
+	apitest.Run(t, apitest.Contract{
+		Handler: http.HandlerFunc(serveContract),
+		NewApi: func(opts ...api.Option) api.StockApi {
+			return NewApiAlphavantage("test", nil, opts...)
+		},
+		RequestLimit: true,
+		Unsupported:  []string{apitest.PriceAsk, apitest.PriceBid, apitest.PriceLatestTrHrs},
+	})
+}
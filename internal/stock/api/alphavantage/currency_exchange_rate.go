@@ -2,9 +2,12 @@ package alphavantage
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"strconv"
 	"text/template"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
 )
 
 const (
@@ -59,12 +62,18 @@ func GetCurrencyExchangeRate(fromCurrency, toCurrency, apiKey string) (float64,
 }
 
 func GetCurrencyExchangeRateInfo(fromCurrency, toCurrency, apiKey string) (*ExchangeRate, error) {
+	return GetCurrencyExchangeRateInfoContext(context.Background(), fromCurrency, toCurrency, apiKey)
+}
+
+// GetCurrencyExchangeRateInfoContext gets an exchange rate until the context
+// is done
+func GetCurrencyExchangeRateInfoContext(ctx context.Context, fromCurrency, toCurrency, apiKey string, opts ...api.Option) (*ExchangeRate, error) {
 	var rate *ExchangeRate
 
 	url, err := createCurrencyExchangeRateUrl(fromCurrency, toCurrency, apiKey)
 	if err == nil {
 		var body []byte
-		if body, err = ApiGetResponseBody(url); err == nil {
+		if body, err = ApiGetResponseBodyContext(ctx, url, opts...); err == nil {
 			er := exchangeRate{}
 			if err = json.Unmarshal(body, &er); err == nil {
 				rate = &er.Rate
@@ -0,0 +1,105 @@
+package alphavantage
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/shanebarnes/stocker/internal/stock/api/replay"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns an Alpha Vantage API that replays the exchanges of a fixture without
+// waiting for the request limit or retry delays
+func newReplayApi(t *testing.T, client *http.Client) api.StockApi {
+	saveLimit := ApiRequestsPerMinLimit
+	savePolicy := ApiRetryPolicy
+	t.Cleanup(func() {
+		ApiRequestsPerMinLimit = saveLimit
+		ApiRetryPolicy = savePolicy
+	})
+	ApiRequestsPerMinLimit = 0
+	ApiRetryPolicy = api.RetryPolicy{Limit: 2}
+
+	return NewApiAlphavantage(api.GetApiKeyFromEnv(), nil, api.WithHttpClient(client))
+}
+
+// The fixture can be recorded again with:
+//
+//	STOCKER_RECORD=1 STOCKER_API_KEY=<your_api_key> go test -run TestReplay_StockApi
+func TestReplay_StockApi(t *testing.T) {
+	av := newReplayApi(t, replay.NewTestClient(t, filepath.Join("testdata", "replay.json")))
+
+	quote, err := av.GetQuote("VTI")
+	assert.Nil(t, err)
+	assert.Equal(t, "VTI", quote.Symbol)
+	assert.Equal(t, 219.47, quote.Prices.Close)
+	assert.Equal(t, 221.47, quote.Prices.High)
+	assert.Equal(t, 219.53, quote.Prices.Low)
+	assert.Equal(t, 219.9, quote.Prices.Open)
+	assert.Equal(t, 221.13, quote.Prices.Latest)
+	assert.Equal(t, "3306428", quote.Volume)
+
+	// Cached quotes are not requested again
+	quote, err = av.GetQuote("VTI")
+	assert.Nil(t, err)
+	assert.Equal(t, "VTI", quote.Symbol)
+
+	sym, err := av.GetSymbol("VTI")
+	assert.Nil(t, err)
+	assert.Equal(t, stock.Symbol{Currency: "USD", Description: "Vanguard Total Stock Market ETF", Symbol: "VTI", Type: "ETF"}, sym)
+
+	ccy, err := av.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, "USD", ccy.Currency)
+	assert.Equal(t, "United States Dollar", ccy.Name)
+	assert.Equal(t, "1.3421", ccy.Rates["CAD"].String())
+
+	bars, err := av.GetHistory("VTI", stock.IntervalMonthly, time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, time.May, 31, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(bars)) {
+		assert.Equal(t, time.Date(2023, time.April, 28, 0, 0, 0, 0, time.UTC), bars[0].Time)
+		assert.Equal(t, "206.75", bars[0].Close.String())
+		assert.Equal(t, time.Date(2023, time.May, 31, 0, 0, 0, 0, time.UTC), bars[1].Time)
+		assert.Equal(t, "208.19", bars[1].AdjClose.String())
+		assert.Equal(t, int64(62457185), bars[1].Volume)
+	}
+
+	_, err = av.RefreshCredentials()
+	assert.True(t, errors.Is(err, syscall.ENOTSUP))
+}
+
+func TestReplay_Errors(t *testing.T) {
+	av := newReplayApi(t, replay.NewReplayClient(t, filepath.Join("testdata", "errors.json")))
+
+	// The request limit note is returned with a 200 status code
+	_, err := av.GetQuote("VTI")
+	assert.True(t, api.IsRequestLimit(err))
+
+	_, err = av.GetSymbol("XYZXYZ")
+	assert.NotNil(t, err)
+
+	// Too many requests are retried until the retry limit
+	_, err = av.GetQuote("VXUS")
+	assert.True(t, api.IsRequestLimit(err))
+	var rerr *api.ApiResponseError
+	if assert.True(t, errors.As(err, &rerr)) {
+		assert.Equal(t, http.StatusTooManyRequests, rerr.StatusCode)
+	}
+
+	// Server errors are retried
+	quote, err := av.GetQuote("BND")
+	assert.Nil(t, err)
+	assert.Equal(t, 72.37, quote.Prices.Latest)
+
+	_, err = av.GetQuote("BNDX")
+	assert.False(t, api.IsRequestLimit(err))
+	if assert.True(t, errors.As(err, &rerr)) {
+		assert.Equal(t, http.StatusInternalServerError, rerr.StatusCode)
+	}
+}
@@ -2,8 +2,11 @@ package alphavantage
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"text/template"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
 )
 
 const (
@@ -47,12 +50,18 @@ func createSymbolQuoteUrl(symbol, apiKey string) (string, error) {
 }
 
 func GetSymbolQuote(symbol, apiKey string) (*SymbolQuote, error) {
+	return GetSymbolQuoteContext(context.Background(), symbol, apiKey)
+}
+
+// GetSymbolQuoteContext gets the latest quote of a symbol until the context
+// is done
+func GetSymbolQuoteContext(ctx context.Context, symbol, apiKey string, opts ...api.Option) (*SymbolQuote, error) {
 	var quote *SymbolQuote
 
 	url, err := createSymbolQuoteUrl(symbol, apiKey)
 	if err == nil {
 		var body []byte
-		if body, err = ApiGetResponseBody(url); err == nil {
+		if body, err = ApiGetResponseBodyContext(ctx, url, opts...); err == nil {
 			sq := symbolQuote{}
 			if err = json.Unmarshal(body, &sq); err == nil {
 				quote = &sq.Quote
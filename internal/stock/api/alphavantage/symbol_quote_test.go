@@ -1,6 +1,8 @@
 package alphavantage
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/shanebarnes/stocker/internal/stock/api"
@@ -54,3 +56,27 @@ func TestGetSymbolQuote(t *testing.T) {
 	assert.NotEqual(t, "", quote.Change)
 	assert.NotEqual(t, "", quote.ChangePercent)
 }
+
+func TestGetQuote_Options(t *testing.T) {
+	saveLimit := ApiRequestsPerMinLimit
+	t.Cleanup(func() {
+		ApiRequestsPerMinLimit = saveLimit
+	})
+	ApiRequestsPerMinLimit = 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/query", req.URL.Path)
+		assert.Equal(t, "GLOBAL_QUOTE", req.URL.Query().Get("function"))
+		assert.Equal(t, "VTI", req.URL.Query().Get("symbol"))
+		assert.Equal(t, "test", req.URL.Query().Get("apikey"))
+		w.Write([]byte(`{"Global Quote": {"01. symbol": "VTI", "02. open": "220.10", "03. high": "221.50", "04. low": "219.80", "05. price": "221.00", "06. volume": "3000000", "07. latest trading day": "2023-06-02", "08. previous close": "219.90"}}`))
+	}))
+	defer server.Close()
+
+	quote, err := NewApiAlphavantage("test", nil, api.WithBaseUrl(server.URL), api.WithHttpClient(server.Client())).GetQuote("VTI")
+	assert.Nil(t, err)
+	assert.Equal(t, "VTI", quote.Symbol)
+	assert.Equal(t, 221.00, quote.Prices.Latest)
+	assert.Equal(t, 219.90, quote.Prices.Close)
+	assert.Equal(t, "3000000", quote.Volume)
+}
@@ -2,9 +2,13 @@ package alphavantage
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"syscall"
 	"text/template"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
 )
 
 const (
@@ -47,19 +51,25 @@ func createSymbolSearchUrl(symbol, apiKey string) (string, error) {
 }
 
 func GetSymbolSearch(symbol, apiKey string) (*SymbolSearchMatch, error) {
+	return GetSymbolSearchContext(context.Background(), symbol, apiKey)
+}
+
+// GetSymbolSearchContext gets the best match of a symbol search until the
+// context is done
+func GetSymbolSearchContext(ctx context.Context, symbol, apiKey string, opts ...api.Option) (*SymbolSearchMatch, error) {
 	var match *SymbolSearchMatch
 
 	url, err := createSymbolSearchUrl(symbol, apiKey)
 	if err == nil {
 		var body []byte
-		if body, err = ApiGetResponseBody(url); err == nil {
+		if body, err = ApiGetResponseBodyContext(ctx, url, opts...); err == nil {
 			search := symbolSearch{}
 			if err = json.Unmarshal(body, &search); err == nil {
 				if len(search.BestMatches) > 0 {
 					// TODO: check that match score is 1.000?
 					match = &search.BestMatches[0]
 				} else {
-					err = errors.New("SymbolSearch: no matches found for " + symbol)
+					err = fmt.Errorf("SymbolSearch: no matches found for %s: %w", symbol, syscall.ENOENT)
 				}
 			}
 		}
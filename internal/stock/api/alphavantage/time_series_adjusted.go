@@ -0,0 +1,186 @@
+package alphavantage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+)
+
+const (
+	apiTimeSeriesAdjusted = `https://www.alphavantage.co/query?function={{.Function}}&symbol={{.Symbol}}&outputsize={{.OutputSize}}&apikey={{.ApiKey}}`
+
+	// The compact output size only includes the latest 100 data points
+	compactOutputSize = 100
+	timeSeriesDate    = "2006-01-02"
+)
+
+var timeSeriesFunctions = map[string]string{
+	stock.IntervalDaily:   "TIME_SERIES_DAILY_ADJUSTED",
+	stock.IntervalMonthly: "TIME_SERIES_MONTHLY_ADJUSTED",
+	stock.IntervalWeekly:  "TIME_SERIES_WEEKLY_ADJUSTED",
+}
+
+type tplTimeSeriesAdjusted struct {
+	ApiKey     string
+	Function   string
+	OutputSize string
+	Symbol     string
+}
+
+// Daily adjusted time series include split coefficients, while weekly and
+// monthly adjusted time series do not
+type TimeSeriesAdjusted struct {
+	Open             string `json:"1. open"`
+	High             string `json:"2. high"`
+	Low              string `json:"3. low"`
+	Close            string `json:"4. close"`
+	AdjustedClose    string `json:"5. adjusted close"`
+	Volume           string `json:"6. volume"`
+	DividendAmount   string `json:"7. dividend amount"`
+	SplitCoefficient string `json:"8. split coefficient"`
+}
+
+// TsAdjusted is an adjusted time series keyed by date. The name of the time
+// series field depends on the interval.
+type TsAdjusted struct {
+	ErrorMessage string
+	Information  string
+	Ts           map[string]TimeSeriesAdjusted
+}
+
+func (ts *TsAdjusted) UnmarshalJSON(buf []byte) error {
+	fields := map[string]json.RawMessage{}
+	err := json.Unmarshal(buf, &fields)
+	for key, val := range fields {
+		if err != nil {
+			break
+		}
+
+		switch {
+		case key == "Error Message":
+			err = json.Unmarshal(val, &ts.ErrorMessage)
+		case key == "Information":
+			err = json.Unmarshal(val, &ts.Information)
+		case strings.Contains(key, "Time Series"):
+			err = json.Unmarshal(val, &ts.Ts)
+		}
+	}
+	return err
+}
+
+func createTimeSeriesAdjustedUrl(symbol, interval, outputSize, apiKey string) (string, error) {
+	var url bytes.Buffer
+	var err error
+
+	function, exists := timeSeriesFunctions[interval]
+	if !exists {
+		return "", fmt.Errorf("invalid time series interval: %s", interval)
+	}
+
+	var tpl *template.Template
+	t := tplTimeSeriesAdjusted{ApiKey: apiKey, Function: function, OutputSize: outputSize, Symbol: symbol}
+
+	if tpl, err = template.New("api").Parse(apiTimeSeriesAdjusted); err == nil {
+		err = tpl.Execute(&url, t)
+	}
+
+	return url.String(), err
+}
+
+// The full output size is only requested if the compact output size may not
+// go back far enough
+func getTimeSeriesOutputSize(interval string, from, now time.Time) string {
+	if interval == stock.IntervalDaily && now.Sub(from) < compactOutputSize*24*time.Hour {
+		return "compact"
+	}
+	return "full"
+}
+
+// References:
+//   https://www.alphavantage.co/documentation/#dailyadj
+//   https://www.alphavantage.co/documentation/#weeklyadj
+//   https://www.alphavantage.co/documentation/#monthlyadj
+func GetTimeSeriesAdjusted(symbol, interval, outputSize, apiKey string) (*TsAdjusted, error) {
+	return GetTimeSeriesAdjustedContext(context.Background(), symbol, interval, outputSize, apiKey)
+}
+
+// GetTimeSeriesAdjustedContext gets the adjusted time series of a symbol until
+// the context is done
+func GetTimeSeriesAdjustedContext(ctx context.Context, symbol, interval, outputSize, apiKey string, opts ...api.Option) (*TsAdjusted, error) {
+	var tsAdjusted *TsAdjusted
+
+	url, err := createTimeSeriesAdjustedUrl(symbol, interval, outputSize, apiKey)
+	if err == nil {
+		var body []byte
+		if body, err = ApiGetResponseBodyContext(ctx, url, opts...); err == nil {
+			tsa := TsAdjusted{}
+			if err = json.Unmarshal(body, &tsa); err != nil {
+				// Error
+			} else if len(tsa.ErrorMessage) > 0 {
+				err = errors.New(tsa.ErrorMessage)
+			} else if tsa.Ts == nil && len(tsa.Information) > 0 {
+				err = errors.New(tsa.Information)
+			} else {
+				tsAdjusted = &tsa
+			}
+		}
+	}
+
+	return tsAdjusted, err
+}
+
+func newTimeSeriesBar(date string, ts TimeSeriesAdjusted) (stock.Bar, error) {
+	bar := stock.Bar{}
+	var err error
+	if bar.Time, err = time.Parse(timeSeriesDate, date); err != nil {
+		// Error
+	} else if bar.Open, err = fp.NewSErr(ts.Open); err != nil {
+		// Error
+	} else if bar.High, err = fp.NewSErr(ts.High); err != nil {
+		// Error
+	} else if bar.Low, err = fp.NewSErr(ts.Low); err != nil {
+		// Error
+	} else if bar.Close, err = fp.NewSErr(ts.Close); err != nil {
+		// Error
+	} else if bar.AdjClose, err = fp.NewSErr(ts.AdjustedClose); err != nil {
+		// Error
+	} else {
+		bar.Volume, err = strconv.ParseInt(ts.Volume, 10, 64)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("invalid time series data for %s: %w", date, err)
+	}
+	return bar, err
+}
+
+// Returns the bars of a time series from one date to another, oldest first
+func getTimeSeriesBars(ts *TsAdjusted, from, to time.Time) ([]stock.Bar, error) {
+	bars := []stock.Bar{}
+	for date, val := range ts.Ts {
+		bar, err := newTimeSeriesBar(date, val)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bar.Time.Before(from) && !bar.Time.After(to) {
+			bars = append(bars, bar)
+		}
+	}
+
+	sort.Slice(bars, func(i, j int) bool {
+		return bars[i].Time.Before(bars[j].Time)
+	})
+	return bars, nil
+}
@@ -0,0 +1,69 @@
+package alphavantage
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTimeSeriesWeeklyAdjusted = `{
+	"Meta Data": {"1. Information": "Weekly Adjusted Prices and Volumes", "2. Symbol": "IBM"},
+	"Weekly Adjusted Time Series": {
+		"2023-01-13": {"1. open": "141.2100", "2. high": "147.1800", "3. low": "140.3800", "4. close": "145.8900", "5. adjusted close": "139.5431", "6. volume": "20337395", "7. dividend amount": "0.0000"},
+		"2023-01-06": {"1. open": "141.1000", "2. high": "144.2500", "3. low": "139.6700", "4. close": "143.7000", "5. adjusted close": "137.4484", "6. volume": "16120316", "7. dividend amount": "0.0000"},
+		"2022-12-30": {"1. open": "141.7300", "2. high": "142.8100", "3. low": "139.4500", "4. close": "140.8900", "5. adjusted close": "134.7607", "6. volume": "11384316", "7. dividend amount": "0.0000"}
+	}
+}`
+
+func TestCreateTimeSeriesAdjustedUrl(t *testing.T) {
+	url, err := createTimeSeriesAdjustedUrl("IBM", stock.IntervalDaily, "compact", "test")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.alphavantage.co/query?function=TIME_SERIES_DAILY_ADJUSTED&symbol=IBM&outputsize=compact&apikey=test", url)
+
+	url, err = createTimeSeriesAdjustedUrl("IBM", stock.IntervalMonthly, "full", "test")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.alphavantage.co/query?function=TIME_SERIES_MONTHLY_ADJUSTED&symbol=IBM&outputsize=full&apikey=test", url)
+
+	_, err = createTimeSeriesAdjustedUrl("IBM", "5min", "full", "test")
+	assert.NotNil(t, err)
+}
+
+func TestGetTimeSeriesOutputSize(t *testing.T) {
+	now := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "compact", getTimeSeriesOutputSize(stock.IntervalDaily, now.AddDate(0, -1, 0), now))
+	assert.Equal(t, "full", getTimeSeriesOutputSize(stock.IntervalDaily, now.AddDate(-1, 0, 0), now))
+	assert.Equal(t, "full", getTimeSeriesOutputSize(stock.IntervalWeekly, now.AddDate(0, -1, 0), now))
+}
+
+func TestTsAdjusted_UnmarshalJSON(t *testing.T) {
+	ts := TsAdjusted{}
+	assert.Nil(t, json.Unmarshal([]byte(testTimeSeriesWeeklyAdjusted), &ts))
+	assert.Equal(t, 3, len(ts.Ts))
+	assert.Equal(t, "139.5431", ts.Ts["2023-01-13"].AdjustedClose)
+
+	ts = TsAdjusted{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"Error Message": "Invalid API call."}`), &ts))
+	assert.Equal(t, "Invalid API call.", ts.ErrorMessage)
+	assert.Nil(t, ts.Ts)
+}
+
+func TestGetTimeSeriesBars(t *testing.T) {
+	ts := TsAdjusted{}
+	assert.Nil(t, json.Unmarshal([]byte(testTimeSeriesWeeklyAdjusted), &ts))
+
+	bars, err := getTimeSeriesBars(&ts, time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, time.January, 13, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(bars))
+	assert.Equal(t, time.Date(2023, time.January, 6, 0, 0, 0, 0, time.UTC), bars[0].Time)
+	assert.Equal(t, "143.7000", bars[0].Close.StringN(4))
+	assert.Equal(t, "137.4484", bars[0].AdjClose.StringN(4))
+	assert.Equal(t, int64(16120316), bars[0].Volume)
+	assert.Equal(t, time.Date(2023, time.January, 13, 0, 0, 0, 0, time.UTC), bars[1].Time)
+
+	ts.Ts["2023-01-20"] = TimeSeriesAdjusted{Open: "n/a"}
+	_, err = getTimeSeriesBars(&ts, time.Time{}, time.Now())
+	assert.NotNil(t, err)
+}
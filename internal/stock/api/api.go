@@ -1,10 +1,13 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -18,12 +21,14 @@ import (
 const (
 	ApiKeyEnvName    = "STOCKER_API_KEY"
 	ApiServerEnvName = "STOCKER_API_SERVER"
+	FxApiKeyEnvName  = "STOCKER_FX_API_KEY"
 
 	DefaultClientTimeout = time.Second * 4
 
-	DefaultRequestBackoffDelay = time.Millisecond * 125
-	DefaultRequestBackoffLimit = time.Second
-	DefaultRequestRetryLimit   = 10
+	DefaultRequestBackoffDelay    = time.Millisecond * 125
+	DefaultRequestBackoffLimit    = time.Second
+	DefaultRequestRetryAfterLimit = time.Minute
+	DefaultRequestRetryLimit      = 10
 )
 
 var Client *http.Client = &http.Client{
@@ -39,41 +44,212 @@ var Client *http.Client = &http.Client{
 type OAuthCredentials struct {
 	AccessToken  string
 	ApiServer    string
-	ExpiresIn    int
+	ExpiresIn    int       // Seconds until the access token expires
+	IssuedAt     time.Time // Time the access token was issued, if known
 	RefreshToken string
 	TokenType    string
 }
 
+// CredentialsStore persists the credentials of a stock API so that the new
+// single-use refresh token is not lost after the credentials are refreshed.
+// The store is locked while the credentials are refreshed so that concurrent
+// processes do not redeem the same refresh token.
+type CredentialsStore interface {
+	Load() (OAuthCredentials, error)
+	Lock() error
+	Save(creds *OAuthCredentials) error
+	Unlock() error
+}
+
+// ApiResponseError is returned for API responses without a 200 status code
+type ApiResponseError struct {
+	Body       string
+	StatusCode int
+}
+
+func (e *ApiResponseError) Error() string {
+	return fmt.Sprintf("API response status code: %d, details: %s", e.StatusCode, e.Body)
+}
+
+// ErrRequestLimit is matched by errors returned when the request limit of a
+// stock API has been reached
+var ErrRequestLimit = errors.New("request limit reached")
+
+// RequestLimitError is returned for API responses reporting that the request
+// limit has been reached without an error status code
+type RequestLimitError struct {
+	Message string
+}
+
+func (e *RequestLimitError) Error() string {
+	return e.Message
+}
+
+func (e *RequestLimitError) Is(target error) bool {
+	return target == ErrRequestLimit
+}
+
+// ErrRefreshTokenInvalid is returned when credentials cannot be refreshed
+// because the refresh token has expired or has already been used
+var ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+
+// ExpiresAt returns the time the access token expires, or false if the time
+// the access token was issued is not known
+func (c *OAuthCredentials) ExpiresAt() (time.Time, bool) {
+	if c.IssuedAt.IsZero() || c.ExpiresIn <= 0 {
+		return time.Time{}, false
+	}
+	return c.IssuedAt.Add(time.Duration(c.ExpiresIn) * time.Second), true
+}
+
+// IsUnauthorized returns true if an error is an API response with a 401
+// status code
+func IsUnauthorized(err error) bool {
+	var rerr *ApiResponseError
+	return errors.As(err, &rerr) && rerr.StatusCode == http.StatusUnauthorized
+}
+
+// IsRequestLimit returns true if an error was caused by reaching the request
+// limit of a stock API
+func IsRequestLimit(err error) bool {
+	var rerr *ApiResponseError
+	if errors.As(err, &rerr) && rerr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return errors.Is(err, ErrRequestLimit)
+}
+
+// AccountApi is implemented by stock APIs that can read the holdings of
+// brokerage accounts
+type AccountApi interface {
+	GetAccounts() ([]stock.Account, error)
+	GetBalances(accountId string) ([]stock.Balance, error)
+	GetPositions(accountId string) ([]stock.Position, error)
+}
+
+// OrderApi is implemented by stock APIs that can place orders in brokerage
+// accounts. The impact of an order can be found without placing it.
+type OrderApi interface {
+	GetOrderImpact(accountId string, order stock.Order) (stock.OrderImpact, error)
+	PlaceOrder(accountId string, order stock.Order) (string, error)
+}
+
+// FxApi looks up exchange rates. Every stock API is also an exchange rate API,
+// but exchange rate APIs do not need to provide quotes.
+type FxApi interface {
+	GetCurrency(currency, currencyTo string) (stock.Currency, error)
+}
+
 type StockApi interface {
 	GetCurrency(currency, currencyTo string) (stock.Currency, error)
+	// GetHistory returns the price bars of a symbol from one time to another,
+	// oldest first
+	GetHistory(symbol, interval string, from, to time.Time) ([]stock.Bar, error)
 	GetQuote(symbol string) (stock.Quote, error)
 	GetSymbol(symbol string) (stock.Symbol, error)
 	RefreshCredentials() (*OAuthCredentials, error)
 }
 
+// StockApiContext is implemented by stock APIs whose requests, including
+// retries and rate limit delays, are cancelled when a context is done
+type StockApiContext interface {
+	GetCurrencyContext(ctx context.Context, currency, currencyTo string) (stock.Currency, error)
+	GetHistoryContext(ctx context.Context, symbol, interval string, from, to time.Time) ([]stock.Bar, error)
+	GetQuoteContext(ctx context.Context, symbol string) (stock.Quote, error)
+	GetSymbolContext(ctx context.Context, symbol string) (stock.Symbol, error)
+	RefreshCredentialsContext(ctx context.Context) (*OAuthCredentials, error)
+}
+
+// FxApiContext is implemented by exchange rate APIs whose requests are
+// cancelled when a context is done
+type FxApiContext interface {
+	GetCurrencyContext(ctx context.Context, currency, currencyTo string) (stock.Currency, error)
+}
+
+// AccountApiContext is implemented by account APIs whose requests are
+// cancelled when a context is done
+type AccountApiContext interface {
+	GetAccountsContext(ctx context.Context) ([]stock.Account, error)
+	GetBalancesContext(ctx context.Context, accountId string) ([]stock.Balance, error)
+	GetPositionsContext(ctx context.Context, accountId string) ([]stock.Position, error)
+}
+
+// OrderApiContext is implemented by order APIs whose requests are cancelled
+// when a context is done
+type OrderApiContext interface {
+	GetOrderImpactContext(ctx context.Context, accountId string, order stock.Order) (stock.OrderImpact, error)
+	PlaceOrderContext(ctx context.Context, accountId string, order stock.Order) (string, error)
+}
+
 func GetApiKeyFromEnv() string {
 	return os.Getenv(ApiKeyEnvName)
 }
 
 func GetApiResponseBody(url, accessToken string, isRetryable func(*http.Response) bool) ([]byte, error) {
+	return GetApiResponseBodyContext(context.Background(), url, accessToken, isRetryable)
+}
+
+// GetApiResponseBodyContext makes a GET request using the default retry
+// policy until the context is done
+func GetApiResponseBodyContext(ctx context.Context, url, accessToken string, isRetryable func(*http.Response) bool, opts ...Option) ([]byte, error) {
+	return GetApiResponseBodyWithRetryContext(ctx, url, accessToken, DefaultRetryPolicy(), isRetryable, opts...)
+}
+
+// GetApiResponseBodyWithRetry makes a GET request, retrying failed requests
+// using a retry policy
+func GetApiResponseBodyWithRetry(url, accessToken string, policy RetryPolicy, isRetryable func(*http.Response) bool) ([]byte, error) {
+	return GetApiResponseBodyWithRetryContext(context.Background(), url, accessToken, policy, isRetryable)
+}
+
+// GetApiResponseBodyWithRetryContext makes a GET request, retrying failed
+// requests using a retry policy until the context is done. The options select
+// the HTTP client and server of the request.
+func GetApiResponseBodyWithRetryContext(ctx context.Context, url, accessToken string, policy RetryPolicy, isRetryable func(*http.Response) bool, opts ...Option) ([]byte, error) {
+	return getApiResponseBody(ctx, http.MethodGet, url, accessToken, nil, policy, isRetryable, NewOptions(opts...))
+}
+
+// PostApiResponseBodyWithRetry makes a POST request with a JSON body,
+// retrying failed requests using a retry policy. Requests that change state
+// on the server should use a policy that does not retry.
+func PostApiResponseBodyWithRetry(url, accessToken string, reqBody []byte, policy RetryPolicy, isRetryable func(*http.Response) bool) ([]byte, error) {
+	return PostApiResponseBodyWithRetryContext(context.Background(), url, accessToken, reqBody, policy, isRetryable)
+}
+
+// PostApiResponseBodyWithRetryContext makes a POST request with a JSON body,
+// retrying failed requests using a retry policy until the context is done
+func PostApiResponseBodyWithRetryContext(ctx context.Context, url, accessToken string, reqBody []byte, policy RetryPolicy, isRetryable func(*http.Response) bool, opts ...Option) ([]byte, error) {
+	return getApiResponseBody(ctx, http.MethodPost, url, accessToken, reqBody, policy, isRetryable, NewOptions(opts...))
+}
+
+func getApiResponseBody(ctx context.Context, method, url, accessToken string, reqBody []byte, policy RetryPolicy, isRetryable func(*http.Response) bool, opts Options) ([]byte, error) {
 	var body []byte
 
 	//fmt.Println("Making request to: ", url)
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	var reader io.Reader
+	if reqBody != nil {
+		reader = bytes.NewReader(reqBody)
+	}
+
+	url, err := opts.getUrl(url)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err == nil {
 		req.Header.Set("Content-Type", "application/json")
 		if len(accessToken) > 0 {
 			req.Header.Set("Authorization", "Bearer "+accessToken)
 		}
 
-		MakeApiRequestWithRetry(Client, req, func(res *http.Response, rerr error) bool {
+		MakeApiRequestWithRetryPolicy(opts.getClient(), req, policy, func(res *http.Response, rerr error) bool {
 			retry := false
 			err = rerr
 			if err == nil {
 				body, err = ioutil.ReadAll(res.Body)
 				if res.StatusCode != http.StatusOK {
-					err = errors.New(fmt.Sprintf("API response status code: %d, details: %s", res.StatusCode, string(body)))
+					err = &ApiResponseError{Body: string(body), StatusCode: res.StatusCode}
 					retry = (isRetryable != nil && isRetryable(res))
 				}
 			} else {
@@ -90,37 +266,91 @@ func GetApiServerFromEnv() string {
 	return os.Getenv(ApiServerEnvName)
 }
 
+// GetFxApiKeyFromEnv returns the access key of the exchange rate servers
+func GetFxApiKeyFromEnv() string {
+	return os.Getenv(FxApiKeyEnvName)
+}
+
 func MakeApiRequestWithRetry(client *http.Client, req *http.Request, retryCb func(res *http.Response, err error) bool) {
-	backoff := DefaultRequestBackoffDelay
-	backoffLimit := DefaultRequestBackoffLimit
+	MakeApiRequestWithRetryPolicy(client, req, DefaultRetryPolicy(), retryCb)
+}
+
+// MakeApiRequestWithRetryPolicy makes a request until the retry callback
+// returns false or the retry limit is reached. A delay requested by the server
+// with the Retry-After or X-RateLimit-Reset headers is used instead of the
+// backoff delay, unless it is longer than the retry after cap or the time
+// left before the context deadline, in which case the retry callback is called
+// with a request limit error and no more requests are made. If the context of
+// the request is done while waiting to retry, the retry callback is called
+// with the context error and no more requests are made.
+func MakeApiRequestWithRetryPolicy(client *http.Client, req *http.Request, policy RetryPolicy, retryCb func(res *http.Response, err error) bool) {
 	retry := 0
-	retryLimit := DefaultRequestRetryLimit
+	retryLimit := policy.Limit
 
 	if retryCb == nil {
 		retry = retryLimit
 	}
 
 	for retry < retryLimit {
+		// The request body was read by the previous attempt
+		if retry > 0 && req.GetBody != nil {
+			if body, err := req.GetBody(); err == nil {
+				req.Body = body
+			}
+		}
+
+		// Secrets are redacted from the dumps (see Redact)
 		if buf, err := httputil.DumpRequest(req, true); err == nil {
-			log.Debug(string(buf))
+			log.Debug(Redact(string(buf)))
 		}
 
 		res, err := client.Do(req)
 		if err == nil {
 			if buf, err := httputil.DumpResponse(res, true); err == nil {
-				log.Debug(string(buf))
+				log.Debug(Redact(string(buf)))
 			}
+		} else {
+			err = redactError(err)
 		}
 
 		if retryCb(res, err) {
-			time.Sleep(backoff)
-			backoff = backoff * 2
-			if backoff > backoffLimit {
-				backoff = backoffLimit
-			}
 			retry++
+			if retry < retryLimit {
+				now := time.Now()
+				delay, requested := getRetryAfter(res, now)
+				if requested {
+					if limit := policy.getRetryAfterCap(req.Context(), now); delay > limit {
+						retryCb(nil, &RequestLimitError{Message: fmt.Sprintf("server requested a retry delay of %s, more than the maximum of %s", delay.Round(time.Second), limit.Round(time.Second))})
+						break
+					}
+					log.Debug("Retrying request after server requested delay of ", delay)
+				} else {
+					delay = policy.getBackoff(retry-1, rand.Float64())
+				}
+				if err := sleepContext(req.Context(), delay); err != nil {
+					retryCb(nil, err)
+					break
+				}
+			}
 		} else {
 			break
 		}
 	}
 }
+
+// Sleep until the delay has passed or the context is done, returning the
+// context error if the context is done first
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
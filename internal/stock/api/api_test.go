@@ -0,0 +1,18 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRequestLimit(t *testing.T) {
+	assert.True(t, IsRequestLimit(&RequestLimitError{Message: "limit"}))
+	assert.True(t, IsRequestLimit(fmt.Errorf("quote: %w", &RequestLimitError{Message: "limit"})))
+	assert.True(t, IsRequestLimit(&ApiResponseError{StatusCode: http.StatusTooManyRequests}))
+	assert.False(t, IsRequestLimit(&ApiResponseError{StatusCode: http.StatusInternalServerError}))
+	assert.False(t, IsRequestLimit(errors.New("limit")))
+}
@@ -0,0 +1,255 @@
+// Package apitest checks that stock APIs map their upstream data into the
+// stock types the same way. Each stock API serves the contract market data
+// from a fake server in its own format, and Run checks the results of every
+// StockApi method against the contract.
+package apitest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// Symbols and currencies of the contract market data
+const (
+	Symbol          = "VTI"
+	LimitedSymbol   = "LIMIT"  // Requests for the symbol reach the request limit
+	UnknownSymbol   = "XYZXYZ" // Requests for the symbol find no matches
+	Currency        = "USD"
+	CurrencyTo      = "CAD"
+	UnknownCurrency = "XYZ"
+)
+
+// Quote prices that a stock API may not provide
+const (
+	PriceAsk         = "Ask"
+	PriceBid         = "Bid"
+	PriceClose       = "Close"
+	PriceLatestTrHrs = "LatestTrHrs"
+)
+
+var (
+	// Bars are the daily history of the symbol from HistoryFrom to HistoryTo
+	Bars = []stock.Bar{
+		{AdjClose: fp.NewS("208.19"), Close: fp.NewS("208.19"), High: fp.NewS("208.26"), Low: fp.NewS("206.19"), Open: fp.NewS("207.55"), Time: HistoryFrom, Volume: 5245100},
+		{AdjClose: fp.NewS("210.05"), Close: fp.NewS("210.05"), High: fp.NewS("210.41"), Low: fp.NewS("207.36"), Open: fp.NewS("208"), Time: HistoryTo, Volume: 3702400},
+	}
+	HistoryFrom = time.Date(2023, time.May, 31, 0, 0, 0, 0, time.UTC)
+	HistoryTo   = time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	// Quote of the symbol. The close price is the previous close, the latest
+	// price includes extended hours trading, and the latest trading hours
+	// price does not.
+	Quote = newQuote()
+
+	// Rate is the exchange rate from Currency to CurrencyTo
+	Rate = "1.3421"
+
+	// SymbolInfo is the symbol information of the symbol. The type of a symbol
+	// depends on the stock API.
+	SymbolInfo = stock.Symbol{
+		Currency:    Currency,
+		Description: "Vanguard Total Stock Market ETF",
+		Symbol:      Symbol,
+	}
+)
+
+// Contract is a stock API under test and the fake server it sends requests to
+type Contract struct {
+	// Credentials is true if the stock API refreshes OAuth credentials, or
+	// false if refreshing credentials is not supported
+	Credentials bool
+
+	// Handler serves the contract market data in the format of the stock
+	// API. Stock APIs that make no requests have no handler.
+	Handler http.Handler
+
+	// NewApi creates the stock API under test, which must send its requests
+	// to the fake server using the options
+	NewApi func(opts ...api.Option) api.StockApi
+
+	// RequestLimit is true if the fake server limits the requests for
+	// LimitedSymbol
+	RequestLimit bool
+
+	// Unsupported quote prices, which must be zero
+	Unsupported []string
+}
+
+func newQuote() stock.Quote {
+	qte := stock.Quote{Symbol: Symbol, Volume: "3306428"}
+	qte.Prices.Ask = 221.14
+	qte.Prices.Bid = 221.1
+	qte.Prices.Close = 219.47
+	qte.Prices.High = 221.47
+	qte.Prices.Low = 219.53
+	qte.Prices.Open = 219.9
+	qte.Prices.Latest = 221.2
+	qte.Prices.LatestTrHrs = 221.13
+	return qte
+}
+
+func getPrices(qte stock.Quote) map[string]float64 {
+	return map[string]float64{
+		PriceAsk:         qte.Prices.Ask,
+		PriceBid:         qte.Prices.Bid,
+		PriceClose:       qte.Prices.Close,
+		"High":           qte.Prices.High,
+		"Latest":         qte.Prices.Latest,
+		PriceLatestTrHrs: qte.Prices.LatestTrHrs,
+		"Low":            qte.Prices.Low,
+		"Open":           qte.Prices.Open,
+	}
+}
+
+// Creates the stock API under test with its own fake server. Returns the
+// number of requests made to the fake server so far.
+func (c *Contract) newApi(t *testing.T) (api.StockApi, func() int64) {
+	if c.Handler == nil {
+		return c.NewApi(), func() int64 { return 0 }
+	}
+
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		c.Handler.ServeHTTP(w, req)
+	}))
+	t.Cleanup(server.Close)
+
+	stockApi := c.NewApi(api.WithBaseUrl(server.URL), api.WithHttpClient(server.Client()))
+	return stockApi, func() int64 { return atomic.LoadInt64(&requests) }
+}
+
+// Run checks that a stock API follows the contract
+func Run(t *testing.T, c Contract) {
+	t.Run("GetCurrency", func(t *testing.T) {
+		stockApi, requests := c.newApi(t)
+		ccy, err := stockApi.GetCurrency(Currency, CurrencyTo)
+		assert.Nil(t, err)
+		assert.Equal(t, Currency, ccy.Currency)
+		assert.Equal(t, Rate, ccy.Rates[CurrencyTo].String())
+
+		// Exchange rates are cached
+		count := requests()
+		ccy, err = stockApi.GetCurrency(Currency, CurrencyTo)
+		assert.Nil(t, err)
+		assert.Equal(t, Rate, ccy.Rates[CurrencyTo].String())
+		assert.Equal(t, count, requests())
+
+		_, err = stockApi.GetCurrency(Currency, UnknownCurrency)
+		assert.True(t, errors.Is(err, syscall.ENOENT), "unknown currency: %v", err)
+	})
+
+	t.Run("GetHistory", func(t *testing.T) {
+		stockApi, _ := c.newApi(t)
+		bars, err := stockApi.GetHistory(Symbol, stock.IntervalDaily, HistoryFrom, HistoryTo)
+		assert.Nil(t, err)
+		if assert.Equal(t, len(Bars), len(bars)) {
+			for i := range Bars {
+				assert.Equal(t, Bars[i].Time, bars[i].Time)
+				assert.Equal(t, Bars[i].Open.String(), bars[i].Open.String(), "open %s", Bars[i].Time)
+				assert.Equal(t, Bars[i].High.String(), bars[i].High.String(), "high %s", Bars[i].Time)
+				assert.Equal(t, Bars[i].Low.String(), bars[i].Low.String(), "low %s", Bars[i].Time)
+				assert.Equal(t, Bars[i].Close.String(), bars[i].Close.String(), "close %s", Bars[i].Time)
+				assert.Equal(t, Bars[i].AdjClose.String(), bars[i].AdjClose.String(), "adjusted close %s", Bars[i].Time)
+				assert.Equal(t, Bars[i].Volume, bars[i].Volume, "volume %s", Bars[i].Time)
+			}
+		}
+
+		_, err = stockApi.GetHistory(UnknownSymbol, stock.IntervalDaily, HistoryFrom, HistoryTo)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("GetQuote", func(t *testing.T) {
+		stockApi, requests := c.newApi(t)
+		qte, err := stockApi.GetQuote(Symbol)
+		assert.Nil(t, err)
+		assert.Equal(t, Quote.Symbol, qte.Symbol)
+		assert.Equal(t, Quote.Volume, qte.Volume)
+
+		prices := getPrices(Quote)
+		for _, name := range c.Unsupported {
+			prices[name] = 0
+		}
+		assert.Equal(t, prices, getPrices(qte))
+
+		// Quotes are cached
+		count := requests()
+		qte, err = stockApi.GetQuote(Symbol)
+		assert.Nil(t, err)
+		assert.Equal(t, Quote.Symbol, qte.Symbol)
+		assert.Equal(t, count, requests())
+
+		_, err = stockApi.GetQuote(UnknownSymbol)
+		assert.True(t, errors.Is(err, syscall.ENOENT), "unknown symbol: %v", err)
+	})
+
+	t.Run("GetSymbol", func(t *testing.T) {
+		stockApi, requests := c.newApi(t)
+		sym, err := stockApi.GetSymbol(Symbol)
+		assert.Nil(t, err)
+		assert.Equal(t, SymbolInfo.Currency, sym.Currency)
+		assert.Equal(t, SymbolInfo.Description, sym.Description)
+		assert.Equal(t, SymbolInfo.Symbol, sym.Symbol)
+		assert.NotEmpty(t, sym.Type)
+
+		// Symbols are cached
+		count := requests()
+		sym, err = stockApi.GetSymbol(Symbol)
+		assert.Nil(t, err)
+		assert.Equal(t, SymbolInfo.Symbol, sym.Symbol)
+		assert.Equal(t, count, requests())
+
+		_, err = stockApi.GetSymbol(UnknownSymbol)
+		assert.True(t, errors.Is(err, syscall.ENOENT), "unknown symbol: %v", err)
+	})
+
+	t.Run("RefreshCredentials", func(t *testing.T) {
+		stockApi, _ := c.newApi(t)
+		creds, err := stockApi.RefreshCredentials()
+		if c.Credentials {
+			assert.Nil(t, err)
+			if assert.NotNil(t, creds) {
+				assert.NotEmpty(t, creds.AccessToken)
+				assert.NotEmpty(t, creds.ApiServer)
+			}
+
+			// Requests are made with the new credentials
+			_, err = stockApi.GetSymbol(Symbol)
+			assert.Nil(t, err)
+		} else {
+			assert.True(t, errors.Is(err, syscall.ENOTSUP), "refresh credentials: %v", err)
+		}
+	})
+
+	t.Run("RequestLimit", func(t *testing.T) {
+		if !c.RequestLimit {
+			t.Skip("no request limit")
+		}
+
+		stockApi, _ := c.newApi(t)
+		_, err := stockApi.GetQuote(LimitedSymbol)
+		assert.True(t, api.IsRequestLimit(err), "request limit: %v", err)
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		stockApi, requests := c.newApi(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// No requests are made once the context is done
+		_, err := api.NewStockApiContext(stockApi).GetQuoteContext(ctx, Symbol)
+		assert.True(t, errors.Is(err, context.Canceled), "cancelled context: %v", err)
+		assert.Equal(t, int64(0), requests())
+	})
+}
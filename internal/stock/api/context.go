@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/shanebarnes/stocker/internal/stock"
+)
+
+// Calls the methods of a stock API without a context, checking that the
+// context is not done before each call
+type contextApi struct {
+	StockApi
+}
+
+type contextFxApi struct {
+	FxApi
+}
+
+type contextAccountApi struct {
+	AccountApi
+}
+
+type contextOrderApi struct {
+	OrderApi
+}
+
+// NewStockApiContext returns a stock API that takes a context. Stock APIs
+// that do not support contexts stop making requests once the context is done,
+// but requests already in flight are not cancelled.
+func NewStockApiContext(stockApi StockApi) StockApiContext {
+	if ctxApi, ok := stockApi.(StockApiContext); ok {
+		return ctxApi
+	}
+	return &contextApi{StockApi: stockApi}
+}
+
+// NewFxApiContext returns an exchange rate API that takes a context
+func NewFxApiContext(fxApi FxApi) FxApiContext {
+	if ctxApi, ok := fxApi.(FxApiContext); ok {
+		return ctxApi
+	}
+	return &contextFxApi{FxApi: fxApi}
+}
+
+// NewAccountApiContext returns an account API that takes a context, or false
+// if the stock API does not support accounts
+func NewAccountApiContext(stockApi StockApi) (AccountApiContext, bool) {
+	if ctxApi, ok := stockApi.(AccountApiContext); ok {
+		return ctxApi, true
+	} else if accountApi, ok := stockApi.(AccountApi); ok {
+		return &contextAccountApi{AccountApi: accountApi}, true
+	}
+	return nil, false
+}
+
+// NewOrderApiContext returns an order API that takes a context, or false if
+// the stock API does not support orders
+func NewOrderApiContext(stockApi StockApi) (OrderApiContext, bool) {
+	if ctxApi, ok := stockApi.(OrderApiContext); ok {
+		return ctxApi, true
+	} else if orderApi, ok := stockApi.(OrderApi); ok {
+		return &contextOrderApi{OrderApi: orderApi}, true
+	}
+	return nil, false
+}
+
+func (c *contextApi) GetCurrencyContext(ctx context.Context, currency, currencyTo string) (stock.Currency, error) {
+	if err := ctx.Err(); err != nil {
+		return stock.Currency{}, err
+	}
+	return c.GetCurrency(currency, currencyTo)
+}
+
+func (c *contextApi) GetHistoryContext(ctx context.Context, symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.GetHistory(symbol, interval, from, to)
+}
+
+func (c *contextApi) GetQuoteContext(ctx context.Context, symbol string) (stock.Quote, error) {
+	if err := ctx.Err(); err != nil {
+		return stock.Quote{}, err
+	}
+	return c.GetQuote(symbol)
+}
+
+func (c *contextApi) GetSymbolContext(ctx context.Context, symbol string) (stock.Symbol, error) {
+	if err := ctx.Err(); err != nil {
+		return stock.Symbol{}, err
+	}
+	return c.GetSymbol(symbol)
+}
+
+func (c *contextApi) RefreshCredentialsContext(ctx context.Context) (*OAuthCredentials, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.RefreshCredentials()
+}
+
+func (c *contextFxApi) GetCurrencyContext(ctx context.Context, currency, currencyTo string) (stock.Currency, error) {
+	if err := ctx.Err(); err != nil {
+		return stock.Currency{}, err
+	}
+	return c.GetCurrency(currency, currencyTo)
+}
+
+func (c *contextAccountApi) GetAccountsContext(ctx context.Context) ([]stock.Account, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.GetAccounts()
+}
+
+func (c *contextAccountApi) GetBalancesContext(ctx context.Context, accountId string) ([]stock.Balance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.GetBalances(accountId)
+}
+
+func (c *contextAccountApi) GetPositionsContext(ctx context.Context, accountId string) ([]stock.Position, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.GetPositions(accountId)
+}
+
+func (c *contextOrderApi) GetOrderImpactContext(ctx context.Context, accountId string, order stock.Order) (stock.OrderImpact, error) {
+	if err := ctx.Err(); err != nil {
+		return stock.OrderImpact{}, err
+	}
+	return c.GetOrderImpact(accountId, order)
+}
+
+func (c *contextOrderApi) PlaceOrderContext(ctx context.Context, accountId string, order stock.Order) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return c.PlaceOrder(accountId, order)
+}
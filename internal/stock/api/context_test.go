@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/stretchr/testify/assert"
+)
+
+type testStockApi struct {
+	calls int
+}
+
+func (a *testStockApi) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	a.calls++
+	return stock.Currency{Currency: currency}, nil
+}
+
+func (a *testStockApi) GetHistory(symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	a.calls++
+	return []stock.Bar{}, nil
+}
+
+func (a *testStockApi) GetQuote(symbol string) (stock.Quote, error) {
+	a.calls++
+	return stock.Quote{Symbol: symbol}, nil
+}
+
+func (a *testStockApi) GetSymbol(symbol string) (stock.Symbol, error) {
+	a.calls++
+	return stock.Symbol{Symbol: symbol}, nil
+}
+
+func (a *testStockApi) RefreshCredentials() (*OAuthCredentials, error) {
+	a.calls++
+	return &OAuthCredentials{}, nil
+}
+
+func TestNewStockApiContext(t *testing.T) {
+	stockApi := &testStockApi{}
+	ctxApi := NewStockApiContext(stockApi)
+
+	qte, err := ctxApi.GetQuoteContext(context.Background(), "VTI")
+	assert.Nil(t, err)
+	assert.Equal(t, "VTI", qte.Symbol)
+	assert.Equal(t, 1, stockApi.calls)
+
+	// Stock APIs without contexts are not called once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ctxApi.GetQuoteContext(ctx, "VTI")
+	assert.Equal(t, context.Canceled, err)
+	_, err = ctxApi.GetSymbolContext(ctx, "VTI")
+	assert.Equal(t, context.Canceled, err)
+	_, err = ctxApi.GetCurrencyContext(ctx, "USD", "CAD")
+	assert.Equal(t, context.Canceled, err)
+	_, err = ctxApi.GetHistoryContext(ctx, "VTI", stock.IntervalDaily, time.Now(), time.Now())
+	assert.Equal(t, context.Canceled, err)
+	_, err = ctxApi.RefreshCredentialsContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, stockApi.calls)
+
+	// Stock APIs with contexts are used as they are
+	assert.Equal(t, ctxApi, NewStockApiContext(ctxApi.(StockApi)))
+
+	_, ok := NewAccountApiContext(stockApi)
+	assert.False(t, ok)
+	_, ok = NewOrderApiContext(stockApi)
+	assert.False(t, ok)
+}
+
+func TestNewFxApiContext(t *testing.T) {
+	fxApi := &testStockApi{}
+	ctxApi := NewFxApiContext(fxApi)
+
+	ccy, err := ctxApi.GetCurrencyContext(context.Background(), "USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, "USD", ccy.Currency)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ctxApi.GetCurrencyContext(ctx, "USD", "CAD")
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, fxApi.calls)
+}
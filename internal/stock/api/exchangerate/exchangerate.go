@@ -2,21 +2,40 @@ package exchangerate
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
+	"syscall"
 	"text/template"
 
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
 	"github.com/shanebarnes/stocker/internal/stock/api"
 )
 
 const (
-	apiCurrencyExchangeRate = `https://api.exchangerate.host/latest?base={{.FromCurrency}}&source=ecb&places=4&symbols={{.ToCurrency}}`
+	apiCurrencyExchangeRate = `https://api.exchangerate.host/latest?base={{.FromCurrency}}&places=4&symbols={{.ToCurrency}}{{if .ApiKey}}&access_key={{.ApiKey}}{{end}}`
+
+	// Error code returned when the monthly request limit has been reached
+	apiErrorCodeUsageLimit = 104
 )
 
+// ApiRetryPolicy controls how failed exchange rate requests are retried
+var ApiRetryPolicy = api.DefaultRetryPolicy()
+
 type tplCurrencyExchangeRate struct {
+	ApiKey       string
 	FromCurrency string
 	ToCurrency   string
 }
 
+type apiError struct {
+	Code int    `json:"code"`
+	Info string `json:"info"`
+	Type string `json:"type"`
+}
+
 type motd struct {
 	Message string `json:"msg"`
 	Url     string `json:"url"`
@@ -25,17 +44,18 @@ type motd struct {
 type ExchangeRate struct {
 	BaseSymbol string             `json:"base"`
 	Date       string             `json:"date"`
+	Error      *apiError          `json:"error,omitempty"`
 	Motd       motd               `json:"motd"`
 	Rates      map[string]float64 `json:"rates"`
 	Success    bool               `json:"success"`
 }
 
-func createCurrencyExchangeRateUrl(fromCurrency, toCurrency string) (string, error) {
+func createCurrencyExchangeRateUrl(fromCurrency, toCurrency, apiKey string) (string, error) {
 	var url bytes.Buffer
 	var err error
 
 	var tpl *template.Template
-	t := tplCurrencyExchangeRate{FromCurrency: fromCurrency, ToCurrency: toCurrency}
+	t := tplCurrencyExchangeRate{ApiKey: apiKey, FromCurrency: fromCurrency, ToCurrency: toCurrency}
 
 	if tpl, err = template.New("api").Parse(apiCurrencyExchangeRate); err == nil {
 		err = tpl.Execute(&url, t)
@@ -60,18 +80,79 @@ func GetCurrencyExchangeRate(fromCurrency, toCurrency, apiKey string) (float64,
 }
 
 func GetCurrencyExchangeRateInfo(fromCurrency, toCurrency, apiKey string) (*ExchangeRate, error) {
+	return GetCurrencyExchangeRateInfoContext(context.Background(), fromCurrency, toCurrency, apiKey)
+}
+
+// GetCurrencyExchangeRateInfoContext looks up the exchange rates of a
+// currency until the context is done
+func GetCurrencyExchangeRateInfoContext(ctx context.Context, fromCurrency, toCurrency, apiKey string, opts ...api.Option) (*ExchangeRate, error) {
 	var rate *ExchangeRate
 
-	url, err := createCurrencyExchangeRateUrl(fromCurrency, toCurrency)
+	url, err := createCurrencyExchangeRateUrl(fromCurrency, toCurrency, apiKey)
 	if err == nil {
 		var body []byte
-		if body, err = api.GetApiResponseBody(url, "", nil); err == nil {
+		if body, err = api.GetApiResponseBodyWithRetryContext(ctx, url, "", ApiRetryPolicy, nil, opts...); err == nil {
 			er := ExchangeRate{}
 			if err = json.Unmarshal(body, &er); err == nil {
-				rate = &er
+				if err = getApiError(er.Error); err == nil {
+					rate = &er
+				}
 			}
 		}
 	}
 
 	return rate, err
 }
+
+// Errors are returned with a 200 status code
+func getApiError(aerr *apiError) error {
+	if aerr == nil {
+		return nil
+	} else if aerr.Code == apiErrorCodeUsageLimit {
+		return &api.RequestLimitError{Message: aerr.Info}
+	}
+	return fmt.Errorf("exchangerate: %s (%d): %s", aerr.Type, aerr.Code, aerr.Info)
+}
+
+type xr struct {
+	apiKey string
+	cache  *stock.Cache
+	opts   []api.Option
+}
+
+func (x *xr) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	return x.GetCurrencyContext(context.Background(), currency, currencyTo)
+}
+
+func (x *xr) GetCurrencyContext(ctx context.Context, currency, currencyTo string) (stock.Currency, error) {
+	ccy, err := x.cache.GetCurrency(currency, currencyTo)
+	if err != nil {
+		var info *ExchangeRate
+		if info, err = GetCurrencyExchangeRateInfoContext(ctx, currency, currencyTo, x.apiKey, x.opts...); err == nil {
+			if rate, exists := info.Rates[currencyTo]; exists {
+				ccy.Currency = currency
+				ccy.Name = currency
+				ccy.Rates = map[string]fp.Fixed{currencyTo: fp.NewF(rate)}
+
+				x.cache.AddCurrency(ccy)
+			} else {
+				err = fmt.Errorf("exchangerate: no exchange rate from %s to %s: %w", currency, currencyTo, syscall.ENOENT)
+			}
+		}
+	}
+	return ccy, err
+}
+
+func IsApiExchangerate(apiServer string) bool {
+	return strings.HasSuffix(apiServer, "exchangerate.host")
+}
+
+// NewFxExchangerate creates an exchangerate.host exchange rate API. An
+// in-memory cache is used if no cache is provided. The options select the HTTP
+// client and server of the API.
+func NewFxExchangerate(apiKey string, cache *stock.Cache, opts ...api.Option) api.FxApi {
+	if cache == nil {
+		cache = stock.NewCache()
+	}
+	return &xr{apiKey: apiKey, cache: cache, opts: opts}
+}
@@ -0,0 +1,41 @@
+package exchangerate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateCurrencyExchangeRateUrl(t *testing.T) {
+	url, err := createCurrencyExchangeRateUrl("USD", "CAD", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://api.exchangerate.host/latest?base=USD&places=4&symbols=CAD", url)
+
+	url, err = createCurrencyExchangeRateUrl("USD", "CAD", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://api.exchangerate.host/latest?base=USD&places=4&symbols=CAD&access_key=key", url)
+}
+
+func TestGetApiError(t *testing.T) {
+	assert.Nil(t, getApiError(nil))
+	assert.True(t, api.IsRequestLimit(getApiError(&apiError{Code: apiErrorCodeUsageLimit, Info: "usage limit reached"})))
+	assert.NotNil(t, getApiError(&apiError{Code: 101, Type: "missing_access_key"}))
+}
+
+func TestNewFxExchangerate_Options(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/latest", req.URL.Path)
+		assert.Equal(t, "USD", req.URL.Query().Get("base"))
+		w.Write([]byte(`{"base":"USD","rates":{"CAD":1.3456},"success":true}`))
+	}))
+	defer server.Close()
+
+	fx := NewFxExchangerate("", nil, api.WithBaseUrl(server.URL), api.WithHttpClient(server.Client()))
+	ccy, err := fx.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, "USD", ccy.Currency)
+	assert.Equal(t, "1.3456", ccy.Rates["CAD"].String())
+}
@@ -0,0 +1,64 @@
+package exchangerate
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/shanebarnes/stocker/internal/stock/api/replay"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns the access key to record fixtures with. Any access key can replay
+// them, since access keys are masked.
+func getReplayApiKey() string {
+	if apiKey := api.GetFxApiKeyFromEnv(); len(apiKey) > 0 {
+		return apiKey
+	}
+	return "test"
+}
+
+// The fixture can be recorded again with:
+//
+//	STOCKER_RECORD=1 STOCKER_FX_API_KEY=<your_access_key> go test -run TestReplay_FxApi
+func TestReplay_FxApi(t *testing.T) {
+	fx := NewFxExchangerate(getReplayApiKey(), nil, api.WithHttpClient(replay.NewTestClient(t, filepath.Join("testdata", "replay.json"))))
+
+	ccy, err := fx.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, "USD", ccy.Currency)
+	assert.Equal(t, "1.3421", ccy.Rates["CAD"].String())
+
+	// Cached exchange rates are not requested again
+	ccy, err = fx.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.3421", ccy.Rates["CAD"].String())
+
+	ccy, err = fx.GetCurrency("EUR", "USD")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0708", ccy.Rates["USD"].String())
+}
+
+func TestReplay_Errors(t *testing.T) {
+	fx := NewFxExchangerate(getReplayApiKey(), nil, api.WithHttpClient(replay.NewReplayClient(t, filepath.Join("testdata", "errors.json"))))
+
+	// The usage limit error is returned with a 200 status code
+	_, err := fx.GetCurrency("USD", "CAD")
+	assert.True(t, api.IsRequestLimit(err))
+
+	_, err = fx.GetCurrency("USD", "XYZ")
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+
+	_, err = fx.GetCurrency("USD", "EUR")
+	assert.True(t, api.IsRequestLimit(err))
+
+	// Server errors are not retried
+	_, err = fx.GetCurrency("USD", "GBP")
+	var rerr *api.ApiResponseError
+	if assert.True(t, errors.As(err, &rerr)) {
+		assert.Equal(t, http.StatusBadGateway, rerr.StatusCode)
+	}
+}
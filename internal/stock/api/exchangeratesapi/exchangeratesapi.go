@@ -2,33 +2,59 @@ package exchangeratesapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
 	"text/template"
 
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
 	"github.com/shanebarnes/stocker/internal/stock/api"
 )
 
 const (
-	apiCurrencyExchangeRate = `https://api.exchangeratesapi.io/latest?base={{.FromCurrency}}&symbols={{.ToCurrency}}`
+	apiCurrencyExchangeRate = `https://api.exchangeratesapi.io/v1/latest?access_key={{.ApiKey}}&base={{.FromCurrency}}&symbols={{.ToCurrency}}`
+
+	// Error codes returned when the monthly request limit has been reached,
+	// and when the base currency is not EUR on the free plan
+	apiErrorCodeUsageLimit         = 104
+	apiErrorCodeBaseCurrencyAccess = 105
+
+	// Base currency of every plan
+	baseCurrency = "EUR"
 )
 
+// ApiRetryPolicy controls how failed exchange rate requests are retried
+var ApiRetryPolicy = api.DefaultRetryPolicy()
+
 type tplCurrencyExchangeRate struct {
+	ApiKey       string
 	FromCurrency string
 	ToCurrency   string
 }
 
+type apiError struct {
+	Code int    `json:"code"`
+	Info string `json:"info"`
+	Type string `json:"type"`
+}
+
 type ExchangeRate struct {
 	BaseSymbol string             `json:"base"`
 	Date       string             `json:"date"`
+	Error      *apiError          `json:"error,omitempty"`
 	Rates      map[string]float64 `json:"rates"`
 }
 
-func createCurrencyExchangeRateUrl(fromCurrency, toCurrency string) (string, error) {
+func createCurrencyExchangeRateUrl(fromCurrency, toCurrency, apiKey string) (string, error) {
 	var url bytes.Buffer
 	var err error
 
 	var tpl *template.Template
-	t := tplCurrencyExchangeRate{FromCurrency: fromCurrency, ToCurrency: toCurrency}
+	t := tplCurrencyExchangeRate{ApiKey: apiKey, FromCurrency: fromCurrency, ToCurrency: toCurrency}
 
 	if tpl, err = template.New("api").Parse(apiCurrencyExchangeRate); err == nil {
 		err = tpl.Execute(&url, t)
@@ -37,6 +63,16 @@ func createCurrencyExchangeRateUrl(fromCurrency, toCurrency string) (string, err
 	return url.String(), err
 }
 
+// Errors are returned with a 200 status code
+func getApiError(aerr *apiError) error {
+	if aerr == nil {
+		return nil
+	} else if aerr.Code == apiErrorCodeUsageLimit {
+		return &api.RequestLimitError{Message: aerr.Info}
+	}
+	return fmt.Errorf("exchangeratesapi: %s (%d): %s", aerr.Type, aerr.Code, aerr.Info)
+}
+
 func GetCurrencyExchangeRate(fromCurrency, toCurrency, apiKey string) (float64, error) {
 	var xr float64
 
@@ -45,26 +81,107 @@ func GetCurrencyExchangeRate(fromCurrency, toCurrency, apiKey string) (float64,
 		if f, ok := xri.Rates[toCurrency]; ok {
 			xr = f
 		} else {
-			// add error
+			err = fmt.Errorf("exchangeratesapi: no exchange rate from %s to %s: %w", fromCurrency, toCurrency, syscall.ENOENT)
 		}
 	}
 
 	return xr, err
 }
 
+// GetCurrencyExchangeRateInfo looks up the exchange rates from one currency to
+// a comma-separated list of currencies
 func GetCurrencyExchangeRateInfo(fromCurrency, toCurrency, apiKey string) (*ExchangeRate, error) {
+	return GetCurrencyExchangeRateInfoContext(context.Background(), fromCurrency, toCurrency, apiKey)
+}
+
+// GetCurrencyExchangeRateInfoContext looks up exchange rates until the
+// context is done
+func GetCurrencyExchangeRateInfoContext(ctx context.Context, fromCurrency, toCurrency, apiKey string, opts ...api.Option) (*ExchangeRate, error) {
 	var rate *ExchangeRate
 
-	url, err := createCurrencyExchangeRateUrl(fromCurrency, toCurrency)
+	url, err := createCurrencyExchangeRateUrl(fromCurrency, toCurrency, apiKey)
 	if err == nil {
 		var body []byte
-		if body, err = api.GetApiResponseBody(url, "", nil); err == nil {
+		if body, err = api.GetApiResponseBodyWithRetryContext(ctx, url, "", ApiRetryPolicy, nil, opts...); err == nil {
 			er := ExchangeRate{}
 			if err = json.Unmarshal(body, &er); err == nil {
-				rate = &er
+				if er.Error != nil && er.Error.Code == apiErrorCodeBaseCurrencyAccess {
+					err = fmt.Errorf("%w: %w", syscall.EACCES, getApiError(er.Error))
+				} else if err = getApiError(er.Error); err == nil {
+					rate = &er
+				}
 			}
 		}
 	}
 
 	return rate, err
 }
+
+type xr struct {
+	apiKey string
+	cache  *stock.Cache
+	opts   []api.Option
+}
+
+// Returns the exchange rate between two currencies using the EUR exchange
+// rates, since other base currencies are not available on the free plan
+func (x *xr) getCrossRate(ctx context.Context, currency, currencyTo string) (fp.Fixed, error) {
+	info, err := GetCurrencyExchangeRateInfoContext(ctx, baseCurrency, currency+","+currencyTo, x.apiKey, x.opts...)
+	if err != nil {
+		return fp.NaN, err
+	}
+
+	rates := map[string]float64{baseCurrency: 1}
+	for symbol, rate := range info.Rates {
+		rates[symbol] = rate
+	}
+	from, to := rates[currency], rates[currencyTo]
+	if from <= 0 || to <= 0 {
+		return fp.NaN, fmt.Errorf("exchangeratesapi: no exchange rate from %s to %s: %w", currency, currencyTo, syscall.ENOENT)
+	}
+	return fp.NewF(to).Div(fp.NewF(from)), nil
+}
+
+func (x *xr) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	return x.GetCurrencyContext(context.Background(), currency, currencyTo)
+}
+
+func (x *xr) GetCurrencyContext(ctx context.Context, currency, currencyTo string) (stock.Currency, error) {
+	ccy, err := x.cache.GetCurrency(currency, currencyTo)
+	if err != nil {
+		var rate fp.Fixed
+		var info *ExchangeRate
+		if info, err = GetCurrencyExchangeRateInfoContext(ctx, currency, currencyTo, x.apiKey, x.opts...); err == nil {
+			if r, exists := info.Rates[currencyTo]; exists {
+				rate = fp.NewF(r)
+			} else {
+				err = fmt.Errorf("exchangeratesapi: no exchange rate from %s to %s: %w", currency, currencyTo, syscall.ENOENT)
+			}
+		} else if errors.Is(err, syscall.EACCES) {
+			rate, err = x.getCrossRate(ctx, currency, currencyTo)
+		}
+
+		if err == nil {
+			ccy.Currency = currency
+			ccy.Name = currency
+			ccy.Rates = map[string]fp.Fixed{currencyTo: rate}
+
+			x.cache.AddCurrency(ccy)
+		}
+	}
+	return ccy, err
+}
+
+func IsApiExchangeratesapi(apiServer string) bool {
+	return strings.HasSuffix(apiServer, "exchangeratesapi.io")
+}
+
+// NewFxExchangeratesapi creates an exchangeratesapi.io exchange rate API,
+// which requires an access key. An in-memory cache is used if no cache is
+// provided. The options select the HTTP client and server of the API.
+func NewFxExchangeratesapi(apiKey string, cache *stock.Cache, opts ...api.Option) api.FxApi {
+	if cache == nil {
+		cache = stock.NewCache()
+	}
+	return &xr{apiKey: apiKey, cache: cache, opts: opts}
+}
@@ -0,0 +1,27 @@
+package exchangeratesapi
+
+import (
+	"testing"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateCurrencyExchangeRateUrl(t *testing.T) {
+	url, err := createCurrencyExchangeRateUrl("EUR", "USD,CAD", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://api.exchangeratesapi.io/v1/latest?access_key=key&base=EUR&symbols=USD,CAD", url)
+}
+
+func TestGetApiError(t *testing.T) {
+	assert.Nil(t, getApiError(nil))
+	assert.True(t, api.IsRequestLimit(getApiError(&apiError{Code: apiErrorCodeUsageLimit, Info: "usage limit reached"})))
+
+	err := getApiError(&apiError{Code: 101, Info: "You have not supplied an API Access Key.", Type: "missing_access_key"})
+	assert.Equal(t, "exchangeratesapi: missing_access_key (101): You have not supplied an API Access Key.", err.Error())
+}
+
+func TestIsApiExchangeratesapi(t *testing.T) {
+	assert.True(t, IsApiExchangeratesapi("exchangeratesapi.io"))
+	assert.False(t, IsApiExchangeratesapi("exchangerate.host"))
+}
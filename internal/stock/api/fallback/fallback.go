@@ -0,0 +1,338 @@
+package fallback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// Operations that can be tried with more than one provider
+const (
+	OperationCurrency = "currency"
+	OperationHistory  = "history"
+	OperationQuote    = "quote"
+	OperationSymbol   = "symbol"
+)
+
+// Provider is a stock API and the name used to report the values it served
+type Provider struct {
+	Api  api.StockApi
+	Name string
+}
+
+// FxProvider is an exchange rate API and the name used to report the
+// exchange rates it served
+type FxProvider struct {
+	Api  api.FxApi
+	Name string
+}
+
+// Source is the provider that served the value of an operation, such as the
+// quote of a symbol or the exchange rate of a currency pair
+type Source struct {
+	Key       string
+	Operation string
+	Provider  string
+}
+
+// The provider that served each value
+type sources struct {
+	mutex   sync.Mutex
+	sources map[string]Source // map[operation key]Source
+}
+
+// Fallback is a stock API that tries a list of providers in order for each
+// operation, failing over to the next provider if a provider returns an error,
+// e.g. when its request limit has been reached
+type Fallback struct {
+	sources
+	order   map[string][]Provider // map[operation]Providers
+	primary Provider
+}
+
+// FxFallback is an exchange rate API that tries a list of providers in order
+type FxFallback struct {
+	sources
+	providers []FxProvider
+}
+
+// NewApiFallback creates a stock API that tries the providers of each
+// operation in order. Operations without providers only use the primary
+// provider, which also serves accounts, orders and credential refreshes.
+func NewApiFallback(primary Provider, order map[string][]Provider) *Fallback {
+	f := Fallback{
+		order:   map[string][]Provider{},
+		primary: primary,
+		sources: sources{sources: map[string]Source{}},
+	}
+	for op, providers := range order {
+		if len(providers) > 0 {
+			f.order[op] = providers
+		}
+	}
+	return &f
+}
+
+func (f *Fallback) getProviders(op string) []Provider {
+	if providers, exists := f.order[op]; exists {
+		return providers
+	}
+	return []Provider{f.primary}
+}
+
+// Returns every provider once, starting with the primary provider
+func (f *Fallback) getUniqueProviders() []Provider {
+	names := map[string]bool{f.primary.Name: true}
+	providers := []Provider{f.primary}
+	for _, op := range []string{OperationCurrency, OperationHistory, OperationQuote, OperationSymbol} {
+		for _, provider := range f.order[op] {
+			if !names[provider.Name] {
+				names[provider.Name] = true
+				providers = append(providers, provider)
+			}
+		}
+	}
+	return providers
+}
+
+func (s *sources) setSource(op, key, provider string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sources[op+" "+key] = Source{Key: key, Operation: op, Provider: provider}
+}
+
+// Try providers in order until one of them succeeds. The errors of every
+// provider are returned if none of them succeed. No more providers are tried
+// once the context is done.
+func try[T any](ctx context.Context, s *sources, op, key string, names []string, get func(i int) (T, error)) (T, error) {
+	var val T
+	errs := []error{}
+	for i, name := range names {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		var err error
+		if val, err = get(i); err == nil {
+			if len(errs) > 0 {
+				log.Warn("Using ", name, " for ", op, " of ", key)
+			}
+			log.Debug("The ", op, " of ", key, " was served by ", name)
+			s.setSource(op, key, name)
+			return val, nil
+		}
+
+		if api.IsRequestLimit(err) {
+			log.Warn("Request limit of ", name, " reached for ", op, " of ", key)
+		} else {
+			log.Debug("Failed to get ", op, " of ", key, " from ", name, ": ", err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+	return val, errors.Join(errs...)
+}
+
+// Try the providers of an operation in order
+func tryProviders[T any](ctx context.Context, f *Fallback, op, key string, get func(api.StockApiContext) (T, error)) (T, error) {
+	providers := f.getProviders(op)
+	names := make([]string, len(providers))
+	for i, provider := range providers {
+		names[i] = provider.Name
+	}
+	return try(ctx, &f.sources, op, key, names, func(i int) (T, error) {
+		return get(api.NewStockApiContext(providers[i].Api))
+	})
+}
+
+func (f *Fallback) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	return f.GetCurrencyContext(context.Background(), currency, currencyTo)
+}
+
+func (f *Fallback) GetCurrencyContext(ctx context.Context, currency, currencyTo string) (stock.Currency, error) {
+	return tryProviders(ctx, f, OperationCurrency, currency+"/"+currencyTo, func(a api.StockApiContext) (stock.Currency, error) {
+		return a.GetCurrencyContext(ctx, currency, currencyTo)
+	})
+}
+
+func (f *Fallback) GetHistory(symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	return f.GetHistoryContext(context.Background(), symbol, interval, from, to)
+}
+
+func (f *Fallback) GetHistoryContext(ctx context.Context, symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	return tryProviders(ctx, f, OperationHistory, symbol, func(a api.StockApiContext) ([]stock.Bar, error) {
+		return a.GetHistoryContext(ctx, symbol, interval, from, to)
+	})
+}
+
+func (f *Fallback) GetQuote(symbol string) (stock.Quote, error) {
+	return f.GetQuoteContext(context.Background(), symbol)
+}
+
+func (f *Fallback) GetQuoteContext(ctx context.Context, symbol string) (stock.Quote, error) {
+	return tryProviders(ctx, f, OperationQuote, symbol, func(a api.StockApiContext) (stock.Quote, error) {
+		return a.GetQuoteContext(ctx, symbol)
+	})
+}
+
+func (f *Fallback) GetSymbol(symbol string) (stock.Symbol, error) {
+	return f.GetSymbolContext(context.Background(), symbol)
+}
+
+func (f *Fallback) GetSymbolContext(ctx context.Context, symbol string) (stock.Symbol, error) {
+	return tryProviders(ctx, f, OperationSymbol, symbol, func(a api.StockApiContext) (stock.Symbol, error) {
+		return a.GetSymbolContext(ctx, symbol)
+	})
+}
+
+// GetSource returns the provider that served the value of an operation
+func (s *sources) GetSource(op, key string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	src, exists := s.sources[op+" "+key]
+	return src.Provider, exists
+}
+
+// GetSources returns the provider that served each value, sorted by
+// operation and key
+func (s *sources) GetSources() []Source {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sources := make([]Source, 0, len(s.sources))
+	for _, src := range s.sources {
+		sources = append(sources, src)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Operation != sources[j].Operation {
+			return sources[i].Operation < sources[j].Operation
+		}
+		return sources[i].Key < sources[j].Key
+	})
+	return sources
+}
+
+// NewFxFallback creates an exchange rate API that tries the providers in order
+func NewFxFallback(providers []FxProvider) *FxFallback {
+	return &FxFallback{
+		providers: providers,
+		sources:   sources{sources: map[string]Source{}},
+	}
+}
+
+func (f *FxFallback) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	return f.GetCurrencyContext(context.Background(), currency, currencyTo)
+}
+
+func (f *FxFallback) GetCurrencyContext(ctx context.Context, currency, currencyTo string) (stock.Currency, error) {
+	names := make([]string, len(f.providers))
+	for i, provider := range f.providers {
+		names[i] = provider.Name
+	}
+	return try(ctx, &f.sources, OperationCurrency, currency+"/"+currencyTo, names, func(i int) (stock.Currency, error) {
+		return api.NewFxApiContext(f.providers[i].Api).GetCurrencyContext(ctx, currency, currencyTo)
+	})
+}
+
+// RefreshCredentials refreshes the credentials of every provider that has
+// credentials, returning the credentials of the first one
+func (f *Fallback) RefreshCredentials() (*api.OAuthCredentials, error) {
+	return f.RefreshCredentialsContext(context.Background())
+}
+
+func (f *Fallback) RefreshCredentialsContext(ctx context.Context) (*api.OAuthCredentials, error) {
+	var creds *api.OAuthCredentials
+	err := error(syscall.ENOTSUP)
+	for _, provider := range f.getUniqueProviders() {
+		c, rerr := api.NewStockApiContext(provider.Api).RefreshCredentialsContext(ctx)
+		if errors.Is(rerr, syscall.ENOTSUP) {
+			continue
+		} else if rerr != nil {
+			return nil, fmt.Errorf("%s: %w", provider.Name, rerr)
+		} else if creds == nil {
+			creds, err = c, nil
+		}
+	}
+	return creds, err
+}
+
+func (f *Fallback) getAccountApi() (api.AccountApiContext, error) {
+	if accountApi, ok := api.NewAccountApiContext(f.primary.Api); ok {
+		return accountApi, nil
+	}
+	return nil, fmt.Errorf("%s does not support accounts: %w", f.primary.Name, syscall.ENOTSUP)
+}
+
+func (f *Fallback) GetAccounts() ([]stock.Account, error) {
+	return f.GetAccountsContext(context.Background())
+}
+
+func (f *Fallback) GetAccountsContext(ctx context.Context) ([]stock.Account, error) {
+	accountApi, err := f.getAccountApi()
+	if err != nil {
+		return nil, err
+	}
+	return accountApi.GetAccountsContext(ctx)
+}
+
+func (f *Fallback) GetBalances(accountId string) ([]stock.Balance, error) {
+	return f.GetBalancesContext(context.Background(), accountId)
+}
+
+func (f *Fallback) GetBalancesContext(ctx context.Context, accountId string) ([]stock.Balance, error) {
+	accountApi, err := f.getAccountApi()
+	if err != nil {
+		return nil, err
+	}
+	return accountApi.GetBalancesContext(ctx, accountId)
+}
+
+func (f *Fallback) GetPositions(accountId string) ([]stock.Position, error) {
+	return f.GetPositionsContext(context.Background(), accountId)
+}
+
+func (f *Fallback) GetPositionsContext(ctx context.Context, accountId string) ([]stock.Position, error) {
+	accountApi, err := f.getAccountApi()
+	if err != nil {
+		return nil, err
+	}
+	return accountApi.GetPositionsContext(ctx, accountId)
+}
+
+func (f *Fallback) getOrderApi() (api.OrderApiContext, error) {
+	if orderApi, ok := api.NewOrderApiContext(f.primary.Api); ok {
+		return orderApi, nil
+	}
+	return nil, fmt.Errorf("%s does not support orders: %w", f.primary.Name, syscall.ENOTSUP)
+}
+
+func (f *Fallback) GetOrderImpact(accountId string, order stock.Order) (stock.OrderImpact, error) {
+	return f.GetOrderImpactContext(context.Background(), accountId, order)
+}
+
+func (f *Fallback) GetOrderImpactContext(ctx context.Context, accountId string, order stock.Order) (stock.OrderImpact, error) {
+	orderApi, err := f.getOrderApi()
+	if err != nil {
+		return stock.OrderImpact{}, err
+	}
+	return orderApi.GetOrderImpactContext(ctx, accountId, order)
+}
+
+func (f *Fallback) PlaceOrder(accountId string, order stock.Order) (string, error) {
+	return f.PlaceOrderContext(context.Background(), accountId, order)
+}
+
+func (f *Fallback) PlaceOrderContext(ctx context.Context, accountId string, order stock.Order) (string, error) {
+	orderApi, err := f.getOrderApi()
+	if err != nil {
+		return "", err
+	}
+	return orderApi.PlaceOrderContext(ctx, accountId, order)
+}
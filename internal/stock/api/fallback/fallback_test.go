@@ -0,0 +1,200 @@
+package fallback
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// Fake provider that fails every call with an error if one is set
+type testApi struct {
+	calls int
+	creds *api.OAuthCredentials
+	err   error
+	price float64
+}
+
+func (a *testApi) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	a.calls++
+	return stock.Currency{Currency: currency, Rates: map[string]fp.Fixed{currencyTo: fp.NewF(a.price)}}, a.err
+}
+
+func (a *testApi) GetHistory(symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	a.calls++
+	return []stock.Bar{{Close: fp.NewF(a.price)}}, a.err
+}
+
+func (a *testApi) GetQuote(symbol string) (stock.Quote, error) {
+	a.calls++
+	qte := stock.Quote{Symbol: symbol}
+	qte.Prices.Latest = a.price
+	return qte, a.err
+}
+
+func (a *testApi) GetSymbol(symbol string) (stock.Symbol, error) {
+	a.calls++
+	return stock.Symbol{Symbol: symbol}, a.err
+}
+
+func (a *testApi) RefreshCredentials() (*api.OAuthCredentials, error) {
+	if a.creds == nil {
+		return nil, syscall.ENOTSUP
+	}
+	return a.creds, nil
+}
+
+// Fake provider with accounts
+type testAccountApi struct {
+	testApi
+}
+
+func (a *testAccountApi) GetAccounts() ([]stock.Account, error) {
+	return []stock.Account{{Id: "1234"}}, nil
+}
+
+func (a *testAccountApi) GetBalances(accountId string) ([]stock.Balance, error) {
+	return nil, nil
+}
+
+func (a *testAccountApi) GetPositions(accountId string) ([]stock.Position, error) {
+	return nil, nil
+}
+
+func TestFallback_GetQuote(t *testing.T) {
+	limited := &testApi{err: &api.RequestLimitError{Message: "Thank you for using Alpha Vantage!"}, price: 1}
+	backup := &testApi{price: 2}
+	f := NewApiFallback(Provider{Api: limited, Name: "alphavantage.co"}, map[string][]Provider{
+		OperationQuote: {{Api: limited, Name: "alphavantage.co"}, {Api: backup, Name: "questrade.com"}},
+	})
+
+	qte, err := f.GetQuote("AAPL")
+	assert.Nil(t, err)
+	assert.Equal(t, 2.0, qte.Prices.Latest)
+	assert.Equal(t, 1, limited.calls)
+	assert.Equal(t, 1, backup.calls)
+
+	provider, exists := f.GetSource(OperationQuote, "AAPL")
+	assert.True(t, exists)
+	assert.Equal(t, "questrade.com", provider)
+
+	// Operations without providers only use the primary provider
+	_, err = f.GetSymbol("AAPL")
+	assert.True(t, api.IsRequestLimit(err))
+	assert.Equal(t, 1, backup.calls)
+	_, exists = f.GetSource(OperationSymbol, "AAPL")
+	assert.False(t, exists)
+}
+
+func TestFallback_GetQuoteContext(t *testing.T) {
+	limited := &testApi{err: &api.RequestLimitError{Message: "Thank you for using Alpha Vantage!"}, price: 1}
+	backup := &testApi{price: 2}
+	f := NewApiFallback(Provider{Api: limited, Name: "alphavantage.co"}, map[string][]Provider{
+		OperationQuote: {{Api: limited, Name: "alphavantage.co"}, {Api: backup, Name: "questrade.com"}},
+	})
+
+	// No providers are tried once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := f.GetQuoteContext(ctx, "AAPL")
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, 0, limited.calls)
+	assert.Equal(t, 0, backup.calls)
+
+	qte, err := f.GetQuoteContext(context.Background(), "AAPL")
+	assert.Nil(t, err)
+	assert.Equal(t, 2.0, qte.Prices.Latest)
+}
+
+func TestFallback_GetCurrency(t *testing.T) {
+	first := &testApi{price: 1.35}
+	second := &testApi{price: 1.36}
+	f := NewApiFallback(Provider{Api: second, Name: "alphavantage.co"}, map[string][]Provider{
+		OperationCurrency: {{Api: first, Name: "exchangerate.host"}, {Api: second, Name: "alphavantage.co"}},
+		OperationQuote:    {},
+	})
+
+	ccy, err := f.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.35", ccy.Rates["CAD"].StringN(2))
+	assert.Equal(t, 0, second.calls)
+
+	// Every provider failed
+	first.err = syscall.ECONNRESET
+	second.err = syscall.ENOENT
+	_, err = f.GetCurrency("USD", "EUR")
+	assert.True(t, errors.Is(err, syscall.ECONNRESET))
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+	assert.Contains(t, err.Error(), "exchangerate.host")
+
+	_, err = f.GetQuote("AAPL")
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+
+	assert.Equal(t, []Source{{Key: "USD/CAD", Operation: OperationCurrency, Provider: "exchangerate.host"}}, f.GetSources())
+}
+
+func TestFallback_GetHistory(t *testing.T) {
+	first := &testApi{err: syscall.ENOTSUP}
+	second := &testApi{price: 3}
+	f := NewApiFallback(Provider{Api: first, Name: "questrade.com"}, map[string][]Provider{
+		OperationHistory: {{Api: first, Name: "questrade.com"}, {Api: second, Name: "alphavantage.co"}},
+	})
+
+	bars, err := f.GetHistory("AAPL", stock.IntervalDaily, time.Time{}, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(bars))
+	provider, _ := f.GetSource(OperationHistory, "AAPL")
+	assert.Equal(t, "alphavantage.co", provider)
+}
+
+func TestFallback_RefreshCredentials(t *testing.T) {
+	noCreds := &testApi{}
+	f := NewApiFallback(Provider{Api: noCreds, Name: "alphavantage.co"}, nil)
+	_, err := f.RefreshCredentials()
+	assert.True(t, errors.Is(err, syscall.ENOTSUP))
+
+	withCreds := &testApi{creds: &api.OAuthCredentials{AccessToken: "token"}}
+	f = NewApiFallback(Provider{Api: noCreds, Name: "alphavantage.co"}, map[string][]Provider{
+		OperationQuote: {{Api: withCreds, Name: "questrade.com"}},
+	})
+	creds, err := f.RefreshCredentials()
+	assert.Nil(t, err)
+	assert.Equal(t, "token", creds.AccessToken)
+}
+
+func TestFallback_Accounts(t *testing.T) {
+	f := NewApiFallback(Provider{Api: &testApi{}, Name: "alphavantage.co"}, nil)
+	_, err := f.GetAccounts()
+	assert.True(t, errors.Is(err, syscall.ENOTSUP))
+	_, err = f.PlaceOrder("1234", stock.Order{})
+	assert.True(t, errors.Is(err, syscall.ENOTSUP))
+
+	f = NewApiFallback(Provider{Api: &testAccountApi{}, Name: "questrade.com"}, nil)
+	accounts, err := f.GetAccounts()
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", accounts[0].Id)
+}
+
+func TestFxFallback_GetCurrency(t *testing.T) {
+	limited := &testApi{err: &api.RequestLimitError{Message: "usage limit reached"}}
+	backup := &testApi{price: 0.74}
+	f := NewFxFallback([]FxProvider{{Api: limited, Name: "exchangeratesapi.io"}, {Api: backup, Name: "fixed:CAD/USD=0.74"}})
+
+	ccy, err := f.GetCurrency("CAD", "USD")
+	assert.Nil(t, err)
+	assert.Equal(t, "0.74", ccy.Rates["USD"].StringN(2))
+	provider, exists := f.GetSource(OperationCurrency, "CAD/USD")
+	assert.True(t, exists)
+	assert.Equal(t, "fixed:CAD/USD=0.74", provider)
+
+	backup.err = syscall.ENOENT
+	_, err = f.GetCurrency("EUR", "USD")
+	assert.True(t, api.IsRequestLimit(err))
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+}
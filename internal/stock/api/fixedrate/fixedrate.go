@@ -0,0 +1,70 @@
+package fixedrate
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+)
+
+const prefix = "fixed:"
+
+// An exchange rate API that serves exchange rates from a fixed table of
+// currency pairs, e.g. fixed:CAD/USD=0.74;EUR/USD=1.08
+type table struct {
+	rates map[string]map[string]fp.Fixed // map[currency]map[currencyTo]ExchangeRate
+}
+
+func (t *table) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	ccy := stock.Currency{Currency: currency, Name: currency}
+	if currency == currencyTo {
+		ccy.Rates = map[string]fp.Fixed{currencyTo: fp.NewF(1)}
+	} else if rate, exists := t.rates[currency][currencyTo]; exists {
+		ccy.Rates = map[string]fp.Fixed{currencyTo: rate}
+	} else if rate, exists := t.rates[currencyTo][currency]; exists {
+		// Fall back to the inverse exchange rate
+		ccy.Rates = map[string]fp.Fixed{currencyTo: fp.NewF(1).Div(rate)}
+	} else {
+		return ccy, fmt.Errorf("fixedrate: no exchange rate from %s to %s: %w", currency, currencyTo, syscall.ENOENT)
+	}
+	return ccy, nil
+}
+
+func IsApiFixedRate(apiServer string) bool {
+	return strings.HasPrefix(apiServer, prefix)
+}
+
+// NewFxFixedRate creates an exchange rate API from a semicolon-separated table
+// of currency pairs and exchange rates, e.g. fixed:CAD/USD=0.74;EUR/USD=1.08.
+// Semicolons are used so that the table can be in a comma-separated list of
+// servers.
+func NewFxFixedRate(apiServer string) (api.FxApi, error) {
+	t := table{rates: make(map[string]map[string]fp.Fixed)}
+	for _, entry := range strings.Split(strings.TrimPrefix(apiServer, prefix), ";") {
+		if entry = strings.TrimSpace(entry); len(entry) == 0 {
+			continue
+		}
+
+		pair, value, found := strings.Cut(entry, "=")
+		currency, currencyTo, isPair := strings.Cut(pair, "/")
+		if !found || !isPair || len(currency) == 0 || len(currencyTo) == 0 {
+			return nil, fmt.Errorf("fixedrate: invalid exchange rate %s, expected <currency>/<currency>=<rate>: %w", entry, syscall.EINVAL)
+		}
+
+		rate, err := fp.NewSErr(strings.TrimSpace(value))
+		if err != nil || !rate.GreaterThan(fp.NewF(0)) {
+			return nil, fmt.Errorf("fixedrate: invalid exchange rate from %s to %s: %s: %w", currency, currencyTo, value, syscall.EINVAL)
+		}
+
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		currencyTo = strings.ToUpper(strings.TrimSpace(currencyTo))
+		if _, exists := t.rates[currency]; !exists {
+			t.rates[currency] = make(map[string]fp.Fixed)
+		}
+		t.rates[currency][currencyTo] = rate
+	}
+	return &t, nil
+}
@@ -0,0 +1,42 @@
+package fixedrate
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsApiFixedRate(t *testing.T) {
+	assert.True(t, IsApiFixedRate("fixed:CAD/USD=0.74"))
+	assert.False(t, IsApiFixedRate("exchangerate.host"))
+}
+
+func TestNewFxFixedRate(t *testing.T) {
+	fx, err := NewFxFixedRate("fixed:cad/usd=0.74; EUR/USD=1.08")
+	assert.Nil(t, err)
+
+	ccy, err := fx.GetCurrency("CAD", "USD")
+	assert.Nil(t, err)
+	assert.Equal(t, "0.7400", ccy.Rates["USD"].StringN(4))
+
+	// Inverse exchange rate
+	ccy, err = fx.GetCurrency("USD", "EUR")
+	assert.Nil(t, err)
+	assert.Equal(t, "0.9259", ccy.Rates["EUR"].StringN(4))
+
+	ccy, err = fx.GetCurrency("GBP", "GBP")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.0000", ccy.Rates["GBP"].StringN(4))
+
+	_, err = fx.GetCurrency("CAD", "EUR")
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+}
+
+func TestNewFxFixedRate_Invalid(t *testing.T) {
+	for _, server := range []string{"fixed:CAD=0.74", "fixed:CAD/USD=0.74,EUR/USD=1.08", "fixed:CAD/USD", "fixed:CAD/USD=abc", "fixed:CAD/USD=0", "fixed:/USD=1"} {
+		_, err := NewFxFixedRate(server)
+		assert.True(t, errors.Is(err, syscall.EINVAL), server)
+	}
+}
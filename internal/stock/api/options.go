@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Options are the HTTP settings of a provider
+type Options struct {
+	BaseUrl string       // Replaces the scheme, host and port of every request URL, e.g. to use a local server
+	Client  *http.Client // Makes the requests of the provider, or the shared Client if not set
+}
+
+// Option changes the HTTP settings of a provider
+type Option func(*Options)
+
+// WithBaseUrl sends the requests of a provider to another server. The path of
+// the base URL, if any, is prepended to the path of each request.
+func WithBaseUrl(baseUrl string) Option {
+	return func(o *Options) {
+		o.BaseUrl = baseUrl
+	}
+}
+
+// WithHttpClient makes the requests of a provider with an HTTP client, e.g.
+// one that uses a proxy or custom root certificates
+func WithHttpClient(client *http.Client) Option {
+	return func(o *Options) {
+		o.Client = client
+	}
+}
+
+// WithTransport makes the requests of a provider with a round tripper and the
+// default client timeout
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *Options) {
+		o.Client = &http.Client{Timeout: DefaultClientTimeout, Transport: transport}
+	}
+}
+
+// NewOptions applies options to the default HTTP settings
+func NewOptions(opts ...Option) Options {
+	o := Options{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+func (o Options) getClient() *http.Client {
+	if o.Client != nil {
+		return o.Client
+	}
+	return Client
+}
+
+// Returns the URL of a request sent to the base URL, if any
+func (o Options) getUrl(rawUrl string) (string, error) {
+	if len(o.BaseUrl) == 0 {
+		return rawUrl, nil
+	}
+
+	base, err := url.Parse(o.BaseUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %s: %w", o.BaseUrl, err)
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = base.Scheme
+	u.Host = base.Host
+	u.Path = strings.TrimSuffix(base.Path, "/") + u.Path
+	if len(u.RawPath) > 0 {
+		u.RawPath = strings.TrimSuffix(base.EscapedPath(), "/") + u.RawPath
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewOptions(t *testing.T) {
+	o := NewOptions()
+	assert.Empty(t, o.BaseUrl)
+	assert.Equal(t, Client, o.getClient())
+
+	client := &http.Client{}
+	o = NewOptions(nil, WithBaseUrl("http://127.0.0.1:8080"), WithHttpClient(client))
+	assert.Equal(t, "http://127.0.0.1:8080", o.BaseUrl)
+	assert.Equal(t, client, o.getClient())
+
+	o = NewOptions(WithTransport(http.DefaultTransport))
+	assert.Equal(t, DefaultClientTimeout, o.getClient().Timeout)
+	assert.Equal(t, http.DefaultTransport, o.getClient().Transport)
+}
+
+func TestOptions_GetUrl(t *testing.T) {
+	url, err := NewOptions().getUrl("https://www.alphavantage.co/query?symbol=VTI")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.alphavantage.co/query?symbol=VTI", url)
+
+	url, err = NewOptions(WithBaseUrl("http://127.0.0.1:8080")).getUrl("https://www.alphavantage.co/query?symbol=VTI")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://127.0.0.1:8080/query?symbol=VTI", url)
+
+	url, err = NewOptions(WithBaseUrl("http://proxy.example.com/av/")).getUrl("https://www.alphavantage.co/query?symbol=VTI")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://proxy.example.com/av/query?symbol=VTI", url)
+
+	_, err = NewOptions(WithBaseUrl("http://[::1")).getUrl("https://www.alphavantage.co/query")
+	assert.NotNil(t, err)
+}
+
+func TestGetApiResponseBodyContext_Options(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/latest", req.URL.Path)
+		assert.Equal(t, "base=USD", req.URL.RawQuery)
+		w.Write([]byte(`{"base":"USD"}`))
+	}))
+	defer server.Close()
+
+	body, err := GetApiResponseBodyContext(context.Background(), "https://api.exchangerate.host/latest?base=USD", "", nil, WithBaseUrl(server.URL), WithHttpClient(server.Client()))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"base":"USD"}`, string(body))
+
+	var urls []string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		urls = append(urls, req.URL.String())
+		return &http.Response{
+			Body:       io.NopCloser(bytes.NewBufferString("{}")),
+			Header:     make(http.Header),
+			StatusCode: http.StatusOK,
+		}
+	})}
+	body, err = GetApiResponseBodyContext(context.Background(), "https://api.exchangerate.host/latest", "", nil, WithTransport(client.Transport))
+	assert.Nil(t, err)
+	assert.Equal(t, "{}", string(body))
+	assert.Equal(t, []string{"https://api.exchangerate.host/latest"}, urls)
+}
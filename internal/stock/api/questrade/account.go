@@ -0,0 +1,135 @@
+package questrade
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"text/template"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+)
+
+const (
+	apiAccounts         = `https://{{.ApiServer}}/v1/accounts`
+	apiAccountBalances  = `https://{{.ApiServer}}/v1/accounts/{{.AccountId}}/balances`
+	apiAccountPositions = `https://{{.ApiServer}}/v1/accounts/{{.AccountId}}/positions`
+)
+
+type tplAccount struct {
+	AccountId string
+	ApiKey    string
+	ApiServer string
+}
+
+type Account struct {
+	Type              string `json:"type"`
+	Number            string `json:"number"`
+	Status            string `json:"status"`
+	IsPrimary         bool   `json:"isPrimary"`
+	IsBilling         bool   `json:"isBilling"`
+	ClientAccountType string `json:"clientAccountType"`
+}
+
+type accounts struct {
+	Accounts []Account `json:"accounts"`
+}
+
+type AccountBalance struct {
+	Currency          string  `json:"currency"`
+	Cash              float64 `json:"cash"`
+	MarketValue       float64 `json:"marketValue"`
+	TotalEquity       float64 `json:"totalEquity"`
+	BuyingPower       float64 `json:"buyingPower"`
+	MaintenanceExcess float64 `json:"maintenanceExcess"`
+	IsRealTime        bool    `json:"isRealTime"`
+}
+
+type accountBalances struct {
+	PerCurrencyBalances []AccountBalance `json:"perCurrencyBalances"`
+	CombinedBalances    []AccountBalance `json:"combinedBalances"`
+}
+
+type AccountPosition struct {
+	Symbol             string  `json:"symbol"`
+	SymbolId           int     `json:"symbolId"`
+	OpenQuantity       float64 `json:"openQuantity"`
+	ClosedQuantity     float64 `json:"closedQuantity"`
+	CurrentMarketValue float64 `json:"currentMarketValue"`
+	CurrentPrice       float64 `json:"currentPrice"`
+	AverageEntryPrice  float64 `json:"averageEntryPrice"`
+	ClosedPnl          float64 `json:"closedPnl"`
+	OpenPnl            float64 `json:"openPnl"`
+	TotalCost          float64 `json:"totalCost"`
+	IsRealTime         bool    `json:"isRealTime"`
+	IsUnderReorg       bool    `json:"isUnderReorg"`
+}
+
+type accountPositions struct {
+	Positions []AccountPosition `json:"positions"`
+}
+
+func createAccountUrl(apiTemplate, accountId, apiKey, apiServer string) (string, error) {
+	var url bytes.Buffer
+	var err error
+
+	var tpl *template.Template
+	t := tplAccount{AccountId: accountId, ApiKey: apiKey, ApiServer: apiServer}
+
+	if tpl, err = template.New("api").Parse(apiTemplate); err == nil {
+		err = tpl.Execute(&url, t)
+	}
+
+	return url.String(), err
+}
+
+func getAccountResponse(ctx context.Context, apiTemplate, accountId, apiKey, apiServer string, v interface{}, opts ...api.Option) error {
+	url, err := createAccountUrl(apiTemplate, accountId, apiKey, apiServer)
+	if err == nil {
+		var body []byte
+		if body, err = getApiResponseBody(ctx, url, apiKey, opts...); err == nil {
+			err = json.Unmarshal(body, v)
+		}
+	}
+	return err
+}
+
+// References:
+//   https://www.questrade.com/api/documentation/rest-operations/account-calls/accounts
+func GetAccounts(apiKey, apiServer string) ([]Account, error) {
+	return GetAccountsContext(context.Background(), apiKey, apiServer)
+}
+
+// GetAccountsContext gets the accounts of a user until the context is done
+func GetAccountsContext(ctx context.Context, apiKey, apiServer string, opts ...api.Option) ([]Account, error) {
+	res := accounts{}
+	err := getAccountResponse(ctx, apiAccounts, "", apiKey, apiServer, &res, opts...)
+	return res.Accounts, err
+}
+
+// References:
+//   https://www.questrade.com/api/documentation/rest-operations/account-calls/accounts-id-balances
+func GetAccountBalances(accountId, apiKey, apiServer string) ([]AccountBalance, error) {
+	return GetAccountBalancesContext(context.Background(), accountId, apiKey, apiServer)
+}
+
+// GetAccountBalancesContext gets the balances of an account until the
+// context is done
+func GetAccountBalancesContext(ctx context.Context, accountId, apiKey, apiServer string, opts ...api.Option) ([]AccountBalance, error) {
+	res := accountBalances{}
+	err := getAccountResponse(ctx, apiAccountBalances, accountId, apiKey, apiServer, &res, opts...)
+	return res.PerCurrencyBalances, err
+}
+
+// References:
+//   https://www.questrade.com/api/documentation/rest-operations/account-calls/accounts-id-positions
+func GetAccountPositions(accountId, apiKey, apiServer string) ([]AccountPosition, error) {
+	return GetAccountPositionsContext(context.Background(), accountId, apiKey, apiServer)
+}
+
+// GetAccountPositionsContext gets the positions of an account until the
+// context is done
+func GetAccountPositionsContext(ctx context.Context, accountId, apiKey, apiServer string, opts ...api.Option) ([]AccountPosition, error) {
+	res := accountPositions{}
+	err := getAccountResponse(ctx, apiAccountPositions, accountId, apiKey, apiServer, &res, opts...)
+	return res.Positions, err
+}
@@ -0,0 +1,79 @@
+package questrade
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/stretchr/testify/assert"
+)
+
+var testAccountResponses = map[string]string{
+	"https://api01.iq.questrade.com/v1/accounts": `{
+		"accounts": [
+			{"type": "Margin", "number": "26598145", "status": "Active", "isPrimary": true, "isBilling": true, "clientAccountType": "Individual"}
+		],
+		"userId": 3000124
+	}`,
+	"https://api01.iq.questrade.com/v1/accounts/26598145/balances": `{
+		"perCurrencyBalances": [
+			{"currency": "CAD", "cash": 243971.7, "marketValue": 6017, "totalEquity": 249988.7},
+			{"currency": "USD", "cash": 198.25, "marketValue": 0, "totalEquity": 198.25}
+		],
+		"combinedBalances": [
+			{"currency": "CAD", "cash": 244239.86, "marketValue": 6017, "totalEquity": 250256.86}
+		]
+	}`,
+	"https://api01.iq.questrade.com/v1/accounts/26598145/positions": `{
+		"positions": [
+			{"symbol": "THI.TO", "symbolId": 38738, "openQuantity": 100, "currentMarketValue": 6017, "currentPrice": 60.17}
+		]
+	}`,
+}
+
+func newTestAccountApi(t *testing.T) api.AccountApi {
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		assert.Equal(t, "Bearer AccessToken01", req.Header.Get("Authorization"))
+
+		body, exists := testAccountResponses[req.URL.String()]
+		assert.True(t, exists, req.URL.String())
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			Header:     make(http.Header),
+			Status:     http.StatusText(http.StatusOK),
+			StatusCode: http.StatusOK,
+		}
+	})
+
+	return NewApiQuestrade("AccessToken01", "api01.iq.questrade.com", api.OAuthCredentials{}, nil, nil, api.WithHttpClient(client)).(api.AccountApi)
+}
+
+func TestGetAccounts(t *testing.T) {
+	accts, err := newTestAccountApi(t).GetAccounts()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(accts))
+	assert.Equal(t, "26598145", accts[0].Id)
+	assert.True(t, accts[0].Primary)
+	assert.Equal(t, "Active", accts[0].Status)
+	assert.Equal(t, "Margin", accts[0].Type)
+}
+
+func TestGetBalances(t *testing.T) {
+	balances, err := newTestAccountApi(t).GetBalances("26598145")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(balances))
+	assert.Equal(t, "CAD", balances[0].Currency)
+	assert.Equal(t, "243971.70", balances[0].Cash.StringN(2))
+	assert.Equal(t, "USD", balances[1].Currency)
+	assert.Equal(t, "198.25", balances[1].Cash.StringN(2))
+}
+
+func TestGetPositions(t *testing.T) {
+	positions, err := newTestAccountApi(t).GetPositions("26598145")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(positions))
+	assert.Equal(t, "THI.TO", positions[0].Symbol)
+	assert.Equal(t, "100.00", positions[0].Qty.StringN(2))
+}
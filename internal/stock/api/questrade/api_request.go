@@ -1,11 +1,42 @@
 package questrade
 
 import (
+	"context"
 	"net/http"
 	"strconv"
+	"time"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+)
+
+const ApiRateLimitRemaining = api.RateLimitRemainingHeader
+
+// Market data requests are limited to 20 requests per second, see
+// https://www.questrade.com/api/documentation/rate-limiting
+const ApiRequestsBurstLimit = 20
+
+var (
+	ApiRequestsPerMinLimit = ApiRequestsBurstLimit * 60
+	ApiRetryPolicy         = api.DefaultRetryPolicy()
+	apiLimiter             = api.NewRateLimiter(apiGetRequestInterval(), ApiRequestsBurstLimit)
 )
 
-const ApiRateLimitRemaining = "X-RateLimit-Remaining"
+func apiGetRequestInterval() time.Duration {
+	dur := time.Duration(0)
+	if ApiRequestsPerMinLimit > 0 {
+		dur = time.Minute / time.Duration(ApiRequestsPerMinLimit)
+	}
+	return dur
+}
+
+func getApiResponseBody(ctx context.Context, url, accessToken string, opts ...api.Option) ([]byte, error) {
+	// Pick up any change to the request limit before waiting for a token
+	apiLimiter.SetRate(apiGetRequestInterval(), ApiRequestsBurstLimit)
+	if err := apiLimiter.WaitContext(ctx); err != nil {
+		return nil, err
+	}
+	return api.GetApiResponseBodyWithRetryContext(ctx, url, accessToken, ApiRetryPolicy, isApiResponseRetryable, opts...)
+}
 
 func isApiResponseRetryable(res *http.Response) bool {
 	return (isResponseApiLimit(res) || isResponseRetryable(res))
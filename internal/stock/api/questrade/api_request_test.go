@@ -99,7 +99,8 @@ func TestApiGetResponseBody_RetryableError(t *testing.T) {
 			StatusCode: http.StatusInternalServerError,
 		}
 	})
-	_, err := api.GetApiResponseBody("https://api01.iq.questrade.com/v1/symbols/search?prefix=ACME", "AccessToken01", nil)
+	policy := api.RetryPolicy{Limit: api.DefaultRequestRetryLimit}
+	_, err := api.GetApiResponseBodyWithRetry("https://api01.iq.questrade.com/v1/symbols/search?prefix=ACME", "AccessToken01", policy, isApiResponseRetryable)
 	assert.NotNil(t, err)
 	assert.Equal(t, "API response status code: 500, details: Something strange happened", err.Error())
 	assert.Equal(t, api.DefaultRequestRetryLimit, requestCount)
@@ -0,0 +1,114 @@
+package questrade
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"text/template"
+	"time"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+)
+
+const (
+	apiCandles = `https://{{.ApiServer}}/v1/markets/candles/{{.SymbolId}}?startTime={{.StartTime}}&endTime={{.EndTime}}&interval={{.Interval}}`
+)
+
+var candleIntervals = map[string]string{
+	stock.IntervalDaily:   "OneDay",
+	stock.IntervalMonthly: "OneMonth",
+	stock.IntervalWeekly:  "OneWeek",
+}
+
+type tplCandles struct {
+	ApiKey    string
+	ApiServer string
+	EndTime   string
+	Interval  string
+	StartTime string
+	SymbolId  string
+}
+
+type Candle struct {
+	Start  string  `json:"start"`
+	End    string  `json:"end"`
+	Low    float64 `json:"low"`
+	High   float64 `json:"high"`
+	Open   float64 `json:"open"`
+	Close  float64 `json:"close"`
+	Volume int64   `json:"volume"`
+	VWAP   float64 `json:"VWAP"`
+}
+
+type candles struct {
+	Candles []Candle `json:"candles"`
+}
+
+func createCandlesUrl(symbolId, interval string, from, to time.Time, apiKey, apiServer string) (string, error) {
+	var buf bytes.Buffer
+	var err error
+
+	candleInterval, exists := candleIntervals[interval]
+	if !exists {
+		return "", fmt.Errorf("invalid candle interval: %s", interval)
+	}
+
+	var tpl *template.Template
+	t := tplCandles{
+		ApiKey:    apiKey,
+		ApiServer: apiServer,
+		EndTime:   url.QueryEscape(to.Format(time.RFC3339)),
+		Interval:  candleInterval,
+		StartTime: url.QueryEscape(from.Format(time.RFC3339)),
+		SymbolId:  symbolId,
+	}
+
+	if tpl, err = template.New("api").Parse(apiCandles); err == nil {
+		err = tpl.Execute(&buf, t)
+	}
+
+	return buf.String(), err
+}
+
+// Candles end at the start of the next interval, so the close price is from
+// the day before the candle ends
+func newCandleBar(candle Candle) (stock.Bar, error) {
+	end, err := time.Parse(time.RFC3339Nano, candle.End)
+	if err != nil {
+		return stock.Bar{}, fmt.Errorf("invalid candle end time: %s", candle.End)
+	}
+
+	y, m, d := end.Add(-time.Nanosecond).Date()
+	return stock.Bar{
+		AdjClose: fp.NewF(candle.Close),
+		Close:    fp.NewF(candle.Close),
+		High:     fp.NewF(candle.High),
+		Low:      fp.NewF(candle.Low),
+		Open:     fp.NewF(candle.Open),
+		Time:     time.Date(y, m, d, 0, 0, 0, 0, time.UTC),
+		Volume:   candle.Volume,
+	}, nil
+}
+
+// References:
+//   https://www.questrade.com/api/documentation/rest-operations/market-calls/markets-candles-id
+func GetCandles(symbolId, interval string, from, to time.Time, apiKey, apiServer string) ([]Candle, error) {
+	return GetCandlesContext(context.Background(), symbolId, interval, from, to, apiKey, apiServer)
+}
+
+// GetCandlesContext gets the candles of a symbol until the context is done
+func GetCandlesContext(ctx context.Context, symbolId, interval string, from, to time.Time, apiKey, apiServer string, opts ...api.Option) ([]Candle, error) {
+	res := candles{}
+	url, err := createCandlesUrl(symbolId, interval, from, to, apiKey, apiServer)
+	if err == nil {
+		var body []byte
+		if body, err = getApiResponseBody(ctx, url, apiKey, opts...); err == nil {
+			err = json.Unmarshal(body, &res)
+		}
+	}
+	return res.Candles, err
+}
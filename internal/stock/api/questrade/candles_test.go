@@ -0,0 +1,59 @@
+package questrade
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCandlesResponse = `{
+	"candles": [
+		{"start": "2014-01-02T00:00:00.000000-05:00", "end": "2014-01-03T00:00:00.000000-05:00", "low": 70.3, "high": 70.78, "open": 70.68, "close": 70.73, "volume": 983609, "VWAP": 70.597284},
+		{"start": "2014-01-03T00:00:00.000000-05:00", "end": "2014-01-04T00:00:00.000000-05:00", "low": 69.9, "high": 70.85, "open": 70.71, "close": 70.15, "volume": 1187654, "VWAP": 70.291534}
+	]
+}`
+
+func TestCreateCandlesUrl(t *testing.T) {
+	est := time.FixedZone("EST", -5*60*60)
+	from := time.Date(2014, time.January, 2, 0, 0, 0, 0, est)
+	to := time.Date(2014, time.January, 3, 23, 59, 59, 0, est)
+
+	url, err := createCandlesUrl("1234", stock.IntervalDaily, from, to, "", "api01.iq.questrade.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://api01.iq.questrade.com/v1/markets/candles/1234?startTime=2014-01-02T00%3A00%3A00-05%3A00&endTime=2014-01-03T23%3A59%3A59-05%3A00&interval=OneDay", url)
+
+	_, err = createCandlesUrl("1234", "OneMinute", from, to, "", "api01.iq.questrade.com")
+	assert.NotNil(t, err)
+}
+
+func TestGetHistory(t *testing.T) {
+	saveClient := api.Client
+	t.Cleanup(func() {
+		api.Client = saveClient
+	})
+	api.Client = NewTestClient(func(req *http.Request) *http.Response {
+		if req.URL.Path == "/v1/symbols/search" {
+			return newTestResponse(http.StatusOK, testSymbolSearchResponse)
+		}
+		assert.Equal(t, "/v1/markets/candles/1234", req.URL.Path)
+		assert.Equal(t, "OneDay", req.URL.Query().Get("interval"))
+		return newTestResponse(http.StatusOK, testCandlesResponse)
+	})
+
+	qt := NewApiQuestrade("AccessToken01", "api01.iq.questrade.com", api.OAuthCredentials{}, nil, nil)
+	bars, err := qt.GetHistory("ACME", stock.IntervalDaily, time.Date(2014, time.January, 2, 0, 0, 0, 0, time.UTC), time.Date(2014, time.January, 3, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(bars))
+
+	// Bars are dated by the day of their close price
+	assert.Equal(t, time.Date(2014, time.January, 2, 0, 0, 0, 0, time.UTC), bars[0].Time)
+	assert.Equal(t, "70.73", bars[0].Close.StringN(2))
+	assert.Equal(t, "70.73", bars[0].AdjClose.StringN(2))
+	assert.Equal(t, "70.68", bars[0].Open.StringN(2))
+	assert.Equal(t, int64(983609), bars[0].Volume)
+	assert.Equal(t, time.Date(2014, time.January, 3, 0, 0, 0, 0, time.UTC), bars[1].Time)
+}
@@ -0,0 +1,136 @@
+package questrade
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/shanebarnes/stocker/internal/stock/api/apitest"
+	"github.com/stretchr/testify/assert"
+)
+
+const testContractSymbolId = 40128
+
+// Serves the contract market data in the Questrade format, along with the
+// exchange rates of exchangerate.host
+func serveContract(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if req.URL.Path != "/oauth2/token" && req.URL.Path != "/latest" && len(req.Header.Get("Authorization")) == 0 {
+		http.Error(w, `{"code": 1017, "message": "Access token is invalid"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var res interface{}
+	switch req.URL.Path {
+	case "/latest":
+		rates := map[string]json.Number{}
+		if query.Get("base") == apitest.Currency && query.Get("symbols") == apitest.CurrencyTo {
+			rates[apitest.CurrencyTo] = json.Number(apitest.Rate)
+		}
+		res = map[string]interface{}{"success": true, "base": query.Get("base"), "date": "2023-06-02", "rates": rates}
+	case "/oauth2/token":
+		res = map[string]interface{}{
+			"access_token":  "AccessToken02",
+			"api_server":    "https://api02.iq.questrade.com/",
+			"expires_in":    1800,
+			"refresh_token": "RefreshToken02",
+			"token_type":    "Bearer",
+		}
+	case "/v1/markets/candles/" + strconv.Itoa(testContractSymbolId):
+		candles := []map[string]interface{}{}
+		for _, bar := range apitest.Bars {
+			candles = append(candles, map[string]interface{}{
+				"start":  bar.Time.Format("2006-01-02") + "T00:00:00.000000-04:00",
+				"end":    bar.Time.AddDate(0, 0, 1).Format("2006-01-02") + "T00:00:00.000000-04:00",
+				"low":    json.Number(bar.Low.String()),
+				"high":   json.Number(bar.High.String()),
+				"open":   json.Number(bar.Open.String()),
+				"close":  json.Number(bar.Close.String()),
+				"volume": bar.Volume,
+			})
+		}
+		res = map[string]interface{}{"candles": candles}
+	case "/v1/markets/quotes":
+		quotes := []map[string]interface{}{}
+		if query.Get("ids") == strconv.Itoa(testContractSymbolId) {
+			volume, _ := strconv.Atoi(apitest.Quote.Volume)
+			quotes = append(quotes, map[string]interface{}{
+				"symbol":              apitest.Quote.Symbol,
+				"symbolId":            testContractSymbolId,
+				"bidPrice":            apitest.Quote.Prices.Bid,
+				"askPrice":            apitest.Quote.Prices.Ask,
+				"lastTradePriceTrHrs": apitest.Quote.Prices.LatestTrHrs,
+				"lastTradePrice":      apitest.Quote.Prices.Latest,
+				"volume":              volume,
+				"openPrice":           apitest.Quote.Prices.Open,
+				"highPrice":           apitest.Quote.Prices.High,
+				"lowPrice":            apitest.Quote.Prices.Low,
+			})
+		}
+		res = map[string]interface{}{"quotes": quotes}
+	case "/v1/symbols/search":
+		symbols := []map[string]interface{}{}
+		switch query.Get("prefix") {
+		case apitest.LimitedSymbol:
+			http.Error(w, `{"code": 1006, "message": "Rate limit exceeded"}`, http.StatusTooManyRequests)
+			return
+		case apitest.Symbol:
+			symbols = append(symbols, map[string]interface{}{
+				"symbol":       apitest.SymbolInfo.Symbol,
+				"symbolId":     testContractSymbolId,
+				"description":  apitest.SymbolInfo.Description,
+				"securityType": "Stock",
+				"currency":     apitest.SymbolInfo.Currency,
+			})
+		}
+		res = map[string]interface{}{"symbols": symbols}
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// Sends exchange rate requests, which are not sent to the base URL of the
+// Questrade server, to the fake server as well
+type fxRedirectTransport struct {
+	baseUrl   *url.URL
+	transport http.RoundTripper
+}
+
+func (f *fxRedirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == "api.exchangerate.host" {
+		req = req.Clone(req.Context())
+		req.Host = ""
+		req.URL.Host = f.baseUrl.Host
+		req.URL.Scheme = f.baseUrl.Scheme
+	}
+	return f.transport.RoundTrip(req)
+}
+
+func TestContract(t *testing.T) {
+	savePolicy := ApiRetryPolicy
+	t.Cleanup(func() {
+		ApiRetryPolicy = savePolicy
+	})
+	ApiRetryPolicy = api.RetryPolicy{Limit: 2}
+
+	apitest.Run(t, apitest.Contract{
+		Credentials: true,
+		Handler:     http.HandlerFunc(serveContract),
+		NewApi: func(opts ...api.Option) api.StockApi {
+			o := api.NewOptions(opts...)
+			baseUrl, err := url.Parse(o.BaseUrl)
+			assert.Nil(t, err)
+			client := &http.Client{Transport: &fxRedirectTransport{baseUrl: baseUrl, transport: o.Client.Transport}}
+			return NewApiQuestrade("AccessToken01", "api01.iq.questrade.com", api.OAuthCredentials{RefreshToken: "RefreshToken01"}, nil, nil, api.WithBaseUrl(o.BaseUrl), api.WithHttpClient(client))
+		},
+		RequestLimit: true,
+		Unsupported:  []string{apitest.PriceClose},
+	})
+}
@@ -0,0 +1,90 @@
+package questrade
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ApiPracticeTokenUrl = "https://practicelogin.questrade.com/oauth2/token"
+	ApiTokenUrl         = "https://login.questrade.com/oauth2/token"
+
+	// Access tokens are refreshed this long before they expire
+	credentialsRefreshMargin = time.Minute
+)
+
+// Token endpoint used to refresh credentials. Practice account credentials
+// must be refreshed with the practice token endpoint.
+var apiTokenUrl = ApiTokenUrl
+
+// UsePracticeAccounts refreshes credentials using the practice token endpoint
+// so that orders are placed in practice accounts
+func UsePracticeAccounts(practice bool) {
+	if practice {
+		apiTokenUrl = ApiPracticeTokenUrl
+	} else {
+		apiTokenUrl = ApiTokenUrl
+	}
+}
+
+// The token endpoint rejects refresh tokens that have expired or have already
+// been used with a 400 or 401 status code
+func isRefreshTokenRejected(err error) bool {
+	var rerr *api.ApiResponseError
+	return errors.As(err, &rerr) && (rerr.StatusCode == http.StatusBadRequest || rerr.StatusCode == http.StatusUnauthorized)
+}
+
+// Returns the access token and API server to make a request with, refreshing
+// the credentials first if the access token is about to expire
+func (q *qt) getCredentials(ctx context.Context) (string, string, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	var err error
+	if expiresAt, known := q.creds.ExpiresAt(); known && len(q.creds.RefreshToken) > 0 {
+		if time.Now().Add(credentialsRefreshMargin).After(expiresAt) {
+			log.Debug("Refreshing Questrade access token that expires at ", expiresAt)
+			_, err = q.refreshCredentials(ctx)
+		}
+	}
+	return q.apiKey, q.apiServer, err
+}
+
+// Refresh credentials after an access token is rejected, unless another
+// request has already refreshed them. Returns false if the credentials cannot
+// be refreshed, along with the original error.
+func (q *qt) refreshRejectedCredentials(ctx context.Context, rejected string, rerr error) (string, string, bool, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if len(q.creds.RefreshToken) == 0 {
+		return q.apiKey, q.apiServer, false, rerr
+	}
+
+	var err error
+	if q.apiKey == rejected {
+		log.Debug("Refreshing rejected Questrade access token")
+		_, err = q.refreshCredentials(ctx)
+	}
+	return q.apiKey, q.apiServer, err == nil, err
+}
+
+// Make a request with the current credentials, refreshing the credentials and
+// retrying the request once if the access token is rejected
+func (q *qt) withCredentials(ctx context.Context, request func(apiKey, apiServer string) error) error {
+	apiKey, apiServer, err := q.getCredentials(ctx)
+	if err == nil {
+		if err = request(apiKey, apiServer); api.IsUnauthorized(err) {
+			var refreshed bool
+			if apiKey, apiServer, refreshed, err = q.refreshRejectedCredentials(ctx, apiKey, err); refreshed {
+				err = request(apiKey, apiServer)
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,248 @@
+package questrade
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSymbolSearchResponse = `{"symbols": [{"symbol": "ACME", "symbolId": 1234, "currency": "USD"}]}`
+
+func newTestResponse(statusCode int, body string) *http.Response {
+	return &http.Response{
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+		Header:     make(http.Header),
+		Status:     http.StatusText(statusCode),
+		StatusCode: statusCode,
+	}
+}
+
+// Test server that accepts a single access token, and rotates the access and
+// refresh tokens on each refresh
+type testOAuthServer struct {
+	accessToken  string
+	refreshCount int
+	refreshToken string
+	requests     []string
+}
+
+func (s *testOAuthServer) roundTrip(req *http.Request) *http.Response {
+	s.requests = append(s.requests, req.URL.Path)
+	if strings.HasPrefix(req.URL.String(), apiTokenUrl) {
+		if req.URL.Query().Get("refresh_token") != s.refreshToken {
+			return newTestResponse(http.StatusBadRequest, `{"error": "Bad Request"}`)
+		}
+		s.refreshCount++
+		s.accessToken = "AccessToken0" + string(rune('1'+s.refreshCount))
+		s.refreshToken = "RefreshToken0" + string(rune('1'+s.refreshCount))
+		return newTestResponse(http.StatusOK, `{"access_token": "`+s.accessToken+`", "api_server": "https://api02.iq.questrade.com/", "expires_in": 1800, "refresh_token": "`+s.refreshToken+`", "token_type": "Bearer"}`)
+	}
+
+	if req.Header.Get("Authorization") != "Bearer "+s.accessToken {
+		return newTestResponse(http.StatusUnauthorized, `{"code": 1017, "message": "Access token is invalid"}`)
+	}
+	return newTestResponse(http.StatusOK, testSymbolSearchResponse)
+}
+
+// In-memory credentials store that counts how often it is locked and saved
+type testCredentialsStore struct {
+	creds     api.OAuthCredentials
+	lockCount int
+	locked    bool
+	saveCount int
+}
+
+func (s *testCredentialsStore) Load() (api.OAuthCredentials, error) {
+	return s.creds, nil
+}
+
+func (s *testCredentialsStore) Lock() error {
+	if s.locked {
+		return errors.New("already locked")
+	}
+	s.lockCount++
+	s.locked = true
+	return nil
+}
+
+func (s *testCredentialsStore) Save(creds *api.OAuthCredentials) error {
+	if !s.locked {
+		return errors.New("not locked")
+	}
+	s.saveCount++
+	s.creds = *creds
+	return nil
+}
+
+func (s *testCredentialsStore) Unlock() error {
+	if !s.locked {
+		return errors.New("not locked")
+	}
+	s.locked = false
+	return nil
+}
+
+func newTestOAuthApi(t *testing.T, server *testOAuthServer, creds api.OAuthCredentials, store api.CredentialsStore) api.StockApi {
+	saveClient := api.Client
+	t.Cleanup(func() {
+		api.Client = saveClient
+	})
+	api.Client = NewTestClient(server.roundTrip)
+	return NewApiQuestrade("", "", creds, nil, store)
+}
+
+func TestOAuthCredentials_ExpiresAt(t *testing.T) {
+	creds := api.OAuthCredentials{ExpiresIn: 1800}
+	_, known := creds.ExpiresAt()
+	assert.False(t, known)
+
+	creds.IssuedAt = time.Unix(1700000000, 0)
+	expiresAt, known := creds.ExpiresAt()
+	assert.True(t, known)
+	assert.Equal(t, time.Unix(1700001800, 0), expiresAt)
+}
+
+func TestRefreshCredentials_BeforeExpiry(t *testing.T) {
+	server := &testOAuthServer{accessToken: "AccessToken01", refreshToken: "RefreshToken01"}
+	creds := api.OAuthCredentials{
+		AccessToken:  "AccessToken01",
+		ApiServer:    "https://api01.iq.questrade.com/",
+		ExpiresIn:    1800,
+		IssuedAt:     time.Now().Add(-1790 * time.Second),
+		RefreshToken: "RefreshToken01",
+	}
+	store := &testCredentialsStore{creds: creds}
+	qt := newTestOAuthApi(t, server, creds, store)
+
+	sym, err := qt.GetSymbol("ACME")
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", sym.Id)
+	assert.Equal(t, 1, server.refreshCount)
+	assert.Equal(t, []string{"/oauth2/token", "/v1/symbols/search"}, server.requests)
+
+	// The rotated refresh token is saved along with the time it was issued
+	assert.Equal(t, 1, store.saveCount)
+	assert.False(t, store.locked)
+	assert.Equal(t, "AccessToken02", store.creds.AccessToken)
+	assert.Equal(t, "RefreshToken02", store.creds.RefreshToken)
+	assert.WithinDuration(t, time.Now(), store.creds.IssuedAt, time.Minute)
+}
+
+func TestRefreshCredentials_Unauthorized(t *testing.T) {
+	server := &testOAuthServer{accessToken: "AccessToken02", refreshToken: "RefreshToken01"}
+	store := &testCredentialsStore{}
+	qt := newTestOAuthApi(t, server, api.OAuthCredentials{
+		AccessToken:  "AccessToken01",
+		ApiServer:    "https://api01.iq.questrade.com/",
+		RefreshToken: "RefreshToken01",
+	}, store)
+
+	sym, err := qt.GetSymbol("ACME")
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", sym.Id)
+	assert.Equal(t, 1, server.refreshCount)
+	assert.Equal(t, 1, store.saveCount)
+	assert.Equal(t, []string{"/v1/symbols/search", "/oauth2/token", "/v1/symbols/search"}, server.requests)
+}
+
+func TestRefreshCredentials_InvalidRefreshToken(t *testing.T) {
+	server := &testOAuthServer{accessToken: "AccessToken02", refreshToken: "RefreshToken02"}
+	qt := newTestOAuthApi(t, server, api.OAuthCredentials{
+		AccessToken:  "AccessToken01",
+		ApiServer:    "https://api01.iq.questrade.com/",
+		RefreshToken: "RefreshToken01",
+	}, nil)
+
+	_, err := qt.GetSymbol("ACME")
+	assert.True(t, errors.Is(err, api.ErrRefreshTokenInvalid))
+
+	_, err = qt.RefreshCredentials()
+	assert.True(t, errors.Is(err, api.ErrRefreshTokenInvalid))
+}
+
+func TestRefreshCredentials_NoRefreshToken(t *testing.T) {
+	server := &testOAuthServer{accessToken: "AccessToken02"}
+	qt := newTestOAuthApi(t, server, api.OAuthCredentials{
+		AccessToken: "AccessToken01",
+		ApiServer:   "https://api01.iq.questrade.com/",
+	}, nil)
+
+	_, err := qt.GetSymbol("ACME")
+	assert.True(t, api.IsUnauthorized(err))
+	assert.Equal(t, 0, server.refreshCount)
+}
+
+func TestRefreshCredentials_RefreshedByAnotherProcess(t *testing.T) {
+	server := &testOAuthServer{accessToken: "AccessToken02", refreshToken: "RefreshToken02"}
+	store := &testCredentialsStore{creds: api.OAuthCredentials{
+		AccessToken:  "AccessToken02",
+		ApiServer:    "https://api02.iq.questrade.com/",
+		ExpiresIn:    1800,
+		IssuedAt:     time.Now(),
+		RefreshToken: "RefreshToken02",
+	}}
+	qt := newTestOAuthApi(t, server, api.OAuthCredentials{
+		AccessToken:  "AccessToken01",
+		ApiServer:    "https://api01.iq.questrade.com/",
+		RefreshToken: "RefreshToken01",
+	}, store)
+
+	// The stored credentials are used instead of redeeming the old refresh
+	// token, which has already been used
+	sym, err := qt.GetSymbol("ACME")
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", sym.Id)
+	assert.Equal(t, 0, server.refreshCount)
+	assert.Equal(t, 1, store.lockCount)
+	assert.Equal(t, 0, store.saveCount)
+	assert.Equal(t, []string{"/v1/symbols/search", "/v1/symbols/search"}, server.requests)
+}
+
+func TestRefreshCredentials_StoredCredentialsExpired(t *testing.T) {
+	server := &testOAuthServer{accessToken: "AccessToken02", refreshCount: 1, refreshToken: "RefreshToken02"}
+	store := &testCredentialsStore{creds: api.OAuthCredentials{
+		AccessToken:  "AccessToken02",
+		ApiServer:    "https://api02.iq.questrade.com/",
+		ExpiresIn:    1800,
+		IssuedAt:     time.Now().Add(-time.Hour),
+		RefreshToken: "RefreshToken02",
+	}}
+	qt := newTestOAuthApi(t, server, api.OAuthCredentials{
+		AccessToken:  "AccessToken01",
+		ApiServer:    "https://api01.iq.questrade.com/",
+		RefreshToken: "RefreshToken01",
+	}, store)
+
+	// The stored refresh token is redeemed since the stored access token has
+	// expired
+	creds, err := qt.RefreshCredentials()
+	assert.Nil(t, err)
+	assert.Equal(t, "AccessToken03", creds.AccessToken)
+	assert.Equal(t, 2, server.refreshCount)
+	assert.Equal(t, 1, store.saveCount)
+	assert.Equal(t, "RefreshToken03", store.creds.RefreshToken)
+}
+
+func TestRefreshCredentials_Copy(t *testing.T) {
+	server := &testOAuthServer{accessToken: "AccessToken01", refreshToken: "RefreshToken01"}
+	qt := newTestOAuthApi(t, server, api.OAuthCredentials{
+		AccessToken:  "AccessToken01",
+		ApiServer:    "https://api01.iq.questrade.com/",
+		RefreshToken: "RefreshToken01",
+	}, nil)
+
+	// Returned credentials are not changed by a later refresh
+	creds, err := qt.RefreshCredentials()
+	assert.Nil(t, err)
+	_, err = qt.RefreshCredentials()
+	assert.Nil(t, err)
+	assert.Equal(t, "AccessToken02", creds.AccessToken)
+	assert.Equal(t, "RefreshToken02", creds.RefreshToken)
+}
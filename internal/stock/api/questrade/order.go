@@ -0,0 +1,140 @@
+package questrade
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+)
+
+const (
+	apiOrders      = `https://{{.ApiServer}}/v1/accounts/{{.AccountId}}/orders`
+	apiOrderImpact = `https://{{.ApiServer}}/v1/accounts/{{.AccountId}}/orders/impact`
+)
+
+// Order actions and types
+const (
+	OrderActionBuy  = "Buy"
+	OrderActionSell = "Sell"
+	OrderTypeLimit  = "Limit"
+	OrderTypeMarket = "Market"
+)
+
+// OrderRequest is a request to place an order, or to calculate the impact of
+// an order without placing it
+type OrderRequest struct {
+	AccountNumber  string   `json:"accountNumber"`
+	SymbolId       int      `json:"symbolId"`
+	Quantity       int      `json:"quantity"`
+	LimitPrice     *float64 `json:"limitPrice,omitempty"`
+	IsAllOrNone    bool     `json:"isAllOrNone"`
+	IsAnonymous    bool     `json:"isAnonymous"`
+	OrderType      string   `json:"orderType"`
+	TimeInForce    string   `json:"timeInForce"`
+	Action         string   `json:"action"`
+	PrimaryRoute   string   `json:"primaryRoute"`
+	SecondaryRoute string   `json:"secondaryRoute"`
+}
+
+type OrderImpact struct {
+	EstimatedCommissions  float64 `json:"estimatedCommissions"`
+	BuyingPowerEffect     float64 `json:"buyingPowerEffect"`
+	BuyingPowerResult     float64 `json:"buyingPowerResult"`
+	MaintExcess           float64 `json:"maintExcess"`
+	Side                  string  `json:"side"`
+	AveragePrice          float64 `json:"averagePrice"`
+	TradeValueCalculation string  `json:"tradeValueCalculation"`
+}
+
+type orderResponse struct {
+	OrderId int `json:"orderId"`
+}
+
+// Placing an order is never retried, since a retried request could place a
+// duplicate order if the first request reached the server
+var orderRetryPolicy = api.RetryPolicy{Limit: 1}
+
+// Create a day order that is routed automatically. Orders must be for a whole
+// number of shares.
+func newOrderRequest(accountId string, sym stock.Symbol, order stock.Order) (*OrderRequest, error) {
+	if !order.Qty.Round(0).Equal(order.Qty) || order.Qty.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid order quantity for %s: %s", order.Symbol, order.Qty.String())
+	}
+
+	symbolId, err := strconv.Atoi(sym.Id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid symbol ID for %s: %s", order.Symbol, sym.Id)
+	}
+
+	req := OrderRequest{
+		AccountNumber:  accountId,
+		SymbolId:       symbolId,
+		Quantity:       int(order.Qty.Int()),
+		OrderType:      OrderTypeMarket,
+		TimeInForce:    "Day",
+		PrimaryRoute:   "AUTO",
+		SecondaryRoute: "AUTO",
+	}
+
+	switch order.Action {
+	case stock.OrderBuy:
+		req.Action = OrderActionBuy
+	case stock.OrderSell:
+		req.Action = OrderActionSell
+	default:
+		return nil, fmt.Errorf("invalid order action for %s: %s", order.Symbol, order.Action)
+	}
+
+	if order.LimitPrice.Sign() > 0 {
+		price := order.LimitPrice.Float()
+		req.LimitPrice = &price
+		req.OrderType = OrderTypeLimit
+	}
+
+	return &req, nil
+}
+
+func postOrderRequest(ctx context.Context, apiTemplate string, req *OrderRequest, retryPolicy api.RetryPolicy, apiKey, apiServer string, v interface{}, opts ...api.Option) error {
+	url, err := createAccountUrl(apiTemplate, req.AccountNumber, apiKey, apiServer)
+	if err == nil {
+		var reqBody, body []byte
+		if reqBody, err = json.Marshal(req); err == nil {
+			apiLimiter.SetRate(apiGetRequestInterval(), ApiRequestsBurstLimit)
+			if err = apiLimiter.WaitContext(ctx); err == nil {
+				if body, err = api.PostApiResponseBodyWithRetryContext(ctx, url, apiKey, reqBody, retryPolicy, isApiResponseRetryable, opts...); err == nil {
+					err = json.Unmarshal(body, v)
+				}
+			}
+		}
+	}
+	return err
+}
+
+// References:
+//   https://www.questrade.com/api/documentation/rest-operations/order-calls/accounts-id-orders-impact
+func GetOrderImpact(req *OrderRequest, apiKey, apiServer string) (*OrderImpact, error) {
+	return GetOrderImpactContext(context.Background(), req, apiKey, apiServer)
+}
+
+// GetOrderImpactContext gets the impact of an order until the context is done
+func GetOrderImpactContext(ctx context.Context, req *OrderRequest, apiKey, apiServer string, opts ...api.Option) (*OrderImpact, error) {
+	res := OrderImpact{}
+	err := postOrderRequest(ctx, apiOrderImpact, req, ApiRetryPolicy, apiKey, apiServer, &res, opts...)
+	return &res, err
+}
+
+// References:
+//   https://www.questrade.com/api/documentation/rest-operations/order-calls/accounts-id-orders
+func PlaceOrder(req *OrderRequest, apiKey, apiServer string) (int, error) {
+	return PlaceOrderContext(context.Background(), req, apiKey, apiServer)
+}
+
+// PlaceOrderContext places an order unless the context is done first
+func PlaceOrderContext(ctx context.Context, req *OrderRequest, apiKey, apiServer string, opts ...api.Option) (int, error) {
+	res := orderResponse{}
+	err := postOrderRequest(ctx, apiOrders, req, orderRetryPolicy, apiKey, apiServer, &res, opts...)
+	return res.OrderId, err
+}
@@ -0,0 +1,118 @@
+package questrade
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testOrderImpactUrl = "https://api01.iq.questrade.com/v1/accounts/26598145/orders/impact"
+	testOrdersUrl      = "https://api01.iq.questrade.com/v1/accounts/26598145/orders"
+)
+
+// Test server that records order requests and responds with a status code
+type testOrderServer struct {
+	orders     []OrderRequest
+	statusCode int
+	urls       []string
+}
+
+func (s *testOrderServer) roundTrip(req *http.Request) *http.Response {
+	if req.Method == http.MethodGet {
+		return newTestResponse(http.StatusOK, testSymbolSearchResponse)
+	}
+
+	s.urls = append(s.urls, req.URL.String())
+	order := OrderRequest{}
+	if body, err := ioutil.ReadAll(req.Body); err == nil {
+		json.Unmarshal(body, &order)
+	}
+	s.orders = append(s.orders, order)
+
+	if s.statusCode != http.StatusOK {
+		return newTestResponse(s.statusCode, `{"code": 1001, "message": "Internal server error"}`)
+	} else if req.URL.String() == testOrderImpactUrl {
+		return newTestResponse(http.StatusOK, `{"estimatedCommissions": 4.95, "buyingPowerEffect": -1254.95, "buyingPowerResult": 8745.05, "side": "Buy", "averagePrice": 125}`)
+	}
+	return newTestResponse(http.StatusOK, `{"orderId": 177106005, "orders": []}`)
+}
+
+func newTestOrderApi(t *testing.T, server *testOrderServer) api.OrderApi {
+	saveClient := api.Client
+	savePolicy := ApiRetryPolicy
+	t.Cleanup(func() {
+		api.Client = saveClient
+		ApiRetryPolicy = savePolicy
+	})
+	api.Client = NewTestClient(server.roundTrip)
+	ApiRetryPolicy = api.RetryPolicy{Limit: 3}
+	return NewApiQuestrade("AccessToken01", "api01.iq.questrade.com", api.OAuthCredentials{}, nil, nil).(api.OrderApi)
+}
+
+func TestNewOrderRequest(t *testing.T) {
+	sym := stock.Symbol{Id: "1234", Symbol: "ACME"}
+	req, err := newOrderRequest("26598145", sym, stock.Order{Action: stock.OrderBuy, LimitPrice: fp.NewF(125), Qty: fp.NewF(10), Symbol: "ACME"})
+	assert.Nil(t, err)
+	assert.Equal(t, "26598145", req.AccountNumber)
+	assert.Equal(t, 1234, req.SymbolId)
+	assert.Equal(t, 10, req.Quantity)
+	assert.Equal(t, OrderActionBuy, req.Action)
+	assert.Equal(t, OrderTypeLimit, req.OrderType)
+	assert.Equal(t, 125., *req.LimitPrice)
+
+	req, err = newOrderRequest("26598145", sym, stock.Order{Action: stock.OrderSell, Qty: fp.NewF(10), Symbol: "ACME"})
+	assert.Nil(t, err)
+	assert.Equal(t, OrderActionSell, req.Action)
+	assert.Equal(t, OrderTypeMarket, req.OrderType)
+	assert.Nil(t, req.LimitPrice)
+
+	_, err = newOrderRequest("26598145", sym, stock.Order{Action: stock.OrderBuy, Qty: fp.NewF(0.5), Symbol: "ACME"})
+	assert.NotNil(t, err)
+
+	_, err = newOrderRequest("26598145", sym, stock.Order{Action: "hold", Qty: fp.NewF(10), Symbol: "ACME"})
+	assert.NotNil(t, err)
+}
+
+func TestGetOrderImpact(t *testing.T) {
+	server := &testOrderServer{statusCode: http.StatusOK}
+	impact, err := newTestOrderApi(t, server).GetOrderImpact("26598145", stock.Order{Action: stock.OrderBuy, LimitPrice: fp.NewF(125), Qty: fp.NewF(10), Symbol: "ACME"})
+	assert.Nil(t, err)
+	assert.Equal(t, "-1254.95", impact.BuyingPowerEffect.StringN(2))
+	assert.Equal(t, "4.95", impact.Commission.StringN(2))
+	assert.Equal(t, "125.00", impact.Price.StringN(2))
+	assert.Equal(t, []string{testOrderImpactUrl}, server.urls)
+	assert.Equal(t, 1234, server.orders[0].SymbolId)
+}
+
+func TestPlaceOrder(t *testing.T) {
+	server := &testOrderServer{statusCode: http.StatusOK}
+	orderId, err := newTestOrderApi(t, server).PlaceOrder("26598145", stock.Order{Action: stock.OrderSell, Qty: fp.NewF(10), Symbol: "ACME"})
+	assert.Nil(t, err)
+	assert.Equal(t, "177106005", orderId)
+	assert.Equal(t, []string{testOrdersUrl}, server.urls)
+	assert.Equal(t, OrderActionSell, server.orders[0].Action)
+}
+
+func TestPlaceOrder_NotRetried(t *testing.T) {
+	server := &testOrderServer{statusCode: http.StatusInternalServerError}
+	orderApi := newTestOrderApi(t, server)
+
+	// Failed order impact requests are retried with the body resent
+	_, err := orderApi.GetOrderImpact("26598145", stock.Order{Action: stock.OrderBuy, Qty: fp.NewF(10), Symbol: "ACME"})
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, len(server.urls))
+	assert.Equal(t, 10, server.orders[2].Quantity)
+
+	// A failed order is never retried since it could be placed twice
+	server.urls = nil
+	_, err = orderApi.PlaceOrder("26598145", stock.Order{Action: stock.OrderBuy, Qty: fp.NewF(10), Symbol: "ACME"})
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{testOrdersUrl}, server.urls)
+}
@@ -1,16 +1,23 @@
 package questrade
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	fp "github.com/robaho/fixed"
 	"github.com/shanebarnes/stocker/internal/stock"
 	"github.com/shanebarnes/stocker/internal/stock/api"
 	"github.com/shanebarnes/stocker/internal/stock/api/exchangerate"
+	log "github.com/sirupsen/logrus"
 )
 
 const (
@@ -22,6 +29,10 @@ type qt struct {
 	apiServer string
 	cache     *stock.Cache
 	creds     api.OAuthCredentials
+	fxOpts    []api.Option // Exchange rate requests share the HTTP client, but not the base URL
+	mtx       sync.Mutex   // Guards the API key, API server and credentials
+	opts      []api.Option
+	store     api.CredentialsStore
 }
 
 type redeemTokenResponse struct {
@@ -32,11 +43,63 @@ type redeemTokenResponse struct {
 	TokenType    string `json:"token_type"`
 }
 
+func (q *qt) GetAccounts() ([]stock.Account, error) {
+	return q.GetAccountsContext(context.Background())
+}
+
+func (q *qt) GetAccountsContext(ctx context.Context) ([]stock.Account, error) {
+	var accts []stock.Account
+	var res []Account
+	err := q.withCredentials(ctx, func(apiKey, apiServer string) error {
+		var err error
+		res, err = GetAccountsContext(ctx, apiKey, apiServer, q.opts...)
+		return err
+	})
+	if err == nil {
+		for _, acct := range res {
+			accts = append(accts, stock.Account{
+				Id:      acct.Number,
+				Primary: acct.IsPrimary,
+				Status:  acct.Status,
+				Type:    acct.Type,
+			})
+		}
+	}
+	return accts, err
+}
+
+func (q *qt) GetBalances(accountId string) ([]stock.Balance, error) {
+	return q.GetBalancesContext(context.Background(), accountId)
+}
+
+func (q *qt) GetBalancesContext(ctx context.Context, accountId string) ([]stock.Balance, error) {
+	var balances []stock.Balance
+	var res []AccountBalance
+	err := q.withCredentials(ctx, func(apiKey, apiServer string) error {
+		var err error
+		res, err = GetAccountBalancesContext(ctx, accountId, apiKey, apiServer, q.opts...)
+		return err
+	})
+	if err == nil {
+		for _, balance := range res {
+			balances = append(balances, stock.Balance{
+				Cash:     fp.NewF(balance.Cash),
+				Currency: balance.Currency,
+			})
+		}
+	}
+	return balances, err
+}
+
 func (q *qt) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	return q.GetCurrencyContext(context.Background(), currency, currencyTo)
+}
+
+func (q *qt) GetCurrencyContext(ctx context.Context, currency, currencyTo string) (stock.Currency, error) {
 	ccy, err := q.cache.GetCurrency(currency, currencyTo)
 	if err != nil {
 		var xr *exchangerate.ExchangeRate
-		if xr, err = exchangerate.GetCurrencyExchangeRateInfo(currency, currencyTo, ""); err == nil {
+		if xr, err = exchangerate.GetCurrencyExchangeRateInfoContext(ctx, currency, currencyTo, "", q.fxOpts...); err == nil {
 			if _, exists := xr.Rates[currencyTo]; exists {
 				ccy.Currency = xr.BaseSymbol
 				ccy.Name = xr.BaseSymbol
@@ -54,12 +117,128 @@ func (q *qt) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
 	return ccy, err
 }
 
+func (q *qt) GetHistory(symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	return q.GetHistoryContext(context.Background(), symbol, interval, from, to)
+}
+
+func (q *qt) GetHistoryContext(ctx context.Context, symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	sym, err := q.GetSymbolContext(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Candle
+	if err = q.withCredentials(ctx, func(apiKey, apiServer string) error {
+		var err error
+		res, err = GetCandlesContext(ctx, sym.Id, interval, from, to, apiKey, apiServer, q.opts...)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	bars := make([]stock.Bar, 0, len(res))
+	for _, candle := range res {
+		var bar stock.Bar
+		if bar, err = newCandleBar(candle); err != nil {
+			return nil, err
+		}
+		bars = append(bars, bar)
+	}
+	return bars, nil
+}
+
+func (q *qt) getOrderRequest(ctx context.Context, accountId string, order stock.Order) (*OrderRequest, error) {
+	sym, err := q.GetSymbolContext(ctx, order.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	return newOrderRequest(accountId, sym, order)
+}
+
+func (q *qt) GetOrderImpact(accountId string, order stock.Order) (stock.OrderImpact, error) {
+	return q.GetOrderImpactContext(context.Background(), accountId, order)
+}
+
+func (q *qt) GetOrderImpactContext(ctx context.Context, accountId string, order stock.Order) (stock.OrderImpact, error) {
+	impact := stock.OrderImpact{}
+	req, err := q.getOrderRequest(ctx, accountId, order)
+	if err == nil {
+		var res *OrderImpact
+		if err = q.withCredentials(ctx, func(apiKey, apiServer string) error {
+			var err error
+			res, err = GetOrderImpactContext(ctx, req, apiKey, apiServer, q.opts...)
+			return err
+		}); err == nil {
+			impact.BuyingPowerEffect = fp.NewF(res.BuyingPowerEffect)
+			impact.Commission = fp.NewF(res.EstimatedCommissions)
+			impact.Price = fp.NewF(res.AveragePrice)
+		}
+	}
+	return impact, err
+}
+
+func (q *qt) GetPositions(accountId string) ([]stock.Position, error) {
+	return q.GetPositionsContext(context.Background(), accountId)
+}
+
+func (q *qt) GetPositionsContext(ctx context.Context, accountId string) ([]stock.Position, error) {
+	var positions []stock.Position
+	var res []AccountPosition
+	err := q.withCredentials(ctx, func(apiKey, apiServer string) error {
+		var err error
+		res, err = GetAccountPositionsContext(ctx, accountId, apiKey, apiServer, q.opts...)
+		return err
+	})
+	if err == nil {
+		for _, position := range res {
+			positions = append(positions, stock.Position{
+				Qty:    fp.NewF(position.OpenQuantity),
+				Symbol: position.Symbol,
+			})
+		}
+	}
+	return positions, err
+}
+
+func (q *qt) PlaceOrder(accountId string, order stock.Order) (string, error) {
+	return q.PlaceOrderContext(context.Background(), accountId, order)
+}
+
+func (q *qt) PlaceOrderContext(ctx context.Context, accountId string, order stock.Order) (string, error) {
+	orderId := ""
+	req, err := q.getOrderRequest(ctx, accountId, order)
+	if err == nil {
+		var res int
+		if err = q.withCredentials(ctx, func(apiKey, apiServer string) error {
+			var err error
+			res, err = PlaceOrderContext(ctx, req, apiKey, apiServer, q.opts...)
+			return err
+		}); err == nil {
+			orderId = strconv.Itoa(res)
+		}
+	}
+	return orderId, err
+}
+
 func (q *qt) GetQuote(symbol string) (stock.Quote, error) {
-	sym, _ := q.GetSymbol(symbol)
-	qte, err := q.cache.GetQuote(sym.Id)
+	return q.GetQuoteContext(context.Background(), symbol)
+}
+
+func (q *qt) GetQuoteContext(ctx context.Context, symbol string) (stock.Quote, error) {
+	sym, err := q.GetSymbolContext(ctx, symbol)
+	if err != nil {
+		return stock.Quote{}, err
+	}
+
+	// Quotes are cached by symbol rather than symbol ID
+	qte, err := q.cache.GetQuote(sym.Symbol)
 	if err != nil {
 		var quote *SymbolQuote
-		if quote, err = GetSymbolQuote(sym.Id, q.apiKey, q.apiServer); err == nil {
+		if err = q.withCredentials(ctx, func(apiKey, apiServer string) error {
+			var err error
+			quote, err = GetSymbolQuoteContext(ctx, sym.Id, apiKey, apiServer, q.opts...)
+			return err
+		}); err == nil {
 			qte.Symbol = quote.Symbol
 			qte.Prices.Ask = quote.AskPrice
 			qte.Prices.Bid = quote.BidPrice
@@ -67,7 +246,6 @@ func (q *qt) GetQuote(symbol string) (stock.Quote, error) {
 			qte.Prices.Low = quote.LowPrice
 			qte.Prices.Open = quote.OpenPrice
 			qte.Prices.Latest = quote.LastTradePrice
-			qte.Prices.Latest = quote.LastTradePriceTrHrs
 			qte.Prices.LatestTrHrs = quote.LastTradePriceTrHrs
 			qte.Volume = strconv.FormatInt(int64(quote.Volume), 10)
 
@@ -87,10 +265,18 @@ func getServerHostname(server string) (string, error) {
 }
 
 func (q *qt) GetSymbol(symbol string) (stock.Symbol, error) {
+	return q.GetSymbolContext(context.Background(), symbol)
+}
+
+func (q *qt) GetSymbolContext(ctx context.Context, symbol string) (stock.Symbol, error) {
 	sym, err := q.cache.GetSymbol(symbol)
 	if err != nil {
 		var match *SymbolSearchMatch
-		if match, err = GetSymbolSearch(symbol, q.apiKey, q.apiServer); err == nil {
+		if err = q.withCredentials(ctx, func(apiKey, apiServer string) error {
+			var err error
+			match, err = GetSymbolSearchContext(ctx, symbol, apiKey, apiServer, q.opts...)
+			return err
+		}); err == nil {
 			sym.Currency = match.Currency
 			sym.Description = match.Description
 			sym.Id = strconv.FormatInt(int64(match.SymbolId), 10)
@@ -107,7 +293,16 @@ func IsApiQuestrade(apiServer string) bool {
 	return strings.HasSuffix(apiServer, qtDomain)
 }
 
-func NewApiQuestrade(apiKey, apiServer string, creds api.OAuthCredentials) api.StockApi {
+// NewApiQuestrade creates a Questrade stock API. An in-memory cache is used if
+// no cache is provided. Credentials with a refresh token are refreshed before
+// the access token expires or when the access token is rejected, and the new
+// credentials are saved to the credentials store (if any). The options select
+// the HTTP client and server of the API, including its exchange rate requests.
+func NewApiQuestrade(apiKey, apiServer string, creds api.OAuthCredentials, cache *stock.Cache, store api.CredentialsStore, opts ...api.Option) api.StockApi {
+	if cache == nil {
+		cache = stock.NewCache()
+	}
+
 	if len(creds.AccessToken) > 0 && len(creds.ApiServer) > 0 {
 		apiKey = creds.AccessToken
 		apiServer, _ = getServerHostname(creds.ApiServer)
@@ -116,8 +311,11 @@ func NewApiQuestrade(apiKey, apiServer string, creds api.OAuthCredentials) api.S
 	return &qt{
 		apiKey:    apiKey,
 		apiServer: apiServer,
-		cache:     stock.NewCache(),
+		cache:     cache,
 		creds:     creds,
+		fxOpts:    []api.Option{api.WithHttpClient(api.NewOptions(opts...).Client)},
+		opts:      opts,
+		store:     store,
 	}
 }
 
@@ -125,24 +323,92 @@ func NewApiQuestrade(apiKey, apiServer string, creds api.OAuthCredentials) api.S
 //   https://www.questrade.com/api/documentation/getting-started
 //   https://www.questrade.com/api/documentation/security
 func (q *qt) RefreshCredentials() (*api.OAuthCredentials, error) {
+	return q.RefreshCredentialsContext(context.Background())
+}
+
+func (q *qt) RefreshCredentialsContext(ctx context.Context) (*api.OAuthCredentials, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return q.refreshCredentials(ctx)
+}
+
+// Refresh the credentials while holding the credentials store lock. If
+// another process has already refreshed the credentials, the stored
+// credentials are used instead of redeeming an old refresh token. The lock
+// must be held.
+func (q *qt) refreshCredentials(ctx context.Context) (*api.OAuthCredentials, error) {
+	if q.store == nil {
+		return q.redeemRefreshToken(ctx)
+	}
+
+	if err := q.store.Lock(); err != nil {
+		return nil, fmt.Errorf("failed to lock credentials: %w", err)
+	}
+	defer q.store.Unlock()
+
+	stored, err := q.store.Load()
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load credentials: %w", err)
+	}
+
+	if len(stored.RefreshToken) > 0 && stored.RefreshToken != q.creds.RefreshToken {
+		log.Debug("Using Questrade credentials refreshed by another process")
+		if err = q.setCredentials(stored); err != nil {
+			return nil, err
+		}
+		if expiresAt, known := stored.ExpiresAt(); known && time.Now().Add(credentialsRefreshMargin).Before(expiresAt) {
+			creds := q.creds
+			return &creds, nil
+		}
+	}
+
+	creds, err := q.redeemRefreshToken(ctx)
+
+	// The refresh token can only be used once, so the new refresh token must
+	// be saved
+	if err == nil {
+		if err = q.store.Save(creds); err != nil {
+			err = fmt.Errorf("failed to save refreshed credentials: %w", err)
+		}
+	}
+
+	return creds, err
+}
+
+// Redeem the refresh token for new credentials. The lock must be held, and
+// the returned credentials are a copy that can be read without it.
+func (q *qt) redeemRefreshToken(ctx context.Context) (*api.OAuthCredentials, error) {
 	var creds *api.OAuthCredentials
-	body, err := api.GetApiResponseBody("https://login.questrade.com/oauth2/token?grant_type=refresh_token&refresh_token="+q.creds.RefreshToken, "", isApiResponseRetryable)
+	issuedAt := time.Now()
+	body, err := api.GetApiResponseBodyWithRetryContext(ctx, apiTokenUrl+"?grant_type=refresh_token&refresh_token="+q.creds.RefreshToken, "", ApiRetryPolicy, isApiResponseRetryable, q.opts...)
 	if err == nil {
 		response := redeemTokenResponse{}
 		if err = json.Unmarshal(body, &response); err == nil {
-			q.creds = api.OAuthCredentials{
+			err = q.setCredentials(api.OAuthCredentials{
 				AccessToken:  response.AccessToken,
 				ApiServer:    response.ApiServer,
 				ExpiresIn:    response.ExpiresIn,
+				IssuedAt:     issuedAt,
 				RefreshToken: response.RefreshToken,
 				TokenType:    response.TokenType,
-			}
-			creds = &q.creds
-
-			q.apiKey = creds.AccessToken
-			q.apiServer, err = getServerHostname(creds.ApiServer)
+			})
+			saved := q.creds
+			creds = &saved
 		}
+	} else if isRefreshTokenRejected(err) {
+		err = fmt.Errorf("%w: %w", api.ErrRefreshTokenInvalid, err)
 	}
 
 	return creds, err
 }
+
+// Use new credentials for requests. The lock must be held.
+func (q *qt) setCredentials(creds api.OAuthCredentials) error {
+	var err error
+	q.creds = creds
+	q.apiKey = creds.AccessToken
+	q.apiServer, err = getServerHostname(creds.ApiServer)
+	return err
+}
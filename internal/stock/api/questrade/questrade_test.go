@@ -0,0 +1,30 @@
+package questrade
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCurrency_BaseUrl(t *testing.T) {
+	hosts := []string{}
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		hosts = append(hosts, req.URL.Host)
+		if req.URL.Path == "/latest" {
+			return newTestResponse(http.StatusOK, `{"success": true, "base": "USD", "date": "2023-06-02", "rates": {"CAD": 1.3421}}`)
+		}
+		return newTestResponse(http.StatusOK, testSymbolSearchResponse)
+	})
+	qt := NewApiQuestrade("AccessToken01", "api01.iq.questrade.com", api.OAuthCredentials{}, nil, nil, api.WithBaseUrl("http://127.0.0.1:8080"), api.WithHttpClient(client))
+
+	// Exchange rates are requested with the client of the Questrade server,
+	// but not from its base URL
+	_, err := qt.GetSymbol("ACME")
+	assert.Nil(t, err)
+	ccy, err := qt.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.3421", ccy.Rates["CAD"].String())
+	assert.Equal(t, []string{"127.0.0.1:8080", "api.exchangerate.host"}, hosts)
+}
@@ -0,0 +1,117 @@
+package questrade
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/shanebarnes/stocker/internal/stock/api/replay"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a Questrade API that replays the exchanges of a fixture without
+// retry delays
+func newReplayApi(t *testing.T, client *http.Client, creds api.OAuthCredentials) api.StockApi {
+	savePolicy := ApiRetryPolicy
+	t.Cleanup(func() {
+		ApiRetryPolicy = savePolicy
+	})
+	ApiRetryPolicy = api.RetryPolicy{Limit: 2}
+
+	return NewApiQuestrade("", "", creds, nil, nil, api.WithHttpClient(client))
+}
+
+// The fixture can be recorded again with the following command, which redeems
+// the refresh token:
+//
+//	STOCKER_RECORD=1 STOCKER_API_KEY=<your_refresh_token> go test -run TestReplay_StockApi
+func TestReplay_StockApi(t *testing.T) {
+	qt := newReplayApi(t, replay.NewTestClient(t, filepath.Join("testdata", "replay.json")), api.OAuthCredentials{RefreshToken: api.GetApiKeyFromEnv()})
+
+	creds, err := qt.RefreshCredentials()
+	assert.Nil(t, err)
+	if assert.NotNil(t, creds) {
+		assert.Equal(t, "https://api01.iq.questrade.com/", creds.ApiServer)
+		assert.Equal(t, 1800, creds.ExpiresIn)
+	}
+
+	sym, err := qt.GetSymbol("VTI")
+	assert.Nil(t, err)
+	assert.Equal(t, stock.Symbol{Currency: "USD", Description: "VANGUARD INDEX FUNDS VANGUARD TOTAL STOCK MARKET ETF", Id: "40128", Symbol: "VTI", Type: "Stock"}, sym)
+
+	quote, err := qt.GetQuote("VTI")
+	assert.Nil(t, err)
+	assert.Equal(t, "VTI", quote.Symbol)
+	assert.Equal(t, 221.14, quote.Prices.Ask)
+	assert.Equal(t, 221.1, quote.Prices.Bid)
+	assert.Equal(t, 221.47, quote.Prices.High)
+	assert.Equal(t, 219.53, quote.Prices.Low)
+	assert.Equal(t, 219.9, quote.Prices.Open)
+	assert.Equal(t, 221.13, quote.Prices.LatestTrHrs)
+	assert.Equal(t, 221.2, quote.Prices.Latest)
+	assert.Equal(t, "3306428", quote.Volume)
+
+	bars, err := qt.GetHistory("VTI", stock.IntervalDaily, time.Date(2023, time.May, 31, 0, 0, 0, 0, time.UTC), time.Date(2023, time.June, 2, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(bars)) {
+		assert.Equal(t, time.Date(2023, time.May, 31, 0, 0, 0, 0, time.UTC), bars[0].Time)
+		assert.Equal(t, "208.19", bars[0].Close.String())
+		assert.Equal(t, time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC), bars[1].Time)
+		assert.Equal(t, int64(3702400), bars[1].Volume)
+	}
+
+	ccy, err := qt.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, "USD", ccy.Currency)
+	assert.Equal(t, "1.3421", ccy.Rates["CAD"].String())
+
+	accts, err := qt.(api.AccountApi).GetAccounts()
+	assert.Nil(t, err)
+	if !assert.Equal(t, 1, len(accts)) {
+		return
+	}
+	assert.True(t, accts[0].Primary)
+
+	balances, err := qt.(api.AccountApi).GetBalances(accts[0].Id)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(balances))
+
+	positions, err := qt.(api.AccountApi).GetPositions(accts[0].Id)
+	assert.Nil(t, err)
+	assert.Equal(t, []stock.Position{{Qty: fp.NewF(100), Symbol: "VTI"}}, positions)
+
+	// Orders are never placed when recording, only their impact is calculated
+	impact, err := qt.(api.OrderApi).GetOrderImpact(accts[0].Id, stock.Order{Action: stock.OrderBuy, Qty: fp.NewF(10), Symbol: "VTI"})
+	assert.Nil(t, err)
+	assert.Equal(t, "221.13", impact.Price.String())
+	assert.Equal(t, "-2211.3", impact.BuyingPowerEffect.String())
+}
+
+func TestReplay_Errors(t *testing.T) {
+	qt := newReplayApi(t, replay.NewReplayClient(t, filepath.Join("testdata", "errors.json")), api.OAuthCredentials{
+		AccessToken:  "AccessToken01",
+		ApiServer:    "https://api01.iq.questrade.com/",
+		RefreshToken: "RefreshToken01",
+	})
+
+	_, err := qt.GetSymbol("XYZXYZ")
+	assert.NotNil(t, err)
+
+	// Requests are retried while the rate limit is reached
+	_, err = qt.GetSymbol("VXUS")
+	assert.True(t, api.IsRequestLimit(err))
+
+	// Server errors are retried
+	sym, err := qt.GetSymbol("BND")
+	assert.Nil(t, err)
+	assert.Equal(t, "16642", sym.Id)
+
+	// Rejected access tokens are refreshed, which can change the API server
+	sym, err = qt.GetSymbol("ACWI")
+	assert.Nil(t, err)
+	assert.Equal(t, "8924", sym.Id)
+}
@@ -2,8 +2,10 @@ package questrade
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"syscall"
 	"text/template"
 
 	"github.com/shanebarnes/stocker/internal/stock/api"
@@ -28,7 +30,7 @@ type SymbolQuote struct {
 	AskPrice            float64 `json:"askPrice"`
 	AskSize             int     `json:"askSize"`
 	LastTradePriceTrHrs float64 `json:"lastTradePriceTrHrs"`
-	LastTradePrice      float64 `json:"lastTracePrice"`
+	LastTradePrice      float64 `json:"lastTradePrice"`
 	LastTradeSize       int     `json:"lastTradeSize"`
 	LastTradeTick       string  `json:"lastTradeTick"`
 	LastTradeTime       string  `json:"lastTradeTime"`
@@ -59,19 +61,25 @@ func createSymbolQuoteUrl(symbolId, apiKey, apiServer string) (string, error) {
 }
 
 func GetSymbolQuote(symbolId, apiKey, apiServer string) (*SymbolQuote, error) {
+	return GetSymbolQuoteContext(context.Background(), symbolId, apiKey, apiServer)
+}
+
+// GetSymbolQuoteContext gets the quote of a symbol ID until the context is
+// done
+func GetSymbolQuoteContext(ctx context.Context, symbolId, apiKey, apiServer string, opts ...api.Option) (*SymbolQuote, error) {
 	var quote *SymbolQuote
 
 	url, err := createSymbolQuoteUrl(symbolId, apiKey, apiServer)
 	if err == nil {
 		var body []byte
-		if body, err = api.GetApiResponseBody(url, apiKey, isApiResponseRetryable); err == nil {
+		if body, err = getApiResponseBody(ctx, url, apiKey, opts...); err == nil {
 			sq := symbolQuote{}
 			if err = json.Unmarshal(body, &sq); err == nil {
 				if len(sq.Quotes) > 0 {
 					// TODO: look for exact match?
 					quote = &sq.Quotes[0]
 				} else {
-					err = errors.New("SymbolQuote: no matches found for " + symbolId)
+					err = fmt.Errorf("SymbolQuote: no matches found for %s: %w", symbolId, syscall.ENOENT)
 				}
 			}
 		}
@@ -2,9 +2,10 @@ package questrade
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"syscall"
 	"text/template"
 
 	"github.com/shanebarnes/stocker/internal/stock/api"
@@ -50,19 +51,24 @@ func createSymbolSearchUrl(symbol, apiKey, apiServer string) (string, error) {
 }
 
 func GetSymbolSearch(symbol, apiKey, apiServer string) (*SymbolSearchMatch, error) {
+	return GetSymbolSearchContext(context.Background(), symbol, apiKey, apiServer)
+}
+
+// GetSymbolSearchContext searches for a symbol until the context is done
+func GetSymbolSearchContext(ctx context.Context, symbol, apiKey, apiServer string, opts ...api.Option) (*SymbolSearchMatch, error) {
 	var match *SymbolSearchMatch
 
 	url, err := createSymbolSearchUrl(symbol, apiKey, apiServer)
 	if err == nil {
 		var body []byte
-		if body, err = api.GetApiResponseBody(url, apiKey, isApiResponseRetryable); err == nil {
+		if body, err = getApiResponseBody(ctx, url, apiKey, opts...); err == nil {
 			search := symbolSearch{}
 			if err = json.Unmarshal(body, &search); err == nil {
 				if len(search.Symbols) > 0 {
 					// TODO: look for exact match?
 					match = &search.Symbols[0]
 				} else {
-					err = errors.New("SymbolSearch: no matches found for " + symbol)
+					err = fmt.Errorf("SymbolSearch: no matches found for %s: %w", symbol, syscall.ENOENT)
 				}
 			} else {
 				fmt.Println("raw body: ", string(body))
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket that limits how often a stock API is called.
+// A token is added to the bucket every interval, up to a maximum burst of
+// tokens, and each request takes one token. It is safe for concurrent use.
+type RateLimiter struct {
+	burst    int
+	interval time.Duration
+	last     time.Time
+	mtx      sync.Mutex
+	tokens   float64
+}
+
+// NewRateLimiter creates a full token bucket. An interval of zero or less
+// does not limit requests.
+func NewRateLimiter(interval time.Duration, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &RateLimiter{
+		burst:    burst,
+		interval: interval,
+		tokens:   float64(burst),
+	}
+}
+
+// Take a token from the bucket, returning how long to wait before the token
+// can be used. Tokens may be borrowed from the future so that waiting requests
+// are served in order.
+func (r *RateLimiter) reserve(now time.Time) time.Duration {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.interval <= 0 {
+		return 0
+	}
+
+	if !r.last.IsZero() {
+		r.tokens += float64(now.Sub(r.last)) / float64(r.interval)
+		if r.tokens > float64(r.burst) {
+			r.tokens = float64(r.burst)
+		}
+	}
+	r.last = now
+
+	r.tokens--
+	if r.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-r.tokens * float64(r.interval))
+}
+
+// SetRate changes how often a token is added to the bucket and the maximum
+// number of tokens in the bucket
+func (r *RateLimiter) SetRate(interval time.Duration, burst int) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if burst < 1 {
+		burst = 1
+	}
+	r.burst = burst
+	r.interval = interval
+	if r.tokens > float64(burst) {
+		r.tokens = float64(burst)
+	}
+}
+
+// Return a token that was taken but not used
+func (r *RateLimiter) cancel() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.tokens < float64(r.burst) {
+		r.tokens++
+	}
+}
+
+// Wait blocks until a request can be made. A nil rate limiter never blocks.
+func (r *RateLimiter) Wait() {
+	r.WaitContext(context.Background())
+}
+
+// WaitContext blocks until a request can be made or the context is done,
+// returning the context error if the context is done first. The token is
+// returned to the bucket if the request cannot be made.
+func (r *RateLimiter) WaitContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil || r == nil {
+		return err
+	}
+
+	err := sleepContext(ctx, r.reserve(time.Now()))
+	if err != nil {
+		r.cancel()
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_Burst(t *testing.T) {
+	now := time.Now()
+	r := NewRateLimiter(time.Second, 2)
+	assert.Equal(t, time.Duration(0), r.reserve(now))
+	assert.Equal(t, time.Duration(0), r.reserve(now))
+	assert.Equal(t, time.Second, r.reserve(now))
+	assert.Equal(t, 2*time.Second, r.reserve(now))
+}
+
+func TestRateLimiter_Refill(t *testing.T) {
+	now := time.Now()
+	r := NewRateLimiter(time.Second, 1)
+	assert.Equal(t, time.Duration(0), r.reserve(now))
+	assert.Equal(t, time.Second, r.reserve(now))
+	assert.Equal(t, 500*time.Millisecond, r.reserve(now.Add(1500*time.Millisecond)))
+
+	// Tokens do not accumulate beyond the burst
+	assert.Equal(t, time.Duration(0), r.reserve(now.Add(time.Hour)))
+	assert.Equal(t, time.Second, r.reserve(now.Add(time.Hour)))
+}
+
+func TestRateLimiter_Unlimited(t *testing.T) {
+	now := time.Now()
+	r := NewRateLimiter(0, 0)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, time.Duration(0), r.reserve(now))
+	}
+
+	r.SetRate(time.Minute, 1)
+	assert.Equal(t, time.Duration(0), r.reserve(now))
+	assert.Equal(t, time.Minute, r.reserve(now))
+
+	var nilLimiter *RateLimiter
+	nilLimiter.Wait()
+}
+
+func TestRateLimiter_WaitContext(t *testing.T) {
+	r := NewRateLimiter(time.Hour, 1)
+	assert.Nil(t, r.WaitContext(context.Background()))
+
+	// The token is returned if the context is done before it can be used
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, r.WaitContext(ctx))
+	assert.Equal(t, time.Hour, r.reserve(time.Now()).Round(time.Minute))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, r.WaitContext(ctx))
+
+	var nilLimiter *RateLimiter
+	assert.Nil(t, nilLimiter.WaitContext(context.Background()))
+}
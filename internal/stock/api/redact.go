@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+)
+
+// Replaces secrets in logged requests and responses
+const redacted = "REDACTED"
+
+// LogUnredacted disables the redaction of secrets from logged requests,
+// responses and errors. It should only be enabled for local troubleshooting.
+var LogUnredacted = false
+
+var (
+	// Authorization headers keep their scheme, e.g. "Authorization: Bearer
+	// REDACTED"
+	redactAuthHeader = regexp.MustCompile(`(?im)^((?:proxy-)?authorization:[ \t]*)(?:(basic|bearer|token)[ \t]+)?[^\r\n]*`)
+	redactCookie     = regexp.MustCompile(`(?im)^((?:set-)?cookie:[ \t]*)[^\r\n]*`)
+
+	// Query string parameters, e.g. apikey=<key>
+	redactQuery = regexp.MustCompile(`(?i)([?&](?:access_key|access_token|api_key|apikey|client_secret|code|password|refresh_token|token)=)[^&\s"#]*`)
+
+	// JSON fields of token responses, e.g. "refresh_token": "<token>"
+	redactJson = regexp.MustCompile(`(?i)("(?:access_key|access_token|api_key|apikey|client_secret|password|refresh_token)"[ \t]*:[ \t]*")(?:[^"\\]|\\.)*"`)
+)
+
+// Redact masks the secrets in a request or response dump: authorization and
+// cookie headers, keys and tokens in query strings, and tokens in JSON bodies.
+// Nothing is masked if LogUnredacted is enabled.
+func Redact(dump string) string {
+	if LogUnredacted {
+		return dump
+	}
+	return Sanitize(dump)
+}
+
+// Sanitize masks the same secrets as Redact even if LogUnredacted is enabled,
+// e.g. before requests and responses are saved to test fixtures
+func Sanitize(dump string) string {
+	dump = redactAuthHeader.ReplaceAllStringFunc(dump, func(header string) string {
+		m := redactAuthHeader.FindStringSubmatch(header)
+		if len(m[2]) > 0 {
+			return m[1] + m[2] + " " + redacted
+		}
+		return m[1] + redacted
+	})
+	dump = redactCookie.ReplaceAllString(dump, "${1}"+redacted)
+	dump = redactQuery.ReplaceAllString(dump, "${1}"+redacted)
+	return redactJson.ReplaceAllString(dump, `${1}`+redacted+`"`)
+}
+
+// Mask the secrets in the URL of a failed request, which is included in its
+// error message
+func redactError(err error) error {
+	var uerr *url.Error
+	if err != nil && !LogUnredacted && errors.As(err, &uerr) {
+		uerr.URL = Redact(uerr.URL)
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact_Request(t *testing.T) {
+	dump := "GET /query?function=GLOBAL_QUOTE&symbol=AAPL&apikey=ABC123 HTTP/1.1\r\n" +
+		"Host: www.alphavantage.co\r\n" +
+		"Authorization: Bearer secret-token\r\n" +
+		"Cookie: session=abc\r\n" +
+		"Content-Type: application/json\r\n\r\n"
+
+	redactedDump := Redact(dump)
+	assert.Equal(t, "GET /query?function=GLOBAL_QUOTE&symbol=AAPL&apikey=REDACTED HTTP/1.1\r\n"+
+		"Host: www.alphavantage.co\r\n"+
+		"Authorization: Bearer REDACTED\r\n"+
+		"Cookie: REDACTED\r\n"+
+		"Content-Type: application/json\r\n\r\n", redactedDump)
+}
+
+func TestRedact_TokenResponse(t *testing.T) {
+	dump := "GET /oauth2/token?grant_type=refresh_token&refresh_token=old-token HTTP/1.1\r\n\r\n" +
+		"HTTP/1.1 200 OK\r\nSet-Cookie: id=1; Secure\r\n\r\n" +
+		`{"access_token": "new-access", "api_server": "https://api01.iq.questrade.com/", "expires_in": 1800, "refresh_token":"new-\"refresh", "token_type": "Bearer"}`
+
+	redactedDump := Redact(dump)
+	for _, secret := range []string{"old-token", "new-access", "new-\\\"refresh", "id=1"} {
+		assert.False(t, strings.Contains(redactedDump, secret), secret)
+	}
+	assert.Contains(t, redactedDump, "grant_type=refresh_token&refresh_token=REDACTED")
+	assert.Contains(t, redactedDump, `"access_token": "REDACTED"`)
+	assert.Contains(t, redactedDump, `"refresh_token":"REDACTED"`)
+	assert.Contains(t, redactedDump, `"api_server": "https://api01.iq.questrade.com/"`)
+	assert.Contains(t, redactedDump, `"token_type": "Bearer"`)
+}
+
+func TestRedact_Unredacted(t *testing.T) {
+	defer func() { LogUnredacted = false }()
+
+	dump := "GET /latest?base=USD&access_key=ABC123 HTTP/1.1\r\nAuthorization: Basic dXNlcjpwYXNz\r\n\r\n"
+	assert.Equal(t, "GET /latest?base=USD&access_key=REDACTED HTTP/1.1\r\nAuthorization: Basic REDACTED\r\n\r\n", Redact(dump))
+
+	LogUnredacted = true
+	assert.Equal(t, dump, Redact(dump))
+	assert.Equal(t, "GET /latest?base=USD&access_key=REDACTED HTTP/1.1\r\nAuthorization: Basic REDACTED\r\n\r\n", Sanitize(dump))
+}
+
+func TestRedactError(t *testing.T) {
+	err := redactError(&url.Error{Op: "Get", URL: "https://www.alphavantage.co/query?symbol=AAPL&apikey=ABC123", Err: syscall.ECONNRESET})
+	assert.Equal(t, `Get "https://www.alphavantage.co/query?symbol=AAPL&apikey=REDACTED": connection reset by peer`, err.Error())
+	assert.True(t, errors.Is(err, syscall.ECONNRESET))
+	assert.Nil(t, redactError(nil))
+}
+
+func TestMakeApiRequestWithRetryPolicy_Redact(t *testing.T) {
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		return nil
+	})}
+
+	// The URL of a failed request is redacted in its error
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/query?apikey=ABC123", nil)
+	var rerr error
+	MakeApiRequestWithRetryPolicy(client, req, RetryPolicy{Limit: 1}, func(res *http.Response, err error) bool {
+		rerr = err
+		return false
+	})
+	assert.NotNil(t, rerr)
+	assert.NotContains(t, rerr.Error(), "ABC123")
+}
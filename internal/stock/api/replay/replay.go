@@ -0,0 +1,251 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+)
+
+// RecordEnvName enables the recording of fixture files by NewTestClient
+const RecordEnvName = "STOCKER_RECORD"
+
+// Response headers that are saved to fixture files. Other headers, including
+// cookies, are dropped.
+var recordedHeaders = []string{
+	"Content-Type",
+	api.RateLimitRemainingHeader,
+	api.RateLimitResetHeader,
+	api.RetryAfterHeader,
+}
+
+// Fixture is a sequence of HTTP exchanges saved to a file
+type Fixture struct {
+	Exchanges []Exchange `json:"exchanges"`
+}
+
+// Exchange is a request and its response. Secrets in the URL and bodies are
+// masked before an exchange is saved, and requests are matched on their
+// masked URL when an exchange is replayed.
+type Exchange struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Body   string `json:"body,omitempty"`
+	Method string `json:"method"`
+	Url    string `json:"url"`
+}
+
+type Response struct {
+	Body       string            `json:"body"`
+	Header     map[string]string `json:"header,omitempty"`
+	StatusCode int               `json:"status"`
+}
+
+// Recorder is an HTTP transport that saves the exchanges made through
+// another transport
+type Recorder struct {
+	exchanges []Exchange
+	mtx       sync.Mutex
+	transport http.RoundTripper
+}
+
+// Replayer is an HTTP transport that answers requests with the exchanges of a
+// fixture, in the order they were recorded, without making any requests
+type Replayer struct {
+	exchanges []Exchange
+	mtx       sync.Mutex
+	used      []bool
+}
+
+// NewRecorder records the exchanges made through a transport, or through the
+// default transport if none is provided
+func NewRecorder(transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{transport: transport}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	res, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+
+	exchange := Exchange{
+		Request: Request{
+			Body:   api.Sanitize(string(reqBody)),
+			Method: req.Method,
+			Url:    api.Sanitize(req.URL.String()),
+		},
+		Response: Response{
+			Body:       api.Sanitize(string(resBody)),
+			StatusCode: res.StatusCode,
+		},
+	}
+	for _, key := range recordedHeaders {
+		if val := res.Header.Get(key); len(val) > 0 {
+			if exchange.Response.Header == nil {
+				exchange.Response.Header = make(map[string]string)
+			}
+			exchange.Response.Header[key] = val
+		}
+	}
+
+	r.mtx.Lock()
+	r.exchanges = append(r.exchanges, exchange)
+	r.mtx.Unlock()
+	return res, nil
+}
+
+// Save writes the recorded exchanges to a fixture file
+func (r *Recorder) Save(file string) error {
+	r.mtx.Lock()
+	fixture := Fixture{Exchanges: append([]Exchange{}, r.exchanges...)}
+	r.mtx.Unlock()
+
+	buf, err := json.MarshalIndent(fixture, "", "  ")
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(file), 0755); err == nil {
+			err = ioutil.WriteFile(file, append(buf, '\n'), 0644)
+		}
+	}
+	return err
+}
+
+// Load reads a fixture file for replay
+func Load(file string) (*Replayer, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := Fixture{}
+	if err = json.Unmarshal(buf, &fixture); err != nil {
+		return nil, fmt.Errorf("replay: invalid fixture %s: %w", file, err)
+	}
+	return NewReplayer(fixture), nil
+}
+
+// NewReplayer replays the exchanges of a fixture
+func NewReplayer(fixture Fixture) *Replayer {
+	return &Replayer{
+		exchanges: fixture.Exchanges,
+		used:      make([]bool, len(fixture.Exchanges)),
+	}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	method := req.Method
+	url := api.Sanitize(req.URL.String())
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for i, exchange := range r.exchanges {
+		if !r.used[i] && exchange.Request.Method == method && exchange.Request.Url == url {
+			r.used[i] = true
+			res := &http.Response{
+				Body:          ioutil.NopCloser(strings.NewReader(exchange.Response.Body)),
+				ContentLength: int64(len(exchange.Response.Body)),
+				Header:        make(http.Header),
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Request:       req,
+				Status:        fmt.Sprintf("%d %s", exchange.Response.StatusCode, http.StatusText(exchange.Response.StatusCode)),
+				StatusCode:    exchange.Response.StatusCode,
+			}
+			for key, val := range exchange.Response.Header {
+				res.Header.Set(key, val)
+			}
+			return res, nil
+		}
+	}
+	return nil, fmt.Errorf("replay: no recorded response for %s %s", method, url)
+}
+
+// Unused returns the exchanges that have not been replayed
+func (r *Replayer) Unused() []Exchange {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	unused := []Exchange{}
+	for i, exchange := range r.exchanges {
+		if !r.used[i] {
+			unused = append(unused, exchange)
+		}
+	}
+	return unused
+}
+
+// NewTestClient returns an HTTP client that replays a fixture file. If the
+// STOCKER_RECORD environment variable is set, real requests are made instead
+// and the exchanges are saved to the fixture file when the test ends. Replayed
+// tests fail if any exchange of the fixture is not used.
+func NewTestClient(t testing.TB, file string) *http.Client {
+	t.Helper()
+
+	if len(os.Getenv(RecordEnvName)) > 0 {
+		recorder := NewRecorder(nil)
+		t.Cleanup(func() {
+			if err := recorder.Save(file); err != nil {
+				t.Errorf("replay: failed to save fixture %s: %v", file, err)
+			}
+		})
+		return &http.Client{Timeout: api.DefaultClientTimeout, Transport: recorder}
+	}
+
+	return NewReplayClient(t, file)
+}
+
+// NewReplayClient returns an HTTP client that replays a fixture file, even if
+// the STOCKER_RECORD environment variable is set, e.g. for error responses
+// that cannot be recorded on demand. The test fails if any exchange of the
+// fixture is not used.
+func NewReplayClient(t testing.TB, file string) *http.Client {
+	t.Helper()
+
+	replayer, err := Load(file)
+	if err != nil {
+		t.Fatalf("replay: failed to load fixture %s: %v", file, err)
+	}
+	t.Cleanup(func() {
+		for _, exchange := range replayer.Unused() {
+			t.Errorf("replay: unused exchange %s %s", exchange.Request.Method, exchange.Request.Url)
+		}
+	})
+	return &http.Client{Timeout: api.DefaultClientTimeout, Transport: replayer}
+}
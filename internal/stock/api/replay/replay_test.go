@@ -0,0 +1,109 @@
+package replay
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func getBody(t *testing.T, client *http.Client, method, url string, reqBody []byte) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(reqBody))
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer access-token")
+
+	res, err := client.Do(req)
+	if !assert.Nil(t, err) {
+		return nil, ""
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	assert.Nil(t, err)
+	return res, string(body)
+}
+
+func TestRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Header().Set(api.RateLimitRemainingHeader, "29")
+		if req.Method == http.MethodPost {
+			body, _ := ioutil.ReadAll(req.Body)
+			w.Write(body)
+		} else {
+			w.Write([]byte(`{"access_token":"new-token","api_server":"https://api01.iq.questrade.com/"}`))
+		}
+	}))
+	defer server.Close()
+
+	recorder := NewRecorder(nil)
+	client := &http.Client{Transport: recorder}
+	res, body := getBody(t, client, http.MethodGet, server.URL+"/oauth2/token?grant_type=refresh_token&refresh_token=old-token", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, `{"access_token":"new-token","api_server":"https://api01.iq.questrade.com/"}`, body)
+	_, body = getBody(t, client, http.MethodPost, server.URL+"/v1/accounts/1/orders", []byte(`{"symbolId":8049}`))
+	assert.Equal(t, `{"symbolId":8049}`, body)
+
+	file := filepath.Join(t.TempDir(), "testdata", "fixture.json")
+	assert.Nil(t, recorder.Save(file))
+
+	buf, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(buf), "old-token")
+	assert.NotContains(t, string(buf), "new-token")
+	assert.NotContains(t, string(buf), "access-token")
+	assert.NotContains(t, string(buf), "session")
+
+	replayer, err := Load(file)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(replayer.Unused()))
+
+	// Requests are matched on their masked URL
+	client = &http.Client{Transport: replayer}
+	res, body = getBody(t, client, http.MethodGet, server.URL+"/oauth2/token?grant_type=refresh_token&refresh_token=other-token", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	assert.Equal(t, "29", res.Header.Get(api.RateLimitRemainingHeader))
+	assert.Empty(t, res.Header.Get("Set-Cookie"))
+	assert.Equal(t, `{"access_token":"REDACTED","api_server":"https://api01.iq.questrade.com/"}`, body)
+	_, body = getBody(t, client, http.MethodPost, server.URL+"/v1/accounts/1/orders", []byte(`{"symbolId":8049}`))
+	assert.Equal(t, `{"symbolId":8049}`, body)
+	assert.Empty(t, replayer.Unused())
+
+	// Each exchange is only replayed once
+	_, err = client.Get(server.URL + "/v1/accounts/1/orders")
+	assert.NotNil(t, err)
+}
+
+func TestReplayer(t *testing.T) {
+	replayer := NewReplayer(Fixture{Exchanges: []Exchange{
+		{Request: Request{Method: http.MethodGet, Url: "https://api.example.com/quote"}, Response: Response{Body: "busy", StatusCode: http.StatusServiceUnavailable}},
+		{Request: Request{Method: http.MethodGet, Url: "https://api.example.com/quote"}, Response: Response{Body: "ok", StatusCode: http.StatusOK}},
+		{Request: Request{Method: http.MethodGet, Url: "https://api.example.com/search"}, Response: Response{Body: "[]", StatusCode: http.StatusOK}},
+	}})
+	client := &http.Client{Transport: replayer}
+
+	// Repeated requests get the recorded responses in order
+	res, body := getBody(t, client, http.MethodGet, "https://api.example.com/quote", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, "busy", body)
+	res, body = getBody(t, client, http.MethodGet, "https://api.example.com/quote", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "ok", body)
+
+	_, err := client.Post("https://api.example.com/search", "application/json", nil)
+	assert.NotNil(t, err)
+
+	unused := replayer.Unused()
+	assert.Equal(t, 1, len(unused))
+	assert.Equal(t, "https://api.example.com/search", unused[0].Request.Url)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.json"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// Default fraction of each backoff delay that is randomized
+	DefaultRequestBackoffJitter = 0.2
+
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset"
+	RetryAfterHeader         = "Retry-After"
+)
+
+// RetryPolicy controls how failed stock API requests are retried. The backoff
+// delay doubles after each retry up to the backoff cap.
+type RetryPolicy struct {
+	BackoffCap    time.Duration // Maximum delay between retries
+	BackoffDelay  time.Duration // Delay before the first retry
+	Jitter        float64       // Fraction of each delay that is randomized, from 0 to 1
+	Limit         int           // Maximum number of attempts
+	RetryAfterCap time.Duration // Maximum delay requested by a server that is waited for, or DefaultRequestRetryAfterLimit if not set
+}
+
+// DefaultRetryPolicy returns the retry policy used when a stock API does not
+// provide its own
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		BackoffCap:    DefaultRequestBackoffLimit,
+		BackoffDelay:  DefaultRequestBackoffDelay,
+		Jitter:        DefaultRequestBackoffJitter,
+		Limit:         DefaultRequestRetryLimit,
+		RetryAfterCap: DefaultRequestRetryAfterLimit,
+	}
+}
+
+// Maximum delay requested by a server that is waited for before a retry, which
+// is no longer than the time left before the deadline of the context
+func (r RetryPolicy) getRetryAfterCap(ctx context.Context, now time.Time) time.Duration {
+	limit := r.RetryAfterCap
+	if limit <= 0 {
+		limit = DefaultRequestRetryAfterLimit
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(now) < limit {
+		limit = deadline.Sub(now)
+	}
+	return limit
+}
+
+// Delay before a retry, where random is a number from 0 to 1 used to
+// randomize the jittered part of the delay
+func (r RetryPolicy) getBackoff(retry int, random float64) time.Duration {
+	backoff := r.BackoffDelay
+	for i := 0; i < retry && backoff < r.BackoffCap; i++ {
+		backoff = backoff * 2
+	}
+	if backoff > r.BackoffCap {
+		backoff = r.BackoffCap
+	}
+
+	jitter := r.Jitter
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+	return backoff - time.Duration(float64(backoff)*jitter*random)
+}
+
+// Delay requested by a server before a request is retried, using either the
+// Retry-After header, or the X-RateLimit-Reset header (seconds since the
+// epoch) once the rate limit has been reached
+func getRetryAfter(res *http.Response, now time.Time) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+
+	if val := res.Header.Get(RetryAfterHeader); len(val) > 0 {
+		if secs, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return time.Duration(secs) * time.Second, true
+		} else if tm, err := http.ParseTime(val); err == nil {
+			return tm.Sub(now), true
+		}
+	}
+
+	if res.Header.Get(RateLimitRemainingHeader) == "0" {
+		if val := res.Header.Get(RateLimitResetHeader); len(val) > 0 {
+			if secs, err := strconv.ParseInt(val, 10, 64); err == nil {
+				return time.Unix(secs, 0).Sub(now), true
+			}
+		}
+	}
+
+	return 0, false
+}
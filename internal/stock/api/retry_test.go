@@ -0,0 +1,196 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripFunc func(req *http.Request) *http.Response
+
+func (fn roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req), nil
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	assert.Equal(t, DefaultRequestBackoffLimit, policy.BackoffCap)
+	assert.Equal(t, DefaultRequestBackoffDelay, policy.BackoffDelay)
+	assert.Equal(t, DefaultRequestBackoffJitter, policy.Jitter)
+	assert.Equal(t, DefaultRequestRetryLimit, policy.Limit)
+	assert.Equal(t, DefaultRequestRetryAfterLimit, policy.RetryAfterCap)
+}
+
+func TestRetryPolicy_GetRetryAfterCap(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, DefaultRequestRetryAfterLimit, RetryPolicy{}.getRetryAfterCap(context.Background(), now))
+	assert.Equal(t, time.Hour, RetryPolicy{RetryAfterCap: time.Hour}.getRetryAfterCap(context.Background(), now))
+
+	// Delays are not waited for past the deadline of the context
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(10*time.Second))
+	defer cancel()
+	assert.Equal(t, 10*time.Second, RetryPolicy{RetryAfterCap: time.Hour}.getRetryAfterCap(ctx, now))
+}
+
+func TestRetryPolicy_GetBackoff(t *testing.T) {
+	policy := RetryPolicy{BackoffCap: time.Second, BackoffDelay: 100 * time.Millisecond}
+	assert.Equal(t, 100*time.Millisecond, policy.getBackoff(0, 0.5))
+	assert.Equal(t, 200*time.Millisecond, policy.getBackoff(1, 0.5))
+	assert.Equal(t, 800*time.Millisecond, policy.getBackoff(3, 0.5))
+	assert.Equal(t, time.Second, policy.getBackoff(4, 0.5))
+	assert.Equal(t, time.Second, policy.getBackoff(100, 0.5))
+
+	policy.Jitter = 0.5
+	assert.Equal(t, 100*time.Millisecond, policy.getBackoff(0, 0))
+	assert.Equal(t, 75*time.Millisecond, policy.getBackoff(0, 0.5))
+	assert.Equal(t, 50*time.Millisecond, policy.getBackoff(0, 1))
+}
+
+func TestGetRetryAfter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	_, ok := getRetryAfter(nil, now)
+	assert.False(t, ok)
+
+	res := &http.Response{Header: make(http.Header)}
+	_, ok = getRetryAfter(res, now)
+	assert.False(t, ok)
+
+	res.Header.Set(RetryAfterHeader, "3")
+	delay, ok := getRetryAfter(res, now)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, delay)
+
+	res.Header.Set(RetryAfterHeader, now.Add(5*time.Second).UTC().Format(http.TimeFormat))
+	delay, ok = getRetryAfter(res, now)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, delay)
+
+	// The rate limit reset time is only used once the limit has been reached
+	res = &http.Response{Header: make(http.Header)}
+	res.Header.Set(RateLimitResetHeader, strconv.FormatInt(now.Unix()+7, 10))
+	res.Header.Set(RateLimitRemainingHeader, "10")
+	_, ok = getRetryAfter(res, now)
+	assert.False(t, ok)
+
+	res.Header.Set(RateLimitRemainingHeader, "0")
+	delay, ok = getRetryAfter(res, now)
+	assert.True(t, ok)
+	assert.Equal(t, 7*time.Second, delay)
+}
+
+func TestMakeApiRequestWithRetryPolicy(t *testing.T) {
+	requestCount := 0
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		requestCount++
+		res := &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString("")),
+			Header:     make(http.Header),
+			StatusCode: http.StatusTooManyRequests,
+		}
+		res.Header.Set(RetryAfterHeader, "0")
+		return res
+	})}
+
+	// A long backoff is not used when the server requests a delay
+	policy := RetryPolicy{BackoffCap: time.Hour, BackoffDelay: time.Hour, Limit: 3}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	start := time.Now()
+	MakeApiRequestWithRetryPolicy(client, req, policy, func(res *http.Response, err error) bool {
+		return res.StatusCode == http.StatusTooManyRequests
+	})
+	assert.Equal(t, 3, requestCount)
+	assert.Less(t, time.Since(start), time.Minute)
+}
+
+func TestMakeApiRequestWithRetryPolicy_Context(t *testing.T) {
+	requestCount := 0
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		requestCount++
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString("")),
+			Header:     make(http.Header),
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	})}
+
+	// The backoff delay is cancelled when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	policy := RetryPolicy{BackoffCap: time.Hour, BackoffDelay: time.Hour, Limit: 3}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://example.com", nil)
+	start := time.Now()
+	var rerr error
+	MakeApiRequestWithRetryPolicy(client, req, policy, func(res *http.Response, err error) bool {
+		rerr = err
+		return true
+	})
+	assert.Equal(t, 1, requestCount)
+	assert.True(t, errors.Is(rerr, context.DeadlineExceeded))
+	assert.Less(t, time.Since(start), time.Minute)
+}
+
+func TestMakeApiRequestWithRetryPolicy_RetryAfterCap(t *testing.T) {
+	requestCount := 0
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		requestCount++
+		res := &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString("")),
+			Header:     make(http.Header),
+			StatusCode: http.StatusTooManyRequests,
+		}
+		res.Header.Set(RetryAfterHeader, "86400")
+		return res
+	})}
+
+	// A server requested delay longer than the retry after cap is not waited
+	// for
+	policy := DefaultRetryPolicy()
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	start := time.Now()
+	var rerr error
+	MakeApiRequestWithRetryPolicy(client, req, policy, func(res *http.Response, err error) bool {
+		rerr = err
+		return res != nil && res.StatusCode == http.StatusTooManyRequests
+	})
+	assert.Equal(t, 1, requestCount)
+	assert.True(t, IsRequestLimit(rerr))
+	assert.Contains(t, rerr.Error(), "24h0m0s")
+	assert.Less(t, time.Since(start), time.Minute)
+}
+
+func TestMakeApiRequestWithRetryPolicy_RetryAfterDefault(t *testing.T) {
+	requestCount := 0
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		requestCount++
+		res := &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString("")),
+			Header:     make(http.Header),
+			StatusCode: http.StatusOK,
+		}
+		if requestCount == 1 {
+			res.StatusCode = http.StatusTooManyRequests
+			res.Header.Set(RetryAfterHeader, "5")
+		}
+		return res
+	})}
+
+	// A server requested delay longer than the backoff cap is waited for
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	start := time.Now()
+	var rerr error
+	MakeApiRequestWithRetryPolicy(client, req, DefaultRetryPolicy(), func(res *http.Response, err error) bool {
+		rerr = err
+		return res != nil && res.StatusCode == http.StatusTooManyRequests
+	})
+	assert.Nil(t, rerr)
+	assert.Equal(t, 2, requestCount)
+	assert.GreaterOrEqual(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,32 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/shanebarnes/stocker/internal/stock/api/apitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContract(t *testing.T) {
+	s := NewSnapshot()
+	sym := apitest.SymbolInfo
+	sym.Type = "ETF"
+	s.Symbols[apitest.Symbol] = sym
+	s.Quotes[apitest.Symbol] = apitest.Quote
+	s.Currencies[apitest.Currency] = map[string]string{apitest.CurrencyTo: apitest.Rate}
+	s.History[apitest.Symbol] = map[string][]stock.Bar{stock.IntervalDaily: apitest.Bars}
+
+	filename := filepath.Join(t.TempDir(), "snapshot.json")
+	assert.Nil(t, s.WriteFile(filename))
+
+	apitest.Run(t, apitest.Contract{
+		NewApi: func(opts ...api.Option) api.StockApi {
+			stockApi, err := NewApiSnapshot(filePrefix + filename)
+			assert.Nil(t, err)
+			return stockApi
+		},
+	})
+}
@@ -0,0 +1,373 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+)
+
+const (
+	filePrefix = "file://"
+
+	typeCurrency = "currency"
+)
+
+// Snapshot is a point-in-time copy of the symbol, quote and exchange rate
+// information needed to rebalance a portfolio without making API calls, along
+// with any price history used by a backtest.
+type Snapshot struct {
+	Currencies map[string]map[string]string      `json:"currencies"`        // map[currency]map[currencyTo]ExchangeRate
+	History    map[string]map[string][]stock.Bar `json:"history,omitempty"` // map[symbol]map[interval]Bars
+	Quotes     map[string]stock.Quote            `json:"quotes"`
+	Symbols    map[string]stock.Symbol           `json:"symbols"`
+}
+
+type snap struct {
+	cache   *stock.Cache
+	history map[string]map[string][]stock.Bar
+}
+
+func (s *snap) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	ccy, err := s.cache.GetCurrency(currency, currencyTo)
+	if err != nil {
+		// Fall back to the inverse exchange rate if it is available
+		var inv stock.Currency
+		if inv, err = s.cache.GetCurrency(currencyTo, currency); err == nil {
+			if rate := inv.Rates[currency]; rate.GreaterThan(fp.NewF(0)) {
+				ccy = stock.Currency{
+					Currency: currency,
+					Name:     currency,
+					Rates:    map[string]fp.Fixed{currencyTo: fp.NewF(1).Div(rate)},
+				}
+			} else {
+				err = syscall.ENOENT
+			}
+		}
+	}
+
+	if err != nil {
+		err = fmt.Errorf("snapshot: no exchange rate from %s to %s: %w", currency, currencyTo, err)
+	}
+	return ccy, err
+}
+
+func (s *snap) GetHistory(symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	bars, exists := s.history[symbol][interval]
+	if !exists {
+		return nil, fmt.Errorf("snapshot: no %s history for %s: %w", interval, symbol, syscall.ENOENT)
+	}
+
+	history := []stock.Bar{}
+	for _, bar := range bars {
+		if !bar.Time.Before(from) && !bar.Time.After(to) {
+			history = append(history, bar)
+		}
+	}
+	return history, nil
+}
+
+func (s *snap) GetQuote(symbol string) (stock.Quote, error) {
+	qte, err := s.cache.GetQuote(symbol)
+	if err != nil {
+		err = fmt.Errorf("snapshot: no quote for %s: %w", symbol, err)
+	}
+	return qte, err
+}
+
+func (s *snap) GetSymbol(symbol string) (stock.Symbol, error) {
+	sym, err := s.cache.GetSymbol(symbol)
+	if err != nil {
+		err = fmt.Errorf("snapshot: no symbol information for %s: %w", symbol, err)
+	}
+	return sym, err
+}
+
+func (s *snap) RefreshCredentials() (*api.OAuthCredentials, error) {
+	return nil, syscall.ENOTSUP
+}
+
+func IsApiSnapshot(apiServer string) bool {
+	return strings.HasPrefix(apiServer, filePrefix)
+}
+
+// NewApiSnapshot creates a stock API that serves all requests from a JSON or
+// CSV snapshot file, e.g. file://prices.json
+func NewApiSnapshot(apiServer string) (api.StockApi, error) {
+	snapshot, err := ReadFile(strings.TrimPrefix(apiServer, filePrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &snap{cache: stock.NewCache(), history: snapshot.History}
+	// Entries are keyed by the symbol that was requested
+	for symbol, sym := range snapshot.Symbols {
+		sym.Symbol = symbol
+		s.cache.AddSymbol(sym)
+	}
+	for symbol, qte := range snapshot.Quotes {
+		qte.Symbol = symbol
+		s.cache.AddQuote(qte)
+	}
+	for currency, rates := range snapshot.Currencies {
+		ccy := stock.Currency{
+			Currency: currency,
+			Name:     currency,
+			Rates:    make(map[string]fp.Fixed),
+		}
+		for currencyTo, rate := range rates {
+			if ccy.Rates[currencyTo], err = fp.NewSErr(rate); err != nil {
+				return nil, fmt.Errorf("snapshot: invalid exchange rate from %s to %s: %s", currency, currencyTo, rate)
+			}
+		}
+		s.cache.AddCurrency(ccy)
+	}
+
+	return s, nil
+}
+
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		Currencies: make(map[string]map[string]string),
+		History:    make(map[string]map[string][]stock.Bar),
+		Quotes:     make(map[string]stock.Quote),
+		Symbols:    make(map[string]stock.Symbol),
+	}
+}
+
+// Merge bars into the history of a symbol, keeping the history sorted by time
+func (s *Snapshot) addHistory(symbol, interval string, bars []stock.Bar) {
+	if _, exists := s.History[symbol]; !exists {
+		s.History[symbol] = make(map[string][]stock.Bar)
+	}
+
+	merged := make(map[time.Time]stock.Bar)
+	for _, bar := range s.History[symbol][interval] {
+		merged[bar.Time] = bar
+	}
+	for _, bar := range bars {
+		merged[bar.Time] = bar
+	}
+
+	history := make([]stock.Bar, 0, len(merged))
+	for _, bar := range merged {
+		history = append(history, bar)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Time.Before(history[j].Time)
+	})
+	s.History[symbol][interval] = history
+}
+
+func (s *Snapshot) addCurrency(currency, currencyTo, rate string) {
+	if _, exists := s.Currencies[currency]; !exists {
+		s.Currencies[currency] = make(map[string]string)
+	}
+	s.Currencies[currency][currencyTo] = rate
+}
+
+// Snapshot CSV files contain one row per symbol with the header
+// "symbol,currency,price,description,type". Exchange rates are rows of type
+// "currency" where the symbol is converted into the currency at the price.
+func readCsv(r io.Reader) (*Snapshot, error) {
+	snapshot := NewSnapshot()
+
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	} else if len(records) == 0 {
+		return snapshot, nil
+	}
+
+	cols := make(map[string]int)
+	for i, name := range records[0] {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"symbol", "currency", "price"} {
+		if _, exists := cols[name]; !exists {
+			return nil, errors.New("snapshot: missing CSV column " + name)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, exists := cols[name]; exists && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	for _, record := range records[1:] {
+		symbol := field(record, "symbol")
+		currency := field(record, "currency")
+		price := field(record, "price")
+
+		if strings.ToLower(field(record, "type")) == typeCurrency {
+			snapshot.addCurrency(symbol, currency, price)
+			continue
+		}
+
+		var latest float64
+		if latest, err = strconv.ParseFloat(price, 64); err != nil {
+			return nil, fmt.Errorf("snapshot: invalid price for %s: %s", symbol, price)
+		}
+
+		qte := stock.Quote{Symbol: symbol}
+		qte.Prices.Latest = latest
+		snapshot.Quotes[symbol] = qte
+		snapshot.Symbols[symbol] = stock.Symbol{
+			Currency:    currency,
+			Description: field(record, "description"),
+			Symbol:      symbol,
+			Type:        field(record, "type"),
+		}
+	}
+
+	return snapshot, nil
+}
+
+// ReadFile loads a snapshot from a JSON file or, if the file has a .csv
+// extension, from a CSV file.
+func ReadFile(filename string) (*Snapshot, error) {
+	var snapshot *Snapshot
+
+	file, err := os.Open(filename)
+	if err == nil {
+		defer file.Close()
+		if strings.EqualFold(filepath.Ext(filename), ".csv") {
+			snapshot, err = readCsv(file)
+		} else {
+			snapshot = NewSnapshot()
+			err = json.NewDecoder(file).Decode(snapshot)
+		}
+	}
+
+	if err != nil {
+		err = fmt.Errorf("snapshot: invalid file %s: %w", filename, err)
+	}
+	return snapshot, err
+}
+
+// WriteFile saves the snapshot as JSON.
+func (s *Snapshot) WriteFile(filename string) error {
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(filename, buf, 0644)
+	}
+	return err
+}
+
+// Recorder is a stock API that passes requests through to another stock API
+// and keeps a snapshot of every successful response.
+type Recorder struct {
+	api      api.StockApi
+	fx       api.FxApi
+	mtx      sync.Mutex
+	snapshot *Snapshot
+}
+
+func NewRecorder(api api.StockApi) *Recorder {
+	return &Recorder{
+		api:      api,
+		snapshot: NewSnapshot(),
+	}
+}
+
+func (r *Recorder) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	return r.GetCurrencyContext(context.Background(), currency, currencyTo)
+}
+
+func (r *Recorder) GetCurrencyContext(ctx context.Context, currency, currencyTo string) (stock.Currency, error) {
+	var fx api.FxApi = r.api
+	if r.fx != nil {
+		fx = r.fx
+	}
+
+	ccy, err := api.NewFxApiContext(fx).GetCurrencyContext(ctx, currency, currencyTo)
+	if err == nil {
+		if rate, exists := ccy.Rates[currencyTo]; exists {
+			r.mtx.Lock()
+			r.snapshot.addCurrency(currency, currencyTo, rate.String())
+			r.mtx.Unlock()
+		}
+	}
+	return ccy, err
+}
+
+// RecordFx passes exchange rate requests through to an exchange rate API
+// instead of the stock API
+func (r *Recorder) RecordFx(fx api.FxApi) {
+	r.fx = fx
+}
+
+func (r *Recorder) GetHistory(symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	return r.GetHistoryContext(context.Background(), symbol, interval, from, to)
+}
+
+func (r *Recorder) GetHistoryContext(ctx context.Context, symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	bars, err := api.NewStockApiContext(r.api).GetHistoryContext(ctx, symbol, interval, from, to)
+	if err == nil {
+		r.mtx.Lock()
+		r.snapshot.addHistory(symbol, interval, bars)
+		r.mtx.Unlock()
+	}
+	return bars, err
+}
+
+func (r *Recorder) GetQuote(symbol string) (stock.Quote, error) {
+	return r.GetQuoteContext(context.Background(), symbol)
+}
+
+func (r *Recorder) GetQuoteContext(ctx context.Context, symbol string) (stock.Quote, error) {
+	qte, err := api.NewStockApiContext(r.api).GetQuoteContext(ctx, symbol)
+	if err == nil {
+		r.mtx.Lock()
+		r.snapshot.Quotes[symbol] = qte
+		r.mtx.Unlock()
+	}
+	return qte, err
+}
+
+func (r *Recorder) GetSymbol(symbol string) (stock.Symbol, error) {
+	return r.GetSymbolContext(context.Background(), symbol)
+}
+
+func (r *Recorder) GetSymbolContext(ctx context.Context, symbol string) (stock.Symbol, error) {
+	sym, err := api.NewStockApiContext(r.api).GetSymbolContext(ctx, symbol)
+	if err == nil {
+		r.mtx.Lock()
+		r.snapshot.Symbols[symbol] = sym
+		r.mtx.Unlock()
+	}
+	return sym, err
+}
+
+func (r *Recorder) RefreshCredentials() (*api.OAuthCredentials, error) {
+	return r.api.RefreshCredentials()
+}
+
+func (r *Recorder) RefreshCredentialsContext(ctx context.Context) (*api.OAuthCredentials, error) {
+	return api.NewStockApiContext(r.api).RefreshCredentialsContext(ctx)
+}
+
+// WriteFile saves everything recorded so far as a JSON snapshot that can be
+// replayed with NewApiSnapshot.
+func (r *Recorder) WriteFile(filename string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.snapshot.WriteFile(filename)
+}
@@ -0,0 +1,213 @@
+package snapshot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	fp "github.com/robaho/fixed"
+	"github.com/shanebarnes/stocker/internal/stock"
+	"github.com/shanebarnes/stocker/internal/stock/api"
+	"github.com/stretchr/testify/assert"
+)
+
+type testApi struct {
+	requests int
+}
+
+func (t *testApi) GetCurrency(currency, currencyTo string) (stock.Currency, error) {
+	t.requests++
+	return stock.Currency{
+		Currency: currency,
+		Name:     currency,
+		Rates:    map[string]fp.Fixed{currencyTo: fp.NewF(1.25)},
+	}, nil
+}
+
+func (t *testApi) GetHistory(symbol, interval string, from, to time.Time) ([]stock.Bar, error) {
+	t.requests++
+	bars := []stock.Bar{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		bars = append(bars, stock.Bar{AdjClose: fp.NewF(100), Close: fp.NewF(100), Time: day})
+	}
+	return bars, nil
+}
+
+func (t *testApi) GetQuote(symbol string) (stock.Quote, error) {
+	t.requests++
+	qte := stock.Quote{Symbol: symbol}
+	qte.Prices.Latest = 100.5
+	return qte, nil
+}
+
+func (t *testApi) GetSymbol(symbol string) (stock.Symbol, error) {
+	t.requests++
+	if symbol == "NONE" {
+		return stock.Symbol{}, syscall.ENOENT
+	}
+	return stock.Symbol{Currency: "USD", Description: "Acme Corp", Symbol: symbol, Type: "Equity"}, nil
+}
+
+func (t *testApi) RefreshCredentials() (*api.OAuthCredentials, error) {
+	return nil, syscall.ENOTSUP
+}
+
+func writeTestFile(t *testing.T, name, contents string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, os.WriteFile(filename, []byte(contents), 0644))
+	return filename
+}
+
+func TestIsApiSnapshot(t *testing.T) {
+	assert.True(t, IsApiSnapshot("file://prices.json"))
+	assert.True(t, IsApiSnapshot("file:///tmp/prices.csv"))
+	assert.False(t, IsApiSnapshot("alphavantage.co"))
+	assert.False(t, IsApiSnapshot("prices.json"))
+}
+
+func TestNewApiSnapshot_Csv(t *testing.T) {
+	filename := writeTestFile(t, "prices.csv", "symbol,currency,price,description,type\n"+
+		"ACME,USD,12.50,Acme Corp,Equity\n"+
+		"USD,CAD,1.3500,,Currency\n")
+
+	a, err := NewApiSnapshot("file://" + filename)
+	assert.Nil(t, err)
+
+	sym, err := a.GetSymbol("ACME")
+	assert.Nil(t, err)
+	assert.Equal(t, stock.Symbol{Currency: "USD", Description: "Acme Corp", Symbol: "ACME", Type: "Equity"}, sym)
+
+	qte, err := a.GetQuote("ACME")
+	assert.Nil(t, err)
+	assert.Equal(t, 12.5, qte.Prices.Latest)
+
+	ccy, err := a.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.3500", ccy.Rates["CAD"].StringN(4))
+
+	ccy, err = a.GetCurrency("CAD", "USD")
+	assert.Nil(t, err)
+	assert.Equal(t, "0.7407", ccy.Rates["USD"].Round(4).StringN(4))
+}
+
+func TestNewApiSnapshot_Invalid(t *testing.T) {
+	_, err := NewApiSnapshot("file://" + filepath.Join(t.TempDir(), "missing.json"))
+	assert.NotNil(t, err)
+
+	_, err = NewApiSnapshot("file://" + writeTestFile(t, "prices.csv", "symbol,price\nACME,1\n"))
+	assert.NotNil(t, err)
+
+	_, err = NewApiSnapshot("file://" + writeTestFile(t, "prices.csv", "symbol,currency,price\nACME,USD,abc\n"))
+	assert.NotNil(t, err)
+
+	_, err = NewApiSnapshot("file://" + writeTestFile(t, "prices.json", `{"currencies":{"USD":{"CAD":"abc"}}}`))
+	assert.NotNil(t, err)
+}
+
+func TestNewApiSnapshot_NotFound(t *testing.T) {
+	a, err := NewApiSnapshot("file://" + writeTestFile(t, "prices.json", "{}"))
+	assert.Nil(t, err)
+
+	_, err = a.GetSymbol("ACME")
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+
+	_, err = a.GetQuote("ACME")
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+
+	_, err = a.GetCurrency("USD", "CAD")
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+
+	_, err = a.RefreshCredentials()
+	assert.Equal(t, syscall.ENOTSUP, err)
+}
+
+func TestRecorder(t *testing.T) {
+	live := &testApi{}
+	recorder := NewRecorder(live)
+
+	_, err := recorder.GetSymbol("ACME")
+	assert.Nil(t, err)
+	_, err = recorder.GetSymbol("NONE")
+	assert.NotNil(t, err)
+	_, err = recorder.GetQuote("ACME")
+	assert.Nil(t, err)
+	_, err = recorder.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, live.requests)
+
+	filename := filepath.Join(t.TempDir(), "prices.json")
+	assert.Nil(t, recorder.WriteFile(filename))
+
+	a, err := NewApiSnapshot("file://" + filename)
+	assert.Nil(t, err)
+
+	sym, err := a.GetSymbol("ACME")
+	assert.Nil(t, err)
+	assert.Equal(t, "Acme Corp", sym.Description)
+
+	_, err = a.GetSymbol("NONE")
+	assert.NotNil(t, err)
+
+	qte, err := a.GetQuote("ACME")
+	assert.Nil(t, err)
+	assert.Equal(t, 100.5, qte.Prices.Latest)
+
+	ccy, err := a.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2500", ccy.Rates["CAD"].StringN(4))
+	assert.Equal(t, 4, live.requests)
+}
+
+func TestRecorder_RecordFx(t *testing.T) {
+	live := &testApi{}
+	fx := &testApi{}
+	recorder := NewRecorder(live)
+	recorder.RecordFx(fx)
+
+	_, err := recorder.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, live.requests)
+	assert.Equal(t, 1, fx.requests)
+
+	filename := filepath.Join(t.TempDir(), "prices.json")
+	assert.Nil(t, recorder.WriteFile(filename))
+	a, err := NewApiSnapshot("file://" + filename)
+	assert.Nil(t, err)
+	_, err = a.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+}
+
+func TestRecorder_History(t *testing.T) {
+	live := &testApi{}
+	recorder := NewRecorder(live)
+
+	day := func(d int) time.Time {
+		return time.Date(2023, time.January, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	// Overlapping histories are merged
+	_, err := recorder.GetHistory("ACME", stock.IntervalDaily, day(1), day(5))
+	assert.Nil(t, err)
+	_, err = recorder.GetHistory("ACME", stock.IntervalDaily, day(4), day(10))
+	assert.Nil(t, err)
+
+	filename := filepath.Join(t.TempDir(), "prices.json")
+	assert.Nil(t, recorder.WriteFile(filename))
+
+	a, err := NewApiSnapshot("file://" + filename)
+	assert.Nil(t, err)
+
+	bars, err := a.GetHistory("ACME", stock.IntervalDaily, day(3), day(8))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(bars))
+	assert.True(t, bars[0].Time.Equal(day(3)))
+	assert.True(t, bars[5].Time.Equal(day(8)))
+	assert.Equal(t, "100.00", bars[0].Close.StringN(2))
+
+	_, err = a.GetHistory("ACME", stock.IntervalWeekly, day(3), day(8))
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+	assert.Equal(t, 2, live.requests)
+}
@@ -1,50 +1,182 @@
 package stock
 
 import (
-	fp "github.com/robaho/fixed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 	"syscall"
+	"time"
+
+	fp "github.com/robaho/fixed"
 )
 
+const (
+	CacheFileExt = ".cache.json"
+
+	DefaultCacheTtlCurrency = time.Hour * 4
+	DefaultCacheTtlQuote    = time.Minute * 15
+	DefaultCacheTtlSymbol   = time.Hour * 24 * 7
+)
+
+// CacheTtl is the time that each type of cached data remains valid. A zero
+// duration never expires.
+type CacheTtl struct {
+	Currency time.Duration
+	Quote    time.Duration
+	Symbol   time.Duration
+}
+
 type Cache struct {
-	mpCcy  map[string]Currency
-	mpQte  map[string]Quote
-	mpSym  map[string]Symbol
-	mtxCcy sync.RWMutex
-	mtxQte sync.RWMutex
-	mtxSym sync.RWMutex
+	filename string
+	mpCcy    map[string]Currency
+	mpQte    map[string]Quote
+	mpSym    map[string]Symbol
+	mtxCcy   sync.RWMutex
+	mtxFile  sync.Mutex
+	mtxQte   sync.RWMutex
+	mtxSym   sync.RWMutex
+	tmCcy    map[string]time.Time // map[currency/currencyTo]Time
+	tmQte    map[string]time.Time
+	tmSym    map[string]time.Time
+	ttl      CacheTtl
+}
+
+// On-disk representation of a cache
+type cacheFile struct {
+	Currencies map[string]cacheCurrency `json:"currencies"`
+	Quotes     map[string]cacheQuote    `json:"quotes"`
+	Symbols    map[string]cacheSymbol   `json:"symbols"`
+}
+
+type cacheCurrency struct {
+	Name  string               `json:"name"`
+	Rates map[string]cacheRate `json:"rates"`
+}
+
+type cacheRate struct {
+	Rate string    `json:"rate"`
+	Time time.Time `json:"time"`
+}
+
+type cacheQuote struct {
+	Quote Quote     `json:"quote"`
+	Time  time.Time `json:"time"`
+}
+
+type cacheSymbol struct {
+	Symbol Symbol    `json:"symbol"`
+	Time   time.Time `json:"time"`
+}
+
+func currencyKey(currency, currencyTo string) string {
+	return currency + "/" + currencyTo
+}
+
+func isExpired(tm time.Time, ttl time.Duration) bool {
+	return ttl > 0 && time.Since(tm) > ttl
 }
 
 func (c *Cache) AddCurrency(currency Currency) error {
 	c.mtxCcy.Lock()
-	defer c.mtxCcy.Unlock()
+	now := time.Now()
 	if ccy, exists := c.mpCcy[currency.Currency]; exists {
 		if currency.Rates == nil {
 			currency.Rates = make(map[string]fp.Fixed)
 		} else {
 			for key, val := range currency.Rates {
 				ccy.Rates[key] = val
+				c.tmCcy[currencyKey(currency.Currency, key)] = now
 			}
 		}
 		c.mpCcy[currency.Currency] = ccy
 	} else {
+		if currency.Rates == nil {
+			currency.Rates = make(map[string]fp.Fixed)
+		}
+		for key := range currency.Rates {
+			c.tmCcy[currencyKey(currency.Currency, key)] = now
+		}
 		c.mpCcy[currency.Currency] = currency
 	}
-	return nil
+	c.mtxCcy.Unlock()
+	return c.save()
 }
 
 func (c *Cache) AddQuote(quote Quote) error {
 	c.mtxQte.Lock()
-	defer c.mtxQte.Unlock()
 	c.mpQte[quote.Symbol] = quote
-	return nil
+	c.tmQte[quote.Symbol] = time.Now()
+	c.mtxQte.Unlock()
+	return c.save()
 }
 
 func (c *Cache) AddSymbol(symbol Symbol) error {
 	c.mtxSym.Lock()
-	defer c.mtxSym.Unlock()
 	c.mpSym[symbol.Symbol] = symbol
-	return nil
+	c.tmSym[symbol.Symbol] = time.Now()
+	c.mtxSym.Unlock()
+	return c.save()
+}
+
+// Clear removes all cached data, including any cache file.
+func (c *Cache) Clear() error {
+	c.mtxCcy.Lock()
+	c.mpCcy = make(map[string]Currency)
+	c.tmCcy = make(map[string]time.Time)
+	c.mtxCcy.Unlock()
+
+	c.mtxQte.Lock()
+	c.mpQte = make(map[string]Quote)
+	c.tmQte = make(map[string]time.Time)
+	c.mtxQte.Unlock()
+
+	c.mtxSym.Lock()
+	c.mpSym = make(map[string]Symbol)
+	c.tmSym = make(map[string]time.Time)
+	c.mtxSym.Unlock()
+
+	var err error
+	if len(c.filename) > 0 {
+		c.mtxFile.Lock()
+		defer c.mtxFile.Unlock()
+		if err = os.Remove(c.filename); errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	}
+	return err
+}
+
+// ClearCacheDir removes all cache files found in a directory.
+func ClearCacheDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+CacheFileExt))
+	for _, file := range files {
+		if err = os.Remove(file); err != nil {
+			break
+		}
+	}
+	return err
+}
+
+// DefaultCacheDir returns the user cache directory for stocker, or an empty
+// string if one cannot be determined.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "stocker")
+}
+
+func DefaultCacheTtl() CacheTtl {
+	return CacheTtl{
+		Currency: DefaultCacheTtlCurrency,
+		Quote:    DefaultCacheTtlQuote,
+		Symbol:   DefaultCacheTtlSymbol,
+	}
 }
 
 func (c *Cache) GetCurrency(currency, currencyTo string) (Currency, error) {
@@ -54,7 +186,9 @@ func (c *Cache) GetCurrency(currency, currencyTo string) (Currency, error) {
 	ccy, exists := c.mpCcy[currency]
 	if exists {
 		if _, exists = ccy.Rates[currencyTo]; exists {
-			err = nil
+			if !isExpired(c.tmCcy[currencyKey(currency, currencyTo)], c.ttl.Currency) {
+				err = nil
+			}
 		}
 	}
 	return ccy, err
@@ -65,7 +199,7 @@ func (c *Cache) GetQuote(quote string) (Quote, error) {
 	c.mtxQte.RLock()
 	defer c.mtxQte.RUnlock()
 	qte, exists := c.mpQte[quote]
-	if !exists {
+	if !exists || isExpired(c.tmQte[quote], c.ttl.Quote) {
 		err = syscall.ENOENT
 	}
 	return qte, err
@@ -76,16 +210,134 @@ func (c *Cache) GetSymbol(symbol string) (Symbol, error) {
 	c.mtxSym.RLock()
 	defer c.mtxSym.RUnlock()
 	sym, exists := c.mpSym[symbol]
-	if !exists {
+	if !exists || isExpired(c.tmSym[symbol], c.ttl.Symbol) {
 		err = syscall.ENOENT
 	}
 	return sym, err
 }
 
+func (c *Cache) load() error {
+	buf, err := ioutil.ReadFile(c.filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	file := cacheFile{}
+	if err = json.Unmarshal(buf, &file); err != nil {
+		return err
+	}
+
+	for currency, entry := range file.Currencies {
+		ccy := Currency{Currency: currency, Name: entry.Name, Rates: make(map[string]fp.Fixed)}
+		for currencyTo, rate := range entry.Rates {
+			if ccy.Rates[currencyTo], err = fp.NewSErr(rate.Rate); err != nil {
+				return err
+			}
+			c.tmCcy[currencyKey(currency, currencyTo)] = rate.Time
+		}
+		c.mpCcy[currency] = ccy
+	}
+
+	for key, entry := range file.Quotes {
+		c.mpQte[key] = entry.Quote
+		c.tmQte[key] = entry.Time
+	}
+
+	for key, entry := range file.Symbols {
+		c.mpSym[key] = entry.Symbol
+		c.tmSym[key] = entry.Time
+	}
+
+	return nil
+}
+
+// Write the cache to a temporary file and then rename it so that the cache
+// file is never left partially written.
+func (c *Cache) save() error {
+	if len(c.filename) == 0 {
+		return nil
+	}
+
+	file := cacheFile{
+		Currencies: make(map[string]cacheCurrency),
+		Quotes:     make(map[string]cacheQuote),
+		Symbols:    make(map[string]cacheSymbol),
+	}
+
+	c.mtxCcy.RLock()
+	for currency, ccy := range c.mpCcy {
+		entry := cacheCurrency{Name: ccy.Name, Rates: make(map[string]cacheRate)}
+		for currencyTo, rate := range ccy.Rates {
+			entry.Rates[currencyTo] = cacheRate{Rate: rate.String(), Time: c.tmCcy[currencyKey(currency, currencyTo)]}
+		}
+		file.Currencies[currency] = entry
+	}
+	c.mtxCcy.RUnlock()
+
+	c.mtxQte.RLock()
+	for key, qte := range c.mpQte {
+		file.Quotes[key] = cacheQuote{Quote: qte, Time: c.tmQte[key]}
+	}
+	c.mtxQte.RUnlock()
+
+	c.mtxSym.RLock()
+	for key, sym := range c.mpSym {
+		file.Symbols[key] = cacheSymbol{Symbol: sym, Time: c.tmSym[key]}
+	}
+	c.mtxSym.RUnlock()
+
+	buf, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	c.mtxFile.Lock()
+	defer c.mtxFile.Unlock()
+
+	if err = os.MkdirAll(filepath.Dir(c.filename), 0755); err != nil {
+		return err
+	}
+
+	var tmp *os.File
+	if tmp, err = ioutil.TempFile(filepath.Dir(c.filename), filepath.Base(c.filename)+".*.tmp"); err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(buf); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.filename)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
 func NewCache() *Cache {
 	return &Cache{
 		mpCcy: make(map[string]Currency),
 		mpQte: make(map[string]Quote),
 		mpSym: make(map[string]Symbol),
+		tmCcy: make(map[string]time.Time),
+		tmQte: make(map[string]time.Time),
+		tmSym: make(map[string]time.Time),
 	}
 }
+
+// NewFileCache creates a cache that is loaded from, and saved to, a file so
+// that cached data survives between runs. Cached data expires according to
+// the time-to-live of its type.
+func NewFileCache(filename string, ttl CacheTtl) (*Cache, error) {
+	c := NewCache()
+	c.filename = filename
+	c.ttl = ttl
+	return c, c.load()
+}
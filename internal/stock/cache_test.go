@@ -0,0 +1,113 @@
+package stock
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	fp "github.com/robaho/fixed"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_Memory(t *testing.T) {
+	c := NewCache()
+
+	_, err := c.GetSymbol("ACME")
+	assert.Equal(t, syscall.ENOENT, err)
+
+	assert.Nil(t, c.AddSymbol(Symbol{Currency: "USD", Symbol: "ACME"}))
+	sym, err := c.GetSymbol("ACME")
+	assert.Nil(t, err)
+	assert.Equal(t, "USD", sym.Currency)
+
+	assert.Nil(t, c.AddCurrency(Currency{Currency: "USD", Rates: map[string]fp.Fixed{"CAD": fp.NewF(1.35)}}))
+	assert.Nil(t, c.AddCurrency(Currency{Currency: "USD", Rates: map[string]fp.Fixed{"EUR": fp.NewF(0.92)}}))
+	ccy, err := c.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ccy.Rates))
+	_, err = c.GetCurrency("USD", "GBP")
+	assert.Equal(t, syscall.ENOENT, err)
+
+	assert.Nil(t, c.Clear())
+	_, err = c.GetSymbol("ACME")
+	assert.Equal(t, syscall.ENOENT, err)
+}
+
+func TestCache_File(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test"+CacheFileExt)
+
+	c, err := NewFileCache(filename, DefaultCacheTtl())
+	assert.Nil(t, err)
+
+	qte := Quote{Symbol: "ACME"}
+	qte.Prices.Latest = 12.5
+	assert.Nil(t, c.AddQuote(qte))
+	assert.Nil(t, c.AddSymbol(Symbol{Currency: "USD", Description: "Acme Corp", Symbol: "ACME"}))
+	assert.Nil(t, c.AddCurrency(Currency{Currency: "USD", Name: "US Dollar", Rates: map[string]fp.Fixed{"CAD": fp.NewF(1.35)}}))
+
+	c, err = NewFileCache(filename, DefaultCacheTtl())
+	assert.Nil(t, err)
+
+	qte, err = c.GetQuote("ACME")
+	assert.Nil(t, err)
+	assert.Equal(t, 12.5, qte.Prices.Latest)
+
+	sym, err := c.GetSymbol("ACME")
+	assert.Nil(t, err)
+	assert.Equal(t, "Acme Corp", sym.Description)
+
+	ccy, err := c.GetCurrency("USD", "CAD")
+	assert.Nil(t, err)
+	assert.Equal(t, "US Dollar", ccy.Name)
+	assert.Equal(t, "1.3500", ccy.Rates["CAD"].StringN(4))
+
+	assert.Nil(t, c.Clear())
+	_, err = os.Stat(filename)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCache_FileExpired(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test"+CacheFileExt)
+
+	c, err := NewFileCache(filename, CacheTtl{Currency: time.Nanosecond, Quote: time.Nanosecond})
+	assert.Nil(t, err)
+	assert.Nil(t, c.AddQuote(Quote{Symbol: "ACME"}))
+	assert.Nil(t, c.AddSymbol(Symbol{Symbol: "ACME"}))
+	assert.Nil(t, c.AddCurrency(Currency{Currency: "USD", Rates: map[string]fp.Fixed{"CAD": fp.NewF(1.35)}}))
+	time.Sleep(time.Millisecond)
+
+	_, err = c.GetQuote("ACME")
+	assert.Equal(t, syscall.ENOENT, err)
+
+	_, err = c.GetCurrency("USD", "CAD")
+	assert.Equal(t, syscall.ENOENT, err)
+
+	// Symbols never expire with a zero time-to-live
+	_, err = c.GetSymbol("ACME")
+	assert.Nil(t, err)
+}
+
+func TestCache_FileInvalid(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test"+CacheFileExt)
+	assert.Nil(t, os.WriteFile(filename, []byte("{"), 0644))
+
+	c, err := NewFileCache(filename, DefaultCacheTtl())
+	assert.NotNil(t, err)
+	assert.NotNil(t, c)
+}
+
+func TestClearCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	other := filepath.Join(dir, "other.json")
+	assert.Nil(t, os.WriteFile(other, []byte("{}"), 0644))
+
+	c, err := NewFileCache(filepath.Join(dir, "test"+CacheFileExt), DefaultCacheTtl())
+	assert.Nil(t, err)
+	assert.Nil(t, c.AddSymbol(Symbol{Symbol: "ACME"}))
+
+	assert.Nil(t, ClearCacheDir(dir))
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Equal(t, []string{other}, files)
+}
@@ -1,6 +1,53 @@
 package stock
 
-import fp "github.com/robaho/fixed"
+import (
+	"time"
+
+	fp "github.com/robaho/fixed"
+)
+
+// Account is a brokerage account
+type Account struct {
+	Id      string
+	Primary bool
+	Status  string
+	Type    string
+}
+
+// Bar is the open, high, low and close prices and the volume traded of a
+// symbol over an interval. The adjusted close price includes dividends and
+// splits, and is the close price if adjusted prices are unavailable.
+type Bar struct {
+	AdjClose fp.Fixed  `json:"adjClose"`
+	Close    fp.Fixed  `json:"close"`
+	High     fp.Fixed  `json:"high"`
+	Low      fp.Fixed  `json:"low"`
+	Open     fp.Fixed  `json:"open"`
+	Time     time.Time `json:"time"` // Date of the close price, at midnight UTC
+	Volume   int64     `json:"volume"`
+}
+
+// History intervals
+const (
+	IntervalDaily   = "daily"
+	IntervalMonthly = "monthly"
+	IntervalWeekly  = "weekly"
+)
+
+// IsInterval returns true if a price history can be found for an interval
+func IsInterval(interval string) bool {
+	switch interval {
+	case IntervalDaily, IntervalMonthly, IntervalWeekly:
+		return true
+	}
+	return false
+}
+
+// Balance is the cash held in one currency by an account
+type Balance struct {
+	Cash     fp.Fixed
+	Currency string
+}
 
 type Currency struct {
 	Currency string
@@ -8,6 +55,28 @@ type Currency struct {
 	Rates    map[string]fp.Fixed // map[currencyTo]ExchangeRate
 }
 
+// Order is a request to buy or sell a quantity of a symbol. An order without a
+// limit price is a market order.
+type Order struct {
+	Action     string // OrderBuy or OrderSell
+	LimitPrice fp.Fixed
+	Qty        fp.Fixed
+	Symbol     string
+}
+
+// Order actions
+const (
+	OrderBuy  = "buy"
+	OrderSell = "sell"
+)
+
+// OrderImpact is the estimated effect of an order on an account
+type OrderImpact struct {
+	BuyingPowerEffect fp.Fixed
+	Commission        fp.Fixed
+	Price             fp.Fixed
+}
+
 type price struct {
 	Ask         float64
 	Bid         float64
@@ -19,6 +88,12 @@ type price struct {
 	LatestTrHrs float64
 }
 
+// Position is the quantity of a symbol held by an account
+type Position struct {
+	Qty    fp.Fixed
+	Symbol string
+}
+
 type Quote struct {
 	Prices price
 	Symbol string